@@ -0,0 +1,115 @@
+// Command justpin runs the pinning daemon: pin jobs submitted over HTTP
+// are run in the background against the providers configured from the
+// environment.
+//
+// A provider is enabled when its key is set:
+//
+//   - INFURA_API_KEY and INFURA_API_SECRET
+//   - NFTSTORAGE_API_KEY
+//   - PINATA_API_KEY and PINATA_SECRET_API_KEY
+//   - WEB3STORAGE_API_KEY
+//
+// The access token of the API is read from JUSTPIN_TOKEN.
+//
+// Usage:
+//
+// > justpin -listen :5080 -data /var/lib/justpin -root /srv/files -dashboard
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	justpin "github.com/heilart1n/justpin-ipfs"
+	"github.com/heilart1n/justpin-ipfs/config"
+	"github.com/heilart1n/justpin-ipfs/daemon"
+	"github.com/heilart1n/justpin-ipfs/pinners"
+)
+
+func main() {
+	listen := flag.String("listen", "127.0.0.1:5080", "address to serve the API on")
+	data := flag.String("data", "justpin-data", "directory keeping the jobs and uploads")
+	root := flag.String("root", "", "directory path jobs may pin from, none if empty")
+	workers := flag.Int("workers", daemon.DefaultWorkers, "jobs run at once")
+	retries := flag.Int("retries", daemon.DefaultRetries, "retries of a failed pin per provider")
+	backoff := flag.Duration("backoff", daemon.DefaultBackoff, "wait before the first retry, doubled at each retry")
+	rate := flag.Duration("rate", 0, "minimum time between two requests to a provider")
+	maxUpload := flag.Int64("max-upload", daemon.DefaultMaxUploadSize, "largest upload accepted, in bytes")
+	dashboard := flag.Bool("dashboard", false, "serve the web dashboard at /dashboard/")
+	grace := flag.Duration("grace", time.Minute, "time given to running jobs on shutdown")
+	flag.Parse()
+
+	targets := providers()
+	if len(targets) == 0 {
+		log.Fatal("no provider configured, set the API key of at least one")
+	}
+	opts := []daemon.Option{
+		daemon.AccessToken(os.Getenv("JUSTPIN_TOKEN")),
+		daemon.Root(*root),
+		daemon.Workers(*workers),
+		daemon.Retries(*retries, *backoff),
+		daemon.RateLimit(*rate),
+		daemon.MaxUploadSize(*maxUpload),
+	}
+	if *dashboard {
+		opts = append(opts, daemon.Dashboard())
+	}
+	srv, err := daemon.NewServer(*data, targets, opts...)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	hs := &http.Server{Addr: *listen, Handler: srv}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		<-ctx.Done()
+		log.Print("shutting down")
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), *grace)
+		defer cancel()
+		// Uploads being received are completed first, then the jobs.
+		if err := hs.Shutdown(shutdownCtx); err != nil {
+			log.Printf("close listener failed: %v", err)
+		}
+		if err := srv.Shutdown(shutdownCtx); err != nil {
+			log.Printf("jobs interrupted, they resume at the next start: %v", err)
+		}
+	}()
+
+	for _, p := range targets {
+		log.Printf("pinning to %s", p.Name())
+	}
+	log.Printf("listening on %s", *listen)
+	if err := hs.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		log.Fatal(err)
+	}
+	// ListenAndServe returns as soon as the shutdown starts.
+	<-done
+}
+
+// providers returns the pinners whose credentials are in the environment.
+func providers() []pinners.Pinner {
+	ps := &justpin.Pinners{}
+	if key := os.Getenv("INFURA_API_KEY"); key != "" {
+		ps.Infura = justpin.MustNewPinner(config.NewConfig(key, os.Getenv("INFURA_API_SECRET")), justpin.ClientNameInfura)
+	}
+	if key := os.Getenv("NFTSTORAGE_API_KEY"); key != "" {
+		ps.NFTStorage = justpin.MustNewPinner(config.NewConfig(key, ""), justpin.ClientNameNFTStorage)
+	}
+	if key := os.Getenv("PINATA_API_KEY"); key != "" {
+		ps.Pinata = justpin.MustNewPinner(config.NewConfig(key, os.Getenv("PINATA_SECRET_API_KEY")), justpin.ClientNamePinata)
+	}
+	if key := os.Getenv("WEB3STORAGE_API_KEY"); key != "" {
+		ps.Web3Storage = justpin.MustNewPinner(config.NewConfig(key, ""), justpin.ClientNameWeb3Storage)
+	}
+	return ps.All()
+}
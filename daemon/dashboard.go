@@ -0,0 +1,27 @@
+package daemon
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+)
+
+// dashboardPath is where the dashboard is served.
+const dashboardPath = "/dashboard/"
+
+//go:embed dashboard
+var dashboardFiles embed.FS
+
+var dashboardHandler = func() http.Handler {
+	files, err := fs.Sub(dashboardFiles, "dashboard")
+	if err != nil {
+		panic(err)
+	}
+	return http.StripPrefix(dashboardPath, http.FileServer(http.FS(files)))
+}()
+
+func serveDashboard(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Security-Policy", "default-src 'self'")
+	w.Header().Set("X-Frame-Options", "DENY")
+	dashboardHandler.ServeHTTP(w, r)
+}
@@ -0,0 +1,232 @@
+'use strict';
+
+// The dashboard polls the job API and renders the jobs in three views: the
+// ones in progress, the failures and the recent pins per provider.
+
+const refreshInterval = 3000;
+const recentPins = 25;
+const tokenKey = 'justpin-token';
+// The API is served next to the dashboard directory, wherever it's mounted.
+const apiBase = '../';
+
+let providers = [];
+let jobs = [];
+
+function el(tag, props, ...children) {
+  const e = document.createElement(tag);
+  Object.assign(e, props);
+  for (const child of children) {
+    if (child != null) {
+      e.append(child);
+    }
+  }
+  return e;
+}
+
+function button(text, onclick, className) {
+  return el('button', {type: 'button', textContent: text, className: className || '', onclick});
+}
+
+function statusText(status) {
+  return el('span', {className: 'status status-' + status, textContent: status});
+}
+
+function formatSize(n) {
+  const units = ['B', 'KiB', 'MiB', 'GiB', 'TiB'];
+  let i = 0;
+  while (n >= 1024 && i < units.length - 1) {
+    n /= 1024;
+    i++;
+  }
+  return (i ? n.toFixed(1) : n) + ' ' + units[i];
+}
+
+function formatTime(t) {
+  return new Date(t).toLocaleString();
+}
+
+function label(job) {
+  return job.name || job.source || job.id;
+}
+
+function showMessage(text) {
+  const message = document.getElementById('message');
+  message.textContent = text;
+  message.hidden = !text;
+}
+
+async function api(method, path) {
+  const headers = {};
+  const token = localStorage.getItem(tokenKey);
+  if (token) {
+    headers.Authorization = 'Bearer ' + token;
+  }
+  const resp = await fetch(apiBase + path, {method, headers});
+  const body = await resp.json().catch(() => ({}));
+  if (!resp.ok) {
+    if (resp.status === 401) {
+      throw new Error('The access token is missing or invalid, enter it above.');
+    }
+    throw new Error(body.error || resp.statusText);
+  }
+  return body;
+}
+
+// act runs an action on a job, then refreshes the views.
+async function act(method, path, confirmText) {
+  if (confirmText && !confirm(confirmText)) {
+    return;
+  }
+  try {
+    await api(method, path);
+    showMessage('');
+  } catch (err) {
+    showMessage(err.message);
+  }
+  refresh();
+}
+
+function matches(job, query) {
+  if (!query) {
+    return true;
+  }
+  const fields = [job.id, job.name, job.source];
+  for (const o of Object.values(job.results)) {
+    fields.push(o.cid);
+  }
+  return fields.some(f => f && f.toLowerCase().includes(query));
+}
+
+function jobHead(job, ...actions) {
+  const meta = [job.kind, formatTime(job.created)];
+  if (job.size) {
+    meta.push(formatSize(job.size));
+  }
+  return el('div', {className: 'job-head'},
+    el('span', {className: 'label', textContent: label(job), title: job.id}),
+    el('span', {className: 'meta', textContent: meta.join(' · ')}),
+    statusText(job.status),
+    ...actions);
+}
+
+function renderActive(list) {
+  const rows = list.map(job => {
+    const table = el('table', {});
+    for (const name of job.providers) {
+      const o = job.results[name];
+      let progress = null;
+      if (job.kind === 'upload' && o.status === 'running') {
+        progress = el('span', {},
+          el('progress', {max: job.size || 1, value: o.sent || 0}),
+          ' ' + formatSize(o.sent || 0) + ' of ' + formatSize(job.size));
+      }
+      let retry = null;
+      if (o.error) {
+        retry = el('pre', {className: 'error', textContent: 'Attempt ' + o.attempts + ' failed: ' + o.error});
+      }
+      table.append(el('tr', {},
+        el('td', {textContent: name}),
+        el('td', {}, statusText(o.status)),
+        el('td', {}, progress, retry)));
+    }
+    const cancel = button('Cancel', () => act('DELETE', 'jobs/' + job.id, 'Cancel ' + label(job) + '?'), 'danger');
+    return el('div', {className: 'job'}, jobHead(job, cancel), table);
+  });
+  return rows.length ? rows : [el('p', {className: 'empty', textContent: 'Nothing in progress.'})];
+}
+
+function renderFailed(list) {
+  const rows = list.map(job => {
+    const table = el('table', {});
+    for (const name of job.providers) {
+      const o = job.results[name];
+      table.append(el('tr', {},
+        el('td', {textContent: name}),
+        el('td', {}, statusText(o.status)),
+        el('td', {textContent: o.attempts + (o.attempts === 1 ? ' attempt' : ' attempts')}),
+        el('td', {}, o.error ? el('pre', {className: 'error', textContent: o.error}) : null)));
+    }
+    const repin = button('Re-pin', () => act('POST', 'jobs/' + job.id + '/retry'));
+    return el('div', {className: 'job'}, jobHead(job, repin), table);
+  });
+  return rows.length ? rows : [el('p', {className: 'empty', textContent: 'No failures.'})];
+}
+
+function cidCell(o) {
+  const td = el('td', {className: 'cid'});
+  if (o.link && /^https?:\/\//.test(o.link)) {
+    td.append(el('a', {href: o.link, target: '_blank', rel: 'noopener noreferrer', textContent: o.cid}));
+  } else {
+    td.textContent = o.cid || '';
+  }
+  return td;
+}
+
+function renderProviders(list) {
+  return providers.map(p => {
+    const table = el('table', {},
+      el('tr', {}, ...['Name', 'CID', 'Pinned', 'Status', ''].map(h => el('th', {textContent: h}))));
+    let n = 0;
+    for (const job of list) {
+      const o = job.results[p.name];
+      if (!o || o.status !== 'done' && o.status !== 'unpinned' || n >= recentPins) {
+        continue;
+      }
+      n++;
+      let action = null;
+      if (o.status === 'unpinned') {
+        action = button('Re-pin', () => act('POST', 'jobs/' + job.id + '/retry'));
+      } else if (p.unpin && job.status !== 'queued' && job.status !== 'running') {
+        action = button('Unpin', () => act('POST', 'jobs/' + job.id + '/unpin?provider=' + encodeURIComponent(p.name),
+          'Unpin ' + label(job) + ' from ' + p.name + '?'), 'danger');
+      }
+      table.append(el('tr', {},
+        el('td', {textContent: label(job), title: job.id}),
+        cidCell(o),
+        el('td', {textContent: formatTime(job.updated)}),
+        el('td', {}, statusText(o.status), o.error ? el('pre', {className: 'error', textContent: o.error}) : null),
+        el('td', {}, action)));
+    }
+    const body = n ? table : el('p', {className: 'empty', textContent: 'No pins yet.'});
+    return el('div', {}, el('h3', {textContent: p.name}), body);
+  });
+}
+
+function render() {
+  const query = document.getElementById('search').value.trim().toLowerCase();
+  const list = jobs.filter(job => matches(job, query));
+  const active = list.filter(job => job.status === 'queued' || job.status === 'running');
+  const failed = list.filter(job => job.status === 'failed' || job.status === 'canceled');
+
+  document.getElementById('active-count').textContent = active.length ? '(' + active.length + ')' : '';
+  document.getElementById('failed-count').textContent = failed.length ? '(' + failed.length + ')' : '';
+  document.getElementById('active').replaceChildren(...renderActive(active));
+  document.getElementById('failed').replaceChildren(...renderFailed(failed));
+  document.getElementById('providers').replaceChildren(...renderProviders(list));
+}
+
+async function refresh() {
+  try {
+    if (!providers.length) {
+      providers = await api('GET', 'providers');
+    }
+    jobs = (await api('GET', 'jobs?limit=1000')).jobs;
+    document.getElementById('updated').textContent = new Date().toLocaleTimeString();
+    render();
+  } catch (err) {
+    showMessage(err.message);
+  }
+}
+
+document.getElementById('token-form').addEventListener('submit', e => {
+  e.preventDefault();
+  const input = document.getElementById('token');
+  localStorage.setItem(tokenKey, input.value);
+  input.value = '';
+  showMessage('');
+  refresh();
+});
+document.getElementById('search').addEventListener('input', render);
+
+refresh();
+setInterval(refresh, refreshInterval);
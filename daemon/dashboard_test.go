@@ -0,0 +1,79 @@
+package daemon
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/heilart1n/justpin-ipfs/pinners"
+)
+
+func TestDashboard(t *testing.T) {
+	s, err := NewServer(t.TempDir(), []pinners.Pinner{&fakePinner{name: "fake"}}, AccessToken("secret"), Dashboard())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Shutdown(context.Background())
+
+	get := func(target string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+		return w
+	}
+
+	// The dashboard is served without the token, it holds no data.
+	w := get("/")
+	if w.Code != http.StatusFound || w.Header().Get("Location") != dashboardPath {
+		t.Errorf("/: status %d, location %q", w.Code, w.Header().Get("Location"))
+	}
+	for _, target := range []string{dashboardPath, dashboardPath + "dashboard.js", dashboardPath + "dashboard.css"} {
+		w := get(target)
+		if w.Code != http.StatusOK {
+			t.Errorf("%s: status %d", target, w.Code)
+		}
+		if csp := w.Header().Get("Content-Security-Policy"); csp != "default-src 'self'" {
+			t.Errorf("%s: Content-Security-Policy %q", target, csp)
+		}
+		if w.Header().Get("X-Frame-Options") != "DENY" {
+			t.Errorf("%s: framing allowed", target)
+		}
+	}
+	if w := get(dashboardPath); !strings.Contains(w.Body.String(), "dashboard.js") {
+		t.Errorf("index doesn't load the script: %s", w.Body)
+	}
+
+	// The API still asks for it.
+	for _, target := range []string{"/jobs", "/providers", "/jobs/1234"} {
+		if w := get(target); w.Code != http.StatusUnauthorized {
+			t.Errorf("%s without token: status %d", target, w.Code)
+		}
+	}
+	w = httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/providers", nil)
+	r.Header.Set("Authorization", "Bearer secret")
+	s.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Errorf("/providers with token: status %d", w.Code)
+	}
+	w = httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest(http.MethodPost, dashboardPath, nil))
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("POST %s without token: status %d", dashboardPath, w.Code)
+	}
+}
+
+func TestDashboardDisabled(t *testing.T) {
+	s, err := NewServer(t.TempDir(), []pinners.Pinner{&fakePinner{name: "fake"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Shutdown(context.Background())
+
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest(http.MethodGet, dashboardPath, nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("%s: status %d, want it not served", dashboardPath, w.Code)
+	}
+}
@@ -0,0 +1,189 @@
+package daemon
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/heilart1n/justpin-ipfs/file"
+)
+
+// Kind is what a job pins.
+type Kind string
+
+const (
+	KindPath   Kind = "path"
+	KindURL    Kind = "url"
+	KindCid    Kind = "cid"
+	KindUpload Kind = "upload"
+)
+
+// Status is the state of a job, or of its pin to one provider.
+type Status string
+
+const (
+	StatusQueued   Status = "queued"
+	StatusRunning  Status = "running"
+	StatusDone     Status = "done"
+	StatusFailed   Status = "failed"
+	StatusCanceled Status = "canceled"
+	// StatusUnpinned is a pin removed from its provider, or a job whose
+	// pins all were.
+	StatusUnpinned Status = "unpinned"
+)
+
+// Finished reports whether nothing runs for the status anymore, a finished
+// job being retried only on request.
+func (st Status) Finished() bool {
+	return st == StatusDone || st == StatusFailed || st == StatusCanceled || st == StatusUnpinned
+}
+
+// Request is a job to submit to `POST /jobs`, one of Path, URL and Cid
+// being set.
+type Request struct {
+	// Path is a file or directory under the root of the Server. Symlinks
+	// in it are only followed when they stay within it.
+	Path string `json:"path,omitempty"`
+	URL  string `json:"url,omitempty"`
+	Cid  string `json:"cid,omitempty"`
+	Name string `json:"name,omitempty"`
+	// Providers are the names of the pinners to pin to, all of them if
+	// empty.
+	Providers []string `json:"providers,omitempty"`
+}
+
+// Provider is a pinner jobs are pinned to.
+type Provider struct {
+	Name string `json:"name"`
+	// Unpin is whether pins can be removed from the provider.
+	Unpin bool `json:"unpin"`
+}
+
+// Outcome is the pin of a job to one provider.
+type Outcome struct {
+	Status   Status `json:"status"`
+	Cid      string `json:"cid,omitempty"`
+	Link     string `json:"link,omitempty"`
+	Error    string `json:"error,omitempty"`
+	Attempts int    `json:"attempts"`
+	// Sent is how much of an upload was read by the provider so far.
+	Sent int64 `json:"sent,omitempty"`
+}
+
+// Job is a pin to one or more providers and its progress. It is done once
+// pinned to every provider, failed once a provider ran out of retries.
+type Job struct {
+	ID   string `json:"id"`
+	Kind Kind   `json:"kind"`
+	// Source is the path, URL or CID pinned, empty for uploads.
+	Source      string              `json:"source,omitempty"`
+	Name        string              `json:"name,omitempty"`
+	ContentType string              `json:"type,omitempty"`
+	Size        int64               `json:"size,omitempty"`
+	Providers   []string            `json:"providers"`
+	Status      Status              `json:"status"`
+	Created     time.Time           `json:"created"`
+	Updated     time.Time           `json:"updated"`
+	Results     map[string]*Outcome `json:"results"`
+}
+
+// clone copies j, so it can be read without the lock.
+func (j *Job) clone() *Job {
+	c := *j
+	c.Results = make(map[string]*Outcome, len(j.Results))
+	for name, o := range j.Results {
+		oc := *o
+		c.Results[name] = &oc
+	}
+	return &c
+}
+
+func loadState(fp string) (map[string]*Job, error) {
+	jobs := map[string]*Job{}
+	data, err := os.ReadFile(fp)
+	if errors.Is(err, os.ErrNotExist) {
+		return jobs, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var list []*Job
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, fmt.Errorf("read state %s failed: %v", fp, err)
+	}
+	for _, j := range list {
+		jobs[j.ID] = j
+	}
+	return jobs, nil
+}
+
+// save writes the jobs to the state file, the caller holds the lock.
+func (s *Server) save() error {
+	list := make([]*Job, 0, len(s.jobs))
+	for _, j := range s.jobs {
+		list = append(list, j)
+	}
+	data, err := json.Marshal(list)
+	if err != nil {
+		return err
+	}
+	return file.WriteFileAtomic(filepath.Join(s.dir, stateFile), data)
+}
+
+// prune forgets the oldest finished jobs past the history limit, the
+// caller holds the lock.
+func (s *Server) prune() {
+	var finished []*Job
+	for _, j := range s.jobs {
+		if j.Status.Finished() {
+			finished = append(finished, j)
+		}
+	}
+	if len(finished) <= s.history {
+		return
+	}
+	sortJobs(finished)
+	for _, j := range finished[s.history:] {
+		delete(s.jobs, j.ID)
+		os.Remove(s.uploadPath(j.ID))
+	}
+}
+
+// list returns the count of jobs with one of statuses, all if none, and
+// the limit most recent ones.
+func (s *Server) list(statuses map[Status]bool, limit int) (int, []*Job) {
+	s.mu.Lock()
+	var jobs []*Job
+	for _, j := range s.jobs {
+		if len(statuses) == 0 || statuses[j.Status] {
+			jobs = append(jobs, j.clone())
+		}
+	}
+	s.mu.Unlock()
+
+	sortJobs(jobs)
+	count := len(jobs)
+	if len(jobs) > limit {
+		jobs = jobs[:limit]
+	}
+	return count, jobs
+}
+
+// sortJobs sorts jobs newest first.
+func sortJobs(jobs []*Job) {
+	sort.Slice(jobs, func(i, j int) bool {
+		if !jobs[i].Created.Equal(jobs[j].Created) {
+			return jobs[i].Created.After(jobs[j].Created)
+		}
+		return jobs[i].ID < jobs[j].ID
+	})
+}
+
+// uploadPath is where the content of an upload job is kept until pinned.
+func (s *Server) uploadPath(id string) string {
+	return filepath.Join(s.dir, uploadsDir, id)
+}
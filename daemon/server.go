@@ -0,0 +1,796 @@
+// Package daemon runs pin jobs in the background for other services: they
+// are submitted over a REST API, retried per provider and kept across
+// restarts, so credentials, rate limits and retries live in one process.
+package daemon
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/heilart1n/justpin-ipfs/file"
+	"github.com/heilart1n/justpin-ipfs/pinners"
+	"github.com/ipfs/go-cid"
+)
+
+const (
+	// DefaultWorkers is how many jobs run at once by default.
+	DefaultWorkers = 4
+	// DefaultRetries is how many times a failed pin is retried by default.
+	DefaultRetries = 3
+	// DefaultBackoff is the wait before the first retry by default, doubled
+	// at each retry.
+	DefaultBackoff = 2 * time.Second
+	// DefaultHistory is how many finished jobs are kept by default.
+	DefaultHistory = 1000
+	// DefaultMaxUploadSize is the largest upload accepted by default.
+	DefaultMaxUploadSize = 1 << 30
+
+	// FileField is the multipart form field holding an upload.
+	FileField = "file"
+
+	stateFile  = "state.json"
+	uploadsDir = "uploads"
+
+	maxBackoff   = 5 * time.Minute
+	defaultLimit = 100
+	maxBodySize  = 1 << 20
+)
+
+// Option configures a Server.
+type Option func(*Server)
+
+// AccessToken makes the Server require `Authorization: Bearer <token>`.
+// Without it, any request is served.
+func AccessToken(token string) Option {
+	return func(s *Server) {
+		s.token = token
+	}
+}
+
+// Root allows path jobs, for files and directories under dir. Paths are
+// refused without it.
+func Root(dir string) Option {
+	return func(s *Server) {
+		s.root = dir
+	}
+}
+
+// Workers sets how many jobs run at once.
+func Workers(n int) Option {
+	return func(s *Server) {
+		s.workers = n
+	}
+}
+
+// Retries sets how many times a failed pin is retried per provider, after
+// waiting backoff, doubled at each retry.
+func Retries(n int, backoff time.Duration) Option {
+	return func(s *Server) {
+		s.retries, s.backoff = n, backoff
+	}
+}
+
+// RateLimit spaces the requests made to each provider by at least every.
+func RateLimit(every time.Duration) Option {
+	return func(s *Server) {
+		s.every = every
+	}
+}
+
+// History sets how many finished jobs are kept, the oldest being forgotten.
+func History(n int) Option {
+	return func(s *Server) {
+		s.history = n
+	}
+}
+
+// Dashboard serves a web dashboard of the jobs at `/dashboard/`, for people
+// following pins without reading logs. It calls the API with the access
+// token typed in by its user.
+func Dashboard() Option {
+	return func(s *Server) {
+		s.dashboard = true
+	}
+}
+
+// MaxUploadSize limits the size of an upload to n bytes.
+func MaxUploadSize(n int64) Option {
+	return func(s *Server) {
+		s.maxUploadSize = n
+	}
+}
+
+// Server is an http.Handler running pin jobs:
+//
+//   - `POST /jobs` submits a Request as JSON.
+//   - `POST /uploads` submits the body, a multipart form whose FileField
+//     part is pinned or a raw body, with the `name` and `providers` query
+//     parameters.
+//   - `GET /jobs` lists the jobs, newest first, filtered by the `status`
+//     and `limit` query parameters.
+//   - `GET /jobs/{id}` returns a job, `GET /jobs/{id}/events` streams it as
+//     server-sent events each time it changes, until it is finished.
+//   - `DELETE /jobs/{id}` cancels a job. A running pin can only be stopped
+//     while an upload is read, others are left to complete.
+//   - `POST /jobs/{id}/retry` pins a failed, canceled or unpinned job again
+//     to the providers it isn't pinned to.
+//   - `POST /jobs/{id}/unpin` unpins a finished job from the providers it
+//     is pinned to, or from the one of the `provider` query parameter, when
+//     they support it. The outcome of each is in the job.
+//   - `GET /providers` lists the providers and whether they can unpin.
+//
+// Submitting answers 202 with the Job. Errors are answered as JSON:
+//
+// > {"error": "job 1234 not found"}
+//
+// The jobs are saved in the data directory of the Server, jobs that were
+// queued or running when it stopped are resumed. An upload is kept there
+// until pinned to every provider, so a failed one can be retried.
+//
+// Example:
+//
+// > ps := &justpin.Pinners{Web3Storage: justpin.MustNewPinner(cfg, justpin.ClientNameWeb3Storage)}
+// > srv, err := daemon.NewServer("/var/lib/justpin", ps.All(), daemon.AccessToken("secret"))
+// >
+// > err = http.ListenAndServe(":5080", srv)
+// >
+// > // Once the listener is closed.
+// > err = srv.Shutdown(ctx)
+type Server struct {
+	dir           string
+	targets       map[string]pinners.Pinner
+	names         []string
+	token         string
+	root          string
+	workers       int
+	retries       int
+	backoff       time.Duration
+	every         time.Duration
+	history       int
+	maxUploadSize int64
+	dashboard     bool
+
+	sem    chan struct{}
+	stop   chan struct{}
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+	limits map[string]*limiter
+
+	mu      sync.Mutex
+	jobs    map[string]*Job
+	cancels map[string]context.CancelFunc
+	changed chan struct{}
+	closing bool
+}
+
+// NewServer returns a Server pinning to targets, keeping its state in dir.
+// It fails when the state can't be read.
+func NewServer(dir string, targets []pinners.Pinner, opts ...Option) (*Server, error) {
+	if len(targets) == 0 {
+		return nil, fmt.Errorf("no pinners to pin to")
+	}
+	s := &Server{
+		dir:           dir,
+		targets:       map[string]pinners.Pinner{},
+		workers:       DefaultWorkers,
+		retries:       DefaultRetries,
+		backoff:       DefaultBackoff,
+		history:       DefaultHistory,
+		maxUploadSize: DefaultMaxUploadSize,
+		stop:          make(chan struct{}),
+		limits:        map[string]*limiter{},
+		cancels:       map[string]context.CancelFunc{},
+		changed:       make(chan struct{}),
+	}
+	for _, p := range targets {
+		if _, ok := s.targets[p.Name()]; ok {
+			return nil, fmt.Errorf("pinner %s given twice", p.Name())
+		}
+		s.targets[p.Name()] = p
+		s.names = append(s.names, p.Name())
+		s.limits[p.Name()] = &limiter{}
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	if s.workers <= 0 {
+		s.workers = DefaultWorkers
+	}
+	s.sem = make(chan struct{}, s.workers)
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+
+	if err := os.MkdirAll(filepath.Join(dir, uploadsDir), 0o700); err != nil {
+		return nil, err
+	}
+	var err error
+	if s.jobs, err = loadState(filepath.Join(dir, stateFile)); err != nil {
+		return nil, err
+	}
+	var resumed []string
+	for id, j := range s.jobs {
+		if j.Status.Finished() {
+			continue
+		}
+		j.Status = StatusQueued
+		for _, o := range j.Results {
+			if o.Status == StatusRunning {
+				o.Status = StatusQueued
+			}
+		}
+		resumed = append(resumed, id)
+	}
+	for _, id := range resumed {
+		s.wg.Add(1)
+		go s.process(id)
+	}
+	return s, nil
+}
+
+// Shutdown stops starting jobs and waits for the running ones to finish,
+// uploads included. When ctx is done first, the running jobs are
+// interrupted and resumed at the next start. Submissions are refused from
+// then on.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.mu.Lock()
+	if !s.closing {
+		s.closing = true
+		close(s.stop)
+	}
+	s.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		s.cancel()
+		<-done
+		return ctx.Err()
+	}
+}
+
+// httpError is an error with the status it is answered with.
+type httpError struct {
+	status int
+	msg    string
+}
+
+func (e *httpError) Error() string {
+	return e.msg
+}
+
+func errorf(status int, format string, a ...interface{}) error {
+	return &httpError{status: status, msg: fmt.Sprintf(format, a...)}
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if err := s.serve(w, r); err != nil {
+		status := http.StatusInternalServerError
+		var he *httpError
+		if errors.As(err, &he) {
+			status = he.status
+		}
+		writeJSON(w, status, map[string]string{"error": err.Error()})
+	}
+}
+
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) error {
+	// The dashboard holds no data, it asks the token to call the API with.
+	if s.dashboard && r.Method == http.MethodGet {
+		if r.URL.Path == "/" {
+			http.Redirect(w, r, dashboardPath, http.StatusFound)
+			return nil
+		}
+		if strings.HasPrefix(r.URL.Path, dashboardPath) {
+			serveDashboard(w, r)
+			return nil
+		}
+	}
+
+	if s.token != "" {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) != 1 {
+			return errorf(http.StatusUnauthorized, "access token is missing or invalid")
+		}
+	}
+
+	p := strings.TrimSuffix(r.URL.Path, "/")
+	switch {
+	case p == "/jobs" && r.Method == http.MethodGet:
+		return s.listJobs(w, r)
+	case p == "/jobs" && r.Method == http.MethodPost:
+		return s.submitRequest(w, r)
+	case p == "/uploads" && r.Method == http.MethodPost:
+		return s.submitUpload(w, r)
+	case p == "/providers" && r.Method == http.MethodGet:
+		writeJSON(w, http.StatusOK, s.providers())
+		return nil
+	case p == "/jobs" || p == "/uploads" || p == "/providers":
+		return errMethod(r)
+	}
+
+	rest, ok := strings.CutPrefix(p, "/jobs/")
+	if !ok {
+		return errorf(http.StatusNotFound, "%s not found", r.URL.Path)
+	}
+	id, action, _ := strings.Cut(rest, "/")
+	switch {
+	case action == "" && r.Method == http.MethodGet:
+		j, err := s.job(id)
+		if err != nil {
+			return err
+		}
+		writeJSON(w, http.StatusOK, j)
+		return nil
+	case action == "" && r.Method == http.MethodDelete:
+		j, err := s.cancelJob(id)
+		if err != nil {
+			return err
+		}
+		writeJSON(w, http.StatusOK, j)
+		return nil
+	case action == "events" && r.Method == http.MethodGet:
+		return s.streamJob(w, r, id)
+	case action == "retry" && r.Method == http.MethodPost:
+		j, err := s.retryJob(id)
+		if err != nil {
+			return err
+		}
+		writeJSON(w, http.StatusAccepted, j)
+		return nil
+	case action == "unpin" && r.Method == http.MethodPost:
+		j, err := s.unpinJob(id, r.URL.Query().Get("provider"))
+		if err != nil {
+			return err
+		}
+		writeJSON(w, http.StatusOK, j)
+		return nil
+	case action == "" || action == "events" || action == "retry" || action == "unpin":
+		return errMethod(r)
+	}
+	return errorf(http.StatusNotFound, "%s not found", r.URL.Path)
+}
+
+func errMethod(r *http.Request) error {
+	return errorf(http.StatusMethodNotAllowed, "method %s not allowed", r.Method)
+}
+
+func (s *Server) listJobs(w http.ResponseWriter, r *http.Request) error {
+	query := r.URL.Query()
+	statuses := map[Status]bool{}
+	if v := query.Get("status"); v != "" {
+		for _, st := range strings.Split(v, ",") {
+			switch Status(st) {
+			case StatusQueued, StatusRunning, StatusDone, StatusFailed, StatusCanceled, StatusUnpinned:
+				statuses[Status(st)] = true
+			default:
+				return errorf(http.StatusBadRequest, "invalid status %q", st)
+			}
+		}
+	}
+	limit := defaultLimit
+	if v := query.Get("limit"); v != "" {
+		var err error
+		if limit, err = strconv.Atoi(v); err != nil || limit < 1 {
+			return errorf(http.StatusBadRequest, "invalid limit %q", v)
+		}
+	}
+
+	count, jobs := s.list(statuses, limit)
+	if jobs == nil {
+		jobs = []*Job{}
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"count": count, "jobs": jobs})
+	return nil
+}
+
+func (s *Server) submitRequest(w http.ResponseWriter, r *http.Request) error {
+	var req Request
+	if err := json.NewDecoder(io.LimitReader(r.Body, maxBodySize)).Decode(&req); err != nil {
+		return errorf(http.StatusBadRequest, "invalid request: %v", err)
+	}
+
+	j := &Job{Name: req.Name}
+	switch {
+	case req.Path != "" && req.URL == "" && req.Cid == "":
+		if s.root == "" {
+			return errorf(http.StatusForbidden, "path jobs are not allowed")
+		}
+		if _, err := os.Stat(s.resolve(req.Path)); err != nil {
+			return errorf(http.StatusBadRequest, "invalid path %q", req.Path)
+		}
+		j.Kind, j.Source = KindPath, req.Path
+	case req.URL != "" && req.Path == "" && req.Cid == "":
+		u, err := url.Parse(req.URL)
+		if err != nil || u.Scheme != "http" && u.Scheme != "https" || u.Host == "" {
+			return errorf(http.StatusBadRequest, "invalid url %q", req.URL)
+		}
+		j.Kind, j.Source = KindURL, u.String()
+	case req.Cid != "" && req.Path == "" && req.URL == "":
+		c, err := cid.Decode(req.Cid)
+		if err != nil {
+			return errorf(http.StatusBadRequest, "invalid cid %q", req.Cid)
+		}
+		j.Kind, j.Source = KindCid, c.String()
+	default:
+		return errorf(http.StatusBadRequest, "one of path, url and cid must be given")
+	}
+
+	if err := s.submit(j, req.Providers); err != nil {
+		return err
+	}
+	writeJSON(w, http.StatusAccepted, j)
+	return nil
+}
+
+// resolve returns the file of a path job, which can't leave the root.
+func (s *Server) resolve(p string) string {
+	return filepath.Join(s.root, filepath.FromSlash(path.Clean("/"+p)))
+}
+
+func (s *Server) submitUpload(w http.ResponseWriter, r *http.Request) error {
+	query := r.URL.Query()
+	var providers []string
+	if v := query.Get("providers"); v != "" {
+		providers = strings.Split(v, ",")
+	}
+	if err := s.checkProviders(providers); err != nil {
+		return err
+	}
+	id, err := newID()
+	if err != nil {
+		return err
+	}
+	j := &Job{ID: id, Kind: KindUpload, Name: query.Get("name")}
+
+	r.Body = http.MaxBytesReader(w, r.Body, s.maxUploadSize+maxBodySize)
+	rd, name, declared, err := uploadPart(r)
+	if err != nil {
+		return err
+	}
+	if j.Name == "" {
+		j.Name = name
+	}
+	j.Name = path.Base(strings.ReplaceAll(j.Name, `\`, "/"))
+	if j.Name == "." || j.Name == ".." || j.Name == "/" {
+		j.Name = ""
+	}
+
+	contentType, body, err := file.DetectContentType(rd, j.Name)
+	if err != nil {
+		return s.uploadError(err)
+	}
+	if contentType == "application/octet-stream" && declared != "" {
+		contentType = declared
+	}
+	j.ContentType = contentType
+
+	fp := s.uploadPath(id)
+	f, err := os.Create(fp)
+	if err != nil {
+		return err
+	}
+	j.Size, err = io.Copy(f, io.LimitReader(body, s.maxUploadSize+1))
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil && j.Size > s.maxUploadSize {
+		err = &http.MaxBytesError{Limit: s.maxUploadSize}
+	}
+	if err == nil {
+		err = s.submit(j, providers)
+	}
+	if err != nil {
+		os.Remove(fp)
+		return s.uploadError(err)
+	}
+	writeJSON(w, http.StatusAccepted, j)
+	return nil
+}
+
+// uploadPart returns the content of an upload, the FileField part of a
+// multipart form or else the body, with its file name and declared type.
+func uploadPart(r *http.Request) (io.Reader, string, string, error) {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != "multipart/form-data" {
+		var name string
+		if _, params, err := mime.ParseMediaType(r.Header.Get("Content-Disposition")); err == nil {
+			name = params["filename"]
+		}
+		return r.Body, name, mediaType, nil
+	}
+
+	mr, err := r.MultipartReader()
+	if err != nil {
+		return nil, "", "", errorf(http.StatusBadRequest, "invalid multipart form: %v", err)
+	}
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			return nil, "", "", errorf(http.StatusBadRequest, "missing %q field", FileField)
+		}
+		if err != nil {
+			return nil, "", "", errorf(http.StatusBadRequest, "invalid multipart form: %v", err)
+		}
+		if part.FormName() == FileField {
+			mediaType, _, _ := mime.ParseMediaType(part.Header.Get("Content-Type"))
+			return part, part.FileName(), mediaType, nil
+		}
+		part.Close()
+	}
+}
+
+func (s *Server) uploadError(err error) error {
+	var mbe *http.MaxBytesError
+	if errors.As(err, &mbe) {
+		return errorf(http.StatusRequestEntityTooLarge, "upload is larger than %d bytes", s.maxUploadSize)
+	}
+	return err
+}
+
+func (s *Server) checkProviders(providers []string) error {
+	for _, name := range providers {
+		if s.targets[name] == nil {
+			return errorf(http.StatusBadRequest, "unknown provider %q", name)
+		}
+	}
+	return nil
+}
+
+func newID() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// submit queues j for providers, all of them if none, and fills in j.
+func (s *Server) submit(j *Job, providers []string) error {
+	if err := s.checkProviders(providers); err != nil {
+		return err
+	}
+	if len(providers) == 0 {
+		providers = s.names
+	}
+	if j.ID == "" {
+		var err error
+		if j.ID, err = newID(); err != nil {
+			return err
+		}
+	}
+	j.Status = StatusQueued
+	j.Created = time.Now().UTC()
+	j.Updated = j.Created
+	j.Results = map[string]*Outcome{}
+	for _, name := range providers {
+		if _, ok := j.Results[name]; !ok {
+			j.Providers = append(j.Providers, name)
+			j.Results[name] = &Outcome{Status: StatusQueued}
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closing {
+		return errorf(http.StatusServiceUnavailable, "shutting down")
+	}
+	s.jobs[j.ID] = j.clone()
+	if err := s.update(j.ID); err != nil {
+		delete(s.jobs, j.ID)
+		return err
+	}
+	s.wg.Add(1)
+	go s.process(j.ID)
+	return nil
+}
+
+func (s *Server) job(id string) (*Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	j := s.jobs[id]
+	if j == nil {
+		return nil, errorf(http.StatusNotFound, "job %s not found", id)
+	}
+	return j.clone(), nil
+}
+
+// cancelJob cancels the job id unless it is finished.
+func (s *Server) cancelJob(id string) (*Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	j := s.jobs[id]
+	if j == nil {
+		return nil, errorf(http.StatusNotFound, "job %s not found", id)
+	}
+	if j.Status.Finished() {
+		return nil, errorf(http.StatusConflict, "job %s is %s", id, j.Status)
+	}
+
+	if cancel := s.cancels[id]; cancel != nil {
+		// The worker finishes the job once its pins returned.
+		cancel()
+		return j.clone(), nil
+	}
+	j.Status = StatusCanceled
+	for _, o := range j.Results {
+		o.Status = StatusCanceled
+	}
+	if err := s.update(id); err != nil {
+		return nil, err
+	}
+	return j.clone(), nil
+}
+
+// retryJob queues the pins of the job id that aren't done again.
+func (s *Server) retryJob(id string) (*Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	j := s.jobs[id]
+	if j == nil {
+		return nil, errorf(http.StatusNotFound, "job %s not found", id)
+	}
+	if !j.Status.Finished() || j.Status == StatusDone {
+		return nil, errorf(http.StatusConflict, "job %s is %s", id, j.Status)
+	}
+	if s.closing {
+		return nil, errorf(http.StatusServiceUnavailable, "shutting down")
+	}
+
+	j.Status = StatusQueued
+	for _, o := range j.Results {
+		if o.Status != StatusDone {
+			o.Status = StatusQueued
+			o.Error = ""
+		}
+	}
+	if err := s.update(id); err != nil {
+		return nil, err
+	}
+	s.wg.Add(1)
+	go s.process(id)
+	return j.clone(), nil
+}
+
+// unpinJob unpins the job id from the providers it is pinned to, or only
+// from provider if set.
+func (s *Server) unpinJob(id, provider string) (*Job, error) {
+	j, err := s.job(id)
+	if err != nil {
+		return nil, err
+	}
+	if !j.Status.Finished() {
+		return nil, errorf(http.StatusConflict, "job %s is %s", id, j.Status)
+	}
+	if _, ok := j.Results[provider]; provider != "" && !ok {
+		return nil, errorf(http.StatusBadRequest, "job %s isn't pinned to %q", id, provider)
+	}
+
+	errs := map[string]error{}
+	for name, o := range j.Results {
+		if o.Status != StatusDone || provider != "" && name != provider {
+			continue
+		}
+		up, ok := s.targets[name].(pinners.Unpinner)
+		if !ok {
+			errs[name] = fmt.Errorf("unpin is not supported")
+			continue
+		}
+		errs[name] = up.Unpin(o.Cid)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if j = s.jobs[id]; j == nil {
+		return nil, errorf(http.StatusNotFound, "job %s not found", id)
+	}
+	pinned := false
+	for name, o := range j.Results {
+		err, tried := errs[name]
+		switch {
+		case tried && err == nil && o.Status == StatusDone:
+			o.Status = StatusUnpinned
+			o.Error = ""
+		case tried && err != nil:
+			o.Error = err.Error()
+		}
+		pinned = pinned || o.Status == StatusDone
+	}
+	if !pinned && j.Status.Finished() {
+		j.Status = StatusUnpinned
+	}
+	if err := s.update(id); err != nil {
+		return nil, err
+	}
+	return j.clone(), nil
+}
+
+// providers lists the providers in the order they were given.
+func (s *Server) providers() []Provider {
+	providers := make([]Provider, len(s.names))
+	for i, name := range s.names {
+		_, unpin := s.targets[name].(pinners.Unpinner)
+		providers[i] = Provider{Name: name, Unpin: unpin}
+	}
+	return providers
+}
+
+// streamJob sends the job id as a server-sent event each time it changes,
+// until it is finished or the client goes away.
+func (s *Server) streamJob(w http.ResponseWriter, r *http.Request, id string) error {
+	if _, err := s.job(id); err != nil {
+		return err
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		return errorf(http.StatusNotImplemented, "streaming is not supported")
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+
+	var last time.Time
+	for {
+		s.mu.Lock()
+		changed := s.changed
+		var j *Job
+		if j = s.jobs[id]; j != nil {
+			j = j.clone()
+		}
+		s.mu.Unlock()
+
+		if j == nil {
+			return nil
+		}
+		if !j.Updated.Equal(last) {
+			last = j.Updated
+			data, err := json.Marshal(j)
+			if err != nil {
+				return nil
+			}
+			if _, err := fmt.Fprintf(w, "event: job\ndata: %s\n\n", data); err != nil {
+				return nil
+			}
+			flusher.Flush()
+		}
+		if j.Status.Finished() {
+			return nil
+		}
+
+		select {
+		case <-changed:
+		case <-r.Context().Done():
+			return nil
+		case <-s.stop:
+			// Not to hold up the shutdown of the HTTP server.
+			return nil
+		}
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
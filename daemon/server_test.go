@@ -0,0 +1,245 @@
+package daemon
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/heilart1n/justpin-ipfs/pinners"
+)
+
+func TestResumeAfterRestart(t *testing.T) {
+	dir := t.TempDir()
+	release := make(chan struct{})
+	blocked := &fakePinner{name: "fake", attempt: func(int) error {
+		<-release
+		return nil
+	}}
+	s, err := NewServer(dir, []pinners.Pinner{blocked})
+	if err != nil {
+		t.Fatal(err)
+	}
+	job := submit(t, s, "/uploads", []byte("hello"))
+	for deadline := time.Now().Add(10 * time.Second); blocked.Calls() == 0; time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("no attempt made")
+		}
+	}
+
+	// The deadline interrupts the running pin, it is saved as queued.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		close(release)
+	}()
+	if err := s.Shutdown(ctx); err != context.Canceled {
+		t.Fatalf("shutdown = %v, want the context error", err)
+	}
+
+	p := &fakePinner{name: "fake"}
+	s, err = NewServer(dir, []pinners.Pinner{p})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Shutdown(context.Background())
+	j := waitJob(t, s, job.ID)
+	if o := j.Results["fake"]; j.Status != StatusDone || o.Cid != testCid || o.Attempts != 2 {
+		t.Errorf("job %s, outcome %+v, want done at the second attempt", j.Status, o)
+	}
+	if p.Calls() != 1 {
+		t.Errorf("%d attempts after the restart, want 1", p.Calls())
+	}
+
+	// Finished jobs aren't run again.
+	s.Shutdown(context.Background())
+	p = &fakePinner{name: "fake"}
+	if s, err = NewServer(dir, []pinners.Pinner{p}); err != nil {
+		t.Fatal(err)
+	}
+	s.Shutdown(context.Background())
+	if p.Calls() != 0 {
+		t.Errorf("finished job pinned again")
+	}
+}
+
+func TestShutdownDrains(t *testing.T) {
+	release := make(chan struct{})
+	p := &fakePinner{name: "fake", attempt: func(int) error {
+		<-release
+		return nil
+	}}
+	s, err := NewServer(t.TempDir(), []pinners.Pinner{p})
+	if err != nil {
+		t.Fatal(err)
+	}
+	job := submit(t, s, "/uploads", []byte("hello"))
+	for deadline := time.Now().Add(10 * time.Second); p.Calls() == 0; time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("no attempt made")
+		}
+	}
+
+	done := make(chan error)
+	go func() {
+		done <- s.Shutdown(context.Background())
+	}()
+	select {
+	case err := <-done:
+		t.Fatalf("shutdown returned with an upload running: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/uploads", strings.NewReader("late")))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("submit while shutting down: status %d", w.Code)
+	}
+
+	close(release)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if j, _ := s.job(job.ID); j.Status != StatusDone {
+		t.Errorf("drained job is %s", j.Status)
+	}
+}
+
+func TestEvents(t *testing.T) {
+	release := make(chan struct{})
+	p := &fakePinner{name: "fake", attempt: func(int) error {
+		<-release
+		return nil
+	}}
+	s, err := NewServer(t.TempDir(), []pinners.Pinner{p}, AccessToken("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Shutdown(context.Background())
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+
+	req, _ := http.NewRequest(http.MethodPost, srv.URL+"/uploads", strings.NewReader("hello"))
+	req.Header.Set("Authorization", "Bearer secret")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var job Job
+	json.NewDecoder(resp.Body).Decode(&job)
+	resp.Body.Close()
+
+	req, _ = http.NewRequest(http.MethodGet, srv.URL+"/jobs/"+job.ID+"/events", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("content type %q", ct)
+	}
+
+	var once sync.Once
+	var statuses []Status
+	sc := bufio.NewScanner(resp.Body)
+	for sc.Scan() {
+		data, ok := strings.CutPrefix(sc.Text(), "data: ")
+		if !ok {
+			continue
+		}
+		var j Job
+		if err := json.Unmarshal([]byte(data), &j); err != nil {
+			t.Fatal(err)
+		}
+		statuses = append(statuses, j.Status)
+		if j.Results["fake"].Status == StatusRunning {
+			once.Do(func() { close(release) })
+		}
+	}
+	// The stream ends once the job is finished.
+	if len(statuses) < 2 || statuses[len(statuses)-1] != StatusDone {
+		t.Errorf("streamed %v, want the job up to done", statuses)
+	}
+
+	resp, err = http.Get(srv.URL + "/jobs/" + job.ID + "/events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("events without token: status %d", resp.StatusCode)
+	}
+}
+
+// unpinPinner is a fakePinner that can unpin.
+type unpinPinner struct {
+	*fakePinner
+	unpinned []string
+}
+
+func (p *unpinPinner) Unpin(hash string) error {
+	p.unpinned = append(p.unpinned, hash)
+	return nil
+}
+
+func TestUnpin(t *testing.T) {
+	up := &unpinPinner{fakePinner: &fakePinner{name: "up"}}
+	keep := &fakePinner{name: "keep"}
+	s, err := NewServer(t.TempDir(), []pinners.Pinner{up, keep})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Shutdown(context.Background())
+
+	unpin := func(id, query string) *Job {
+		t.Helper()
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/jobs/"+id+"/unpin"+query, nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("unpin: status %d: %s", w.Code, w.Body)
+		}
+		var j Job
+		json.Unmarshal(w.Body.Bytes(), &j)
+		return &j
+	}
+
+	job := waitJob(t, s, submit(t, s, "/uploads", []byte("hello")).ID)
+	j := unpin(job.ID, "")
+	if len(up.unpinned) != 1 || up.unpinned[0] != testCid {
+		t.Errorf("unpinned %v, want %s", up.unpinned, testCid)
+	}
+	if j.Results["up"].Status != StatusUnpinned || j.Results["keep"].Error != "unpin is not supported" {
+		t.Errorf("outcomes %+v %+v", j.Results["up"], j.Results["keep"])
+	}
+	// Still pinned to keep.
+	if j.Status != StatusDone {
+		t.Errorf("job %s, want %s", j.Status, StatusDone)
+	}
+
+	job = waitJob(t, s, submit(t, s, "/uploads?providers=up", []byte("hello")).ID)
+	if j := unpin(job.ID, "?provider=up"); j.Status != StatusUnpinned {
+		t.Errorf("job %s, want %s", j.Status, StatusUnpinned)
+	}
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/jobs/"+job.ID+"/unpin?provider=keep", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("unpin from a provider of another job: status %d", w.Code)
+	}
+
+	// The upload is gone, a retry pins the CID again.
+	w = httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/jobs/"+job.ID+"/retry", nil))
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("retry: status %d: %s", w.Code, w.Body)
+	}
+	if j := waitJob(t, s, job.ID); j.Status != StatusDone || j.Results["up"].Cid != testCid {
+		t.Errorf("retried job %s, outcome %+v", j.Status, j.Results["up"])
+	}
+}
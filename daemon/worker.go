@@ -0,0 +1,356 @@
+package daemon
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/heilart1n/justpin-ipfs/dag"
+	"github.com/heilart1n/justpin-ipfs/file"
+	"github.com/heilart1n/justpin-ipfs/pinners"
+)
+
+// progressInterval is how often the progress of an upload is published.
+const progressInterval = 250 * time.Millisecond
+
+// process runs the job id: its pins that aren't done are made concurrently,
+// then the job is finished from their outcomes.
+func (s *Server) process(id string) {
+	defer s.wg.Done()
+	select {
+	case s.sem <- struct{}{}:
+	case <-s.stop:
+		// Left queued, for the next start.
+		return
+	}
+	defer func() { <-s.sem }()
+
+	s.mu.Lock()
+	j := s.jobs[id]
+	if j == nil || j.Status != StatusQueued {
+		s.mu.Unlock()
+		return
+	}
+	ctx, cancel := context.WithCancel(s.ctx)
+	defer cancel()
+	s.cancels[id] = cancel
+	j.Status = StatusRunning
+	_ = s.update(id)
+	job := j.clone()
+	s.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for _, name := range job.Providers {
+		if job.Results[name].Status == StatusDone {
+			continue
+		}
+		wg.Add(1)
+		go func(name string) {
+			defer wg.Done()
+			s.pinTo(ctx, job, name)
+		}(name)
+	}
+	wg.Wait()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.cancels, id)
+
+	// Pins interrupted by a shutdown, or left waiting for a retry by it,
+	// are resumed at the next start, those interrupted by a cancel are
+	// canceled.
+	canceled := ctx.Err() != nil
+	interrupted := s.ctx.Err() != nil || s.closing && !canceled
+	var pending, failed bool
+	for _, o := range j.Results {
+		switch {
+		case o.Status == StatusDone:
+		case o.Status == StatusFailed:
+			failed = true
+		case interrupted:
+			o.Status, pending = StatusQueued, true
+		default:
+			o.Status, pending = StatusCanceled, true
+		}
+	}
+	switch {
+	case pending && interrupted:
+		j.Status = StatusQueued
+	case pending && canceled:
+		j.Status = StatusCanceled
+	case failed:
+		j.Status = StatusFailed
+	default:
+		j.Status = StatusDone
+	}
+	// An upload is kept for retries until pinned everywhere.
+	if j.Status == StatusDone {
+		os.Remove(s.uploadPath(id))
+	}
+	_ = s.update(id)
+}
+
+// pinTo pins job to the provider name, retrying with a growing backoff
+// until it runs out of retries, ctx is done or the Server shuts down.
+func (s *Server) pinTo(ctx context.Context, job *Job, name string) {
+	p := s.targets[name]
+	for attempt := 1; ; attempt++ {
+		if err := s.limits[name].wait(ctx, s.every); err != nil {
+			return
+		}
+		s.setOutcome(job.ID, name, func(o *Outcome) {
+			o.Status = StatusRunning
+			o.Attempts++
+			o.Sent = 0
+		})
+
+		result, err := s.pin(ctx, job, p)
+		if err == nil && ctx.Err() != nil {
+			// The upload may have been cut short by the interruption, it's
+			// pinned again rather than trusted.
+			return
+		}
+		if err == nil {
+			s.setOutcome(job.ID, name, func(o *Outcome) {
+				// A CID pinned again by hash keeps the link it had.
+				if link := result.GetLink(); link != "" || o.Cid != result.GetHash() {
+					o.Link = link
+				}
+				o.Status = StatusDone
+				o.Cid = result.GetHash()
+				o.Error = ""
+			})
+			return
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		last := attempt > s.retries
+		s.setOutcome(job.ID, name, func(o *Outcome) {
+			o.Error = err.Error()
+			if last {
+				o.Status = StatusFailed
+			}
+		})
+		if last {
+			return
+		}
+
+		backoff := s.backoff << (attempt - 1)
+		if backoff <= 0 || backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+// pin makes one attempt at pinning job to p.
+func (s *Server) pin(ctx context.Context, job *Job, p pinners.Pinner) (pinners.Result, error) {
+	switch job.Kind {
+	case KindPath:
+		return s.pinPath(ctx, p, job.Source)
+	case KindURL:
+		if up, ok := p.(pinners.URLPinner); ok {
+			return up.PinURL(job.Source, 0)
+		}
+		u, err := url.Parse(job.Source)
+		if err != nil {
+			return nil, err
+		}
+		return p.Pin(u)
+	case KindCid:
+		return pinHash(p, job.Source)
+	case KindUpload:
+		f, err := os.Open(s.uploadPath(job.ID))
+		if errors.Is(err, os.ErrNotExist) && job.Results[p.Name()].Cid != "" {
+			// Pinned then unpinned, the upload is gone but its CID isn't.
+			return pinHash(p, job.Results[p.Name()].Cid)
+		}
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		var rd io.Reader = &progressReader{ctx: ctx, r: f, report: func(n int64) {
+			s.setProgress(job.ID, p.Name(), n)
+		}}
+		if job.ContentType != "" {
+			rd = file.WithContentType(rd, job.ContentType)
+		}
+		if np, ok := p.(pinners.NodePinner); ok && job.Name != "" {
+			node, err := file.NewReaderFile(job.Name, rd)
+			if err != nil {
+				return nil, err
+			}
+			return np.PinNode(node)
+		}
+		return p.PinWithReader(rd)
+	}
+	return nil, fmt.Errorf("unknown job kind %q", job.Kind)
+}
+
+// pinPath pins the file or directory of a path job with the walk options
+// of p. The path must resolve under the root and symlinks are only
+// followed within it, so a job can't read anything else.
+func (s *Server) pinPath(ctx context.Context, p pinners.Pinner, source string) (pinners.Result, error) {
+	fp := s.resolve(source)
+	root, err := filepath.EvalSymlinks(s.root)
+	if err != nil {
+		return nil, err
+	}
+	real, err := filepath.EvalSymlinks(fp)
+	if err != nil {
+		return nil, err
+	}
+	if rel, err := filepath.Rel(root, real); err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return nil, fmt.Errorf("path %s points outside of the root", source)
+	}
+
+	var opts []file.Option
+	if wc, ok := p.(pinners.WalkConfigurer); ok {
+		opts = append(opts, wc.WalkOptions()...)
+	}
+	node, err := file.NewSerialFile(fp, append(opts, file.Symlinks(file.SymlinkFollowWithinRoot))...)
+	if err != nil {
+		return nil, err
+	}
+	if np, ok := p.(pinners.NodePinner); ok {
+		return np.PinNode(node)
+	}
+
+	b := dag.NewBuilder()
+	nd, err := b.AddNode(ctx, node)
+	if err != nil {
+		return nil, fmt.Errorf("build dag failed: %v", err)
+	}
+	return b.Pin(ctx, p, nd.Cid())
+}
+
+func pinHash(p pinners.Pinner, hash string) (pinners.Result, error) {
+	ok, err := p.PinHash(hash)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, fmt.Errorf("pin %s failed", hash)
+	}
+	return cidResult(hash), nil
+}
+
+// cidResult is the Result of pinning a CID, which has no link of its own.
+type cidResult string
+
+func (c cidResult) GetHash() string {
+	return string(c)
+}
+
+func (c cidResult) GetLink() string {
+	return ""
+}
+
+// setOutcome applies fn to the outcome of the job id for the provider
+// name and saves it.
+func (s *Server) setOutcome(id, name string, fn func(o *Outcome)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if j := s.jobs[id]; j != nil {
+		fn(j.Results[name])
+		_ = s.update(id)
+	}
+}
+
+// setProgress publishes how much of the upload id the provider name read,
+// without saving it.
+func (s *Server) setProgress(id, name string, n int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if j := s.jobs[id]; j != nil {
+		j.Results[name].Sent = n
+		j.Updated = time.Now().UTC()
+		s.notify()
+	}
+}
+
+// update records a change of the job id: it is saved and the streams are
+// woken up. The caller holds the lock.
+func (s *Server) update(id string) error {
+	if j := s.jobs[id]; j != nil {
+		j.Updated = time.Now().UTC()
+	}
+	s.prune()
+	err := s.save()
+	s.notify()
+	return err
+}
+
+// notify wakes up the streams waiting for a change, the caller holds the
+// lock.
+func (s *Server) notify() {
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
+
+// limiter spaces the requests made to a provider.
+type limiter struct {
+	mu   sync.Mutex
+	next time.Time
+}
+
+// wait blocks until a request can be made, every after the previous one.
+func (l *limiter) wait(ctx context.Context, every time.Duration) error {
+	if every <= 0 {
+		return ctx.Err()
+	}
+	l.mu.Lock()
+	at := l.next
+	if now := time.Now(); at.Before(now) {
+		at = now
+	}
+	l.next = at.Add(every)
+	l.mu.Unlock()
+
+	t := time.NewTimer(time.Until(at))
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// progressReader reports how much was read, at most every
+// progressInterval, and fails once ctx is done so an upload can be
+// interrupted.
+type progressReader struct {
+	ctx    context.Context
+	r      io.Reader
+	n      int64
+	last   time.Time
+	report func(n int64)
+}
+
+func (pr *progressReader) Read(p []byte) (int, error) {
+	if err := pr.ctx.Err(); err != nil {
+		return 0, err
+	}
+	n, err := pr.r.Read(p)
+	pr.n += int64(n)
+	if err != nil || time.Since(pr.last) >= progressInterval {
+		pr.last = time.Now()
+		pr.report(pr.n)
+	}
+	return n, err
+}
@@ -0,0 +1,342 @@
+package daemon
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/heilart1n/justpin-ipfs/config"
+	"github.com/heilart1n/justpin-ipfs/file"
+	"github.com/heilart1n/justpin-ipfs/pinners"
+	"github.com/heilart1n/justpin-ipfs/pinners/nftstorage"
+	"github.com/heilart1n/justpin-ipfs/pinners/pinata"
+)
+
+// redirect sends every request to the test server srv.
+type redirect struct {
+	srv *httptest.Server
+}
+
+func (rt redirect) RoundTrip(req *http.Request) (*http.Response, error) {
+	u, _ := url.Parse(rt.srv.URL)
+	req.URL.Scheme, req.URL.Host = u.Scheme, u.Host
+	return rt.srv.Client().Transport.RoundTrip(req)
+}
+
+func TestCancelUpload(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mr, err := r.MultipartReader()
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		for {
+			part, err := mr.NextPart()
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			if part.FormName() != "file" {
+				continue
+			}
+			// Holds the upload until the job is canceled, then pins
+			// whatever it gets.
+			io.CopyN(io.Discard, part, 1024)
+			close(started)
+			<-release
+			if _, err := io.Copy(io.Discard, part); err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]string{"IpfsHash": "bafkqaaa"})
+			return
+		}
+	}))
+	defer srv.Close()
+
+	pinner := pinata.NewClient(config.NewConfig("key", "secret"), &http.Client{Transport: redirect{srv}})
+	s, err := NewServer(t.TempDir(), []pinners.Pinner{pinner}, Retries(0, time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Shutdown(context.Background())
+
+	w := httptest.NewRecorder()
+	body := bytes.Repeat([]byte("x"), 32<<20)
+	s.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/uploads", bytes.NewReader(body)))
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("submit: status %d: %s", w.Code, w.Body)
+	}
+	var job Job
+	if err := json.Unmarshal(w.Body.Bytes(), &job); err != nil {
+		t.Fatal(err)
+	}
+
+	<-started
+	if _, err := s.cancelJob(job.ID); err != nil {
+		t.Fatal(err)
+	}
+	close(release)
+
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		j, err := s.job(job.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if j.Status.Finished() {
+			if j.Status != StatusCanceled {
+				t.Errorf("job is %s, want %s", j.Status, StatusCanceled)
+			}
+			if o := j.Results[pinner.Name()]; o.Cid != "" {
+				t.Errorf("truncated upload pinned as %s", o.Cid)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("job still %s", j.Status)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if _, err := os.Stat(s.uploadPath(job.ID)); err != nil {
+		t.Errorf("upload removed: %v", err)
+	}
+}
+
+// waitJob returns the job id once finished.
+func waitJob(t *testing.T, s *Server, id string) *Job {
+	t.Helper()
+	for deadline := time.Now().Add(10 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		j, err := s.job(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if j.Status.Finished() {
+			return j
+		}
+	}
+	t.Fatalf("job %s not finished", id)
+	return nil
+}
+
+// submit posts an upload of body to s and returns the job.
+func submit(t *testing.T, s *Server, target string, body []byte) *Job {
+	t.Helper()
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest(http.MethodPost, target, bytes.NewReader(body)))
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("submit: status %d: %s", w.Code, w.Body)
+	}
+	var job Job
+	if err := json.Unmarshal(w.Body.Bytes(), &job); err != nil {
+		t.Fatal(err)
+	}
+	return &job
+}
+
+func TestNamedUploadNFTStorage(t *testing.T) {
+	var got bytes.Buffer
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(&got, r.Body)
+		io.WriteString(w, `{"ok":true,"value":{"cid":"bafkqaaa"}}`)
+	}))
+	defer srv.Close()
+
+	pinner := nftstorage.NewClient(config.NewConfig("key", ""), &http.Client{Transport: redirect{srv}})
+	s, err := NewServer(t.TempDir(), []pinners.Pinner{pinner}, Retries(0, time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Shutdown(context.Background())
+
+	job := submit(t, s, "/uploads?name=hello.txt", []byte("hello, world"))
+	j := waitJob(t, s, job.ID)
+	if o := j.Results[pinner.Name()]; j.Status != StatusDone || o.Cid != "bafkqaaa" {
+		t.Errorf("job %s, outcome %+v", j.Status, o)
+	}
+	if got.String() != "hello, world" {
+		t.Errorf("pinned %q", got.String())
+	}
+}
+
+const testCid = "bafkqaaa"
+
+// fakePinner pins anything as testCid, once attempt allows it. attempt
+// gets the number of the call.
+type fakePinner struct {
+	pinners.Pinner
+	name    string
+	attempt func(n int) error
+
+	mu    sync.Mutex
+	calls int
+	paths []string
+}
+
+func (p *fakePinner) Name() string {
+	return p.name
+}
+
+func (p *fakePinner) pin() (pinners.Result, error) {
+	p.mu.Lock()
+	p.calls++
+	n := p.calls
+	p.mu.Unlock()
+	if p.attempt != nil {
+		if err := p.attempt(n); err != nil {
+			return nil, err
+		}
+	}
+	return cidResult(testCid), nil
+}
+
+func (p *fakePinner) PinWithReader(rd io.Reader) (pinners.Result, error) {
+	if _, err := io.Copy(io.Discard, rd); err != nil {
+		return nil, err
+	}
+	return p.pin()
+}
+
+func (p *fakePinner) PinHash(string) (bool, error) {
+	_, err := p.pin()
+	return err == nil, err
+}
+
+func (p *fakePinner) PinNode(node *file.Node) (pinners.Result, error) {
+	var paths []string
+	err := node.Walk(func(fp string, fi os.FileInfo) error {
+		paths = append(paths, fp)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	p.mu.Lock()
+	p.paths = paths
+	p.mu.Unlock()
+	return p.pin()
+}
+
+func (p *fakePinner) Calls() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.calls
+}
+
+func TestRetries(t *testing.T) {
+	flaky := &fakePinner{name: "flaky", attempt: func(n int) error {
+		if n < 3 {
+			return fmt.Errorf("attempt %d failed", n)
+		}
+		return nil
+	}}
+	broken := &fakePinner{name: "broken", attempt: func(n int) error {
+		return fmt.Errorf("attempt %d failed", n)
+	}}
+	s, err := NewServer(t.TempDir(), []pinners.Pinner{flaky, broken}, Retries(2, time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Shutdown(context.Background())
+
+	job := submit(t, s, "/uploads", []byte("hello"))
+	j := waitJob(t, s, job.ID)
+	if j.Status != StatusFailed {
+		t.Errorf("job %s, want %s", j.Status, StatusFailed)
+	}
+	if o := j.Results["flaky"]; o.Status != StatusDone || o.Attempts != 3 || o.Error != "" || o.Cid != testCid {
+		t.Errorf("flaky: %+v, want done at the third attempt", o)
+	}
+	if o := j.Results["broken"]; o.Status != StatusFailed || o.Attempts != 3 || o.Error != "attempt 3 failed" {
+		t.Errorf("broken: %+v, want failed after 2 retries", o)
+	}
+}
+
+func TestShutdownStopsBackoff(t *testing.T) {
+	dir := t.TempDir()
+	broken := &fakePinner{name: "broken", attempt: func(n int) error {
+		return fmt.Errorf("attempt %d failed", n)
+	}}
+	s, err := NewServer(dir, []pinners.Pinner{broken}, Retries(5, time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	job := submit(t, s, "/uploads", []byte("hello"))
+	for deadline := time.Now().Add(10 * time.Second); broken.Calls() == 0; time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("no attempt made")
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := s.Shutdown(ctx); err != nil {
+		t.Fatalf("shutdown waited for the backoff: %v", err)
+	}
+	j, err := s.job(job.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if o := j.Results["broken"]; j.Status != StatusQueued || o.Status != StatusQueued || o.Attempts != 1 {
+		t.Errorf("job %s, outcome %+v, want both queued for the next start", j.Status, o)
+	}
+}
+
+func TestPathSymlinks(t *testing.T) {
+	root, outside := t.TempDir(), t.TempDir()
+	for _, fp := range []string{
+		filepath.Join(root, "site", "a.txt"),
+		filepath.Join(root, "bad", "a.txt"),
+		filepath.Join(outside, "secret.txt"),
+	} {
+		os.MkdirAll(filepath.Dir(fp), 0o755)
+		if err := os.WriteFile(fp, []byte("x"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for link, target := range map[string]string{
+		filepath.Join(root, "site", "b.txt"): "a.txt",
+		filepath.Join(root, "bad", "secret"): filepath.Join(outside, "secret.txt"),
+		filepath.Join(root, "escape"):        outside,
+	} {
+		if err := os.Symlink(target, link); err != nil {
+			t.Skip(err)
+		}
+	}
+
+	p := &fakePinner{name: "fake"}
+	s, err := NewServer(t.TempDir(), []pinners.Pinner{p}, Root(root), Retries(0, time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Shutdown(context.Background())
+
+	pathJob := func(path string) *Job {
+		t.Helper()
+		body, _ := json.Marshal(Request{Path: path})
+		return waitJob(t, s, submit(t, s, "/jobs", body).ID)
+	}
+
+	if j := pathJob("site"); j.Status != StatusDone || !reflect.DeepEqual(p.paths, []string{"a.txt", "b.txt"}) {
+		t.Errorf("site: job %s, walked %v", j.Status, p.paths)
+	}
+	if o := pathJob("bad").Results["fake"]; o.Status != StatusFailed || !strings.Contains(o.Error, "outside of the root") {
+		t.Errorf("link to outside the directory: %+v", o)
+	}
+	if o := pathJob("escape").Results["fake"]; o.Status != StatusFailed || !strings.Contains(o.Error, "outside of the root") {
+		t.Errorf("path to outside the root: %+v", o)
+	}
+}
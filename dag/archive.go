@@ -0,0 +1,89 @@
+package dag
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/heilart1n/justpin-ipfs/file"
+	"github.com/heilart1n/justpin-ipfs/pinners"
+	ipld "github.com/ipfs/go-ipld-format"
+)
+
+// AddArchive expands a as a UnixFS directory while it is read and returns
+// the root. Directories of the archive are kept, empty or not.
+func (b *Builder) AddArchive(ctx context.Context, a *file.Archive) (ipld.Node, error) {
+	dirs := map[string][]*ipld.Link{"": nil}
+	files := map[string]bool{}
+
+	err := a.Walk(func(name string, fi fs.FileInfo, r io.Reader) error {
+		if files[name] {
+			return fmt.Errorf("duplicate entry in archive: %s", name)
+		}
+		for dir := path.Dir(name); dir != "."; dir = path.Dir(dir) {
+			if files[dir] {
+				return fmt.Errorf("entry %s is below file %s", name, dir)
+			}
+		}
+		if _, ok := dirs[name]; ok && !fi.IsDir() {
+			return fmt.Errorf("entry %s is also a directory", name)
+		}
+
+		if fi.IsDir() {
+			addLink(dirs, name, nil)
+			return nil
+		}
+		files[name] = true
+
+		nd, err := b.AddReader(ctx, r)
+		if err != nil {
+			return fmt.Errorf("import %s failed: %w", name, err)
+		}
+		lnk, err := ipld.MakeLink(nd)
+		if err != nil {
+			return err
+		}
+		dir, base := path.Split(name)
+		lnk.Name = base
+		addLink(dirs, strings.TrimSuffix(dir, "/"), lnk)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return b.buildDirs(ctx, dirs, nil)
+}
+
+// PinArchive expands a and pins the directory. A pinner accepting CARs or
+// blocks gets the DAG, built in a temporary directory rather than memory
+// and removed once pinned. Any other NodePinner gets the files streamed
+// from the archive into its upload, see file.NewArchiveNode.
+func PinArchive(ctx context.Context, p pinners.Pinner, a *file.Archive) (pinners.Result, error) {
+	switch p.(type) {
+	case pinners.CARPinner, pinners.BlockPinner:
+	default:
+		np, ok := p.(pinners.NodePinner)
+		if !ok {
+			return nil, fmt.Errorf("%s: pinning archives is not supported", p.Name())
+		}
+		return np.PinNode(file.NewArchiveNode(a))
+	}
+
+	dir, err := os.MkdirTemp("", "justpin-archive-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	b := NewDiskBuilder(dir)
+	nd, err := b.AddArchive(ctx, a)
+	if err != nil {
+		return nil, err
+	}
+	return b.Pin(ctx, p, nd.Cid())
+}
@@ -0,0 +1,183 @@
+package dag
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"io"
+	"mime"
+	"mime/multipart"
+	"strings"
+	"testing"
+
+	"github.com/heilart1n/justpin-ipfs/file"
+	"github.com/heilart1n/justpin-ipfs/pinners"
+	"github.com/ipfs/go-cid"
+)
+
+// testTar returns a tar holding a directory, a file and, with link set, a
+// symlink.
+func testTar(t *testing.T, link bool) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	headers := []*tar.Header{
+		{Name: "site/", Typeflag: tar.TypeDir, Mode: 0o755},
+		{Name: "site/index.html", Typeflag: tar.TypeReg, Mode: 0o644, Size: 5},
+	}
+	if link {
+		headers = append(headers, &tar.Header{Name: "site/home.html", Typeflag: tar.TypeSymlink, Linkname: "index.html"})
+	}
+	for _, hdr := range headers {
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		if hdr.Typeflag == tar.TypeReg {
+			tw.Write([]byte("hello"))
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestArchiveLinks(t *testing.T) {
+	ctx := context.Background()
+	data := testTar(t, true)
+
+	if _, err := NewBuilder().AddArchive(ctx, file.NewArchive(bytes.NewReader(data))); err == nil || !strings.Contains(err.Error(), "site/home.html") {
+		t.Errorf("AddArchive with a link = %v, want an error naming it", err)
+	}
+
+	a := file.NewArchive(bytes.NewReader(data))
+	a.SkipLinks = true
+	got, err := NewBuilder().AddArchive(ctx, a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := NewBuilder().AddArchive(ctx, file.NewArchive(bytes.NewReader(testTar(t, false))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Cid() != want.Cid() {
+		t.Errorf("skipped links gave %s, want %s", got.Cid(), want.Cid())
+	}
+}
+
+func TestDiskBuilder(t *testing.T) {
+	ctx := context.Background()
+	data := testTar(t, false)
+
+	mem, err := NewBuilder().AddArchive(ctx, file.NewArchive(bytes.NewReader(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := NewDiskBuilder(t.TempDir())
+	disk, err := b.AddArchive(ctx, file.NewArchive(bytes.NewReader(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mem.Cid() != disk.Cid() {
+		t.Fatalf("disk builder gave %s, want %s", disk.Cid(), mem.Cid())
+	}
+
+	var car bytes.Buffer
+	if err := b.WriteCAR(ctx, &car, disk.Cid()); err != nil {
+		t.Fatal(err)
+	}
+	count, err := b.Blocks(ctx, disk.Cid())
+	if err != nil {
+		t.Fatal(err)
+	}
+	blocks := 0
+	if _, err := ReadCAR(&car, func(c cid.Cid, data []byte) error {
+		blocks++
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if blocks != count {
+		t.Errorf("CAR has %d blocks, want %d", blocks, count)
+	}
+}
+
+// countingReader counts the bytes read from r.
+type countingReader struct {
+	r io.Reader
+	n int
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += n
+	return n, err
+}
+
+// formPinner pins Nodes by reading them as a multipart form, noting how
+// much of src was read when each file part started.
+type formPinner struct {
+	pinners.Pinner
+	src   *countingReader
+	files map[string]string
+	read  map[string]int
+}
+
+func (p *formPinner) PinNode(node *file.Node) (pinners.Result, error) {
+	mfr, err := file.NewMultiForm(node, file.Form{FileField: "file"})
+	if err != nil {
+		return nil, err
+	}
+	mr := multipart.NewReader(mfr, mfr.Boundary())
+	p.files, p.read = map[string]string{}, map[string]int{}
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			return cidResult(""), nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		// FileName drops the directories
+		_, params, _ := mime.ParseMediaType(part.Header.Get("Content-Disposition"))
+		name := params["filename"]
+		p.read[name] = p.src.n
+		data, err := io.ReadAll(part)
+		if err != nil {
+			return nil, err
+		}
+		p.files[name] = string(data)
+	}
+}
+
+func TestPinArchiveStreams(t *testing.T) {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	big := strings.Repeat("x", 1<<20)
+	for _, f := range []struct{ name, content string }{{"a.txt", "hello"}, {"sub/big.bin", big}} {
+		tw.WriteHeader(&tar.Header{Name: f.name, Typeflag: tar.TypeReg, Mode: 0o644, Size: int64(len(f.content))})
+		tw.Write([]byte(f.content))
+	}
+	tw.Close()
+
+	src := &countingReader{r: &buf}
+	p := &formPinner{src: src}
+	if _, err := PinArchive(context.Background(), p, file.NewArchive(src)); err != nil {
+		t.Fatal(err)
+	}
+	if len(p.files) != 2 || p.files["a.txt"] != "hello" || p.files["sub/big.bin"] != big {
+		t.Errorf("uploaded %d files, want a.txt and sub/big.bin", len(p.files))
+	}
+	if p.read["a.txt"] >= len(big) {
+		t.Errorf("%d bytes of the archive read before the first file, want it streamed", p.read["a.txt"])
+	}
+
+	// The archive is read once, so is the Node.
+	node := file.NewArchiveNode(file.NewArchive(bytes.NewReader(testTar(t, false))))
+	if _, err := p.PinNode(node); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.PinNode(node); err == nil {
+		t.Error("second upload of an archive Node didn't fail")
+	}
+}
@@ -0,0 +1,69 @@
+package dag
+
+import (
+	"context"
+	"encoding/binary"
+
+	"github.com/heilart1n/justpin-ipfs/file"
+	"github.com/ipfs/boxo/ipld/merkledag"
+	ft "github.com/ipfs/boxo/ipld/unixfs"
+	ipld "github.com/ipfs/go-ipld-format"
+)
+
+// UnixFS 1.5 fields of the Data message, after every field boxo knows.
+const (
+	modeTag  = 7<<3 | 0 // uint32 mode
+	mtimeTag = 8<<3 | 2 // UnixTime mtime
+)
+
+// withAttributes stores nd again with attrs in its UnixFS data. A raw leaf
+// can't carry metadata, it becomes a file node with the data inline, as
+// Kubo does for small files added with `--preserve-mode`.
+func (b *Builder) withAttributes(ctx context.Context, nd ipld.Node, attrs file.Attributes) (ipld.Node, error) {
+	if attrs.IsZero() {
+		return nd, nil
+	}
+
+	var pn *merkledag.ProtoNode
+	switch v := nd.(type) {
+	case *merkledag.ProtoNode:
+		pn = v.Copy().(*merkledag.ProtoNode)
+	case *merkledag.RawNode:
+		data := v.RawData()
+		pn = merkledag.NodeWithData(ft.FilePBData(data, uint64(len(data))))
+	default:
+		return nd, nil
+	}
+
+	pn.SetData(appendAttributes(pn.Data(), attrs))
+	if err := pn.SetCidBuilder(b.cidBuilder); err != nil {
+		return nil, err
+	}
+	if err := b.dserv.Add(ctx, pn); err != nil {
+		return nil, err
+	}
+	return pn, nil
+}
+
+// appendAttributes encodes attrs after the fields of a UnixFS Data message,
+// which keeps the fields in order since mode and mtime come last.
+func appendAttributes(data []byte, attrs file.Attributes) []byte {
+	out := append([]byte(nil), data...)
+	if attrs.HasMode {
+		out = binary.AppendUvarint(out, modeTag)
+		out = binary.AppendUvarint(out, uint64(attrs.UnixMode()))
+	}
+	if !attrs.Mtime.IsZero() {
+		var mtime []byte
+		mtime = binary.AppendUvarint(mtime, 1<<3|0) // int64 Seconds
+		mtime = binary.AppendUvarint(mtime, uint64(attrs.Mtime.Unix()))
+		if nsecs := attrs.Mtime.Nanosecond(); nsecs != 0 {
+			mtime = binary.AppendUvarint(mtime, 2<<3|5) // fixed32 FractionalNanoseconds
+			mtime = binary.LittleEndian.AppendUint32(mtime, uint32(nsecs))
+		}
+		out = binary.AppendUvarint(out, mtimeTag)
+		out = binary.AppendUvarint(out, uint64(len(mtime)))
+		out = append(out, mtime...)
+	}
+	return out
+}
@@ -0,0 +1,153 @@
+package dag
+
+import (
+	"context"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/heilart1n/justpin-ipfs/file"
+	"github.com/ipfs/boxo/ipld/merkledag"
+	ft "github.com/ipfs/boxo/ipld/unixfs"
+	ipld "github.com/ipfs/go-ipld-format"
+)
+
+// readAttributes decodes the UnixFS 1.5 mode and mtime of nd.
+func readAttributes(t *testing.T, nd ipld.Node) (attrs file.Attributes) {
+	t.Helper()
+	pn, ok := nd.(*merkledag.ProtoNode)
+	if !ok {
+		t.Fatalf("%s is not a dag-pb node", nd.Cid())
+	}
+	data := pn.Data()
+	for len(data) > 0 {
+		tag, n := binary.Uvarint(data)
+		data = data[n:]
+		switch tag & 7 {
+		case 0:
+			v, n := binary.Uvarint(data)
+			data = data[n:]
+			if tag == modeTag {
+				attrs.Mode, attrs.HasMode = os.FileMode(v), true
+			}
+		case 2:
+			size, n := binary.Uvarint(data)
+			field := data[n : n+int(size)]
+			data = data[n+int(size):]
+			if tag != mtimeTag {
+				continue
+			}
+			var secs uint64
+			var nsecs uint32
+			for len(field) > 0 {
+				switch field[0] {
+				case 1<<3 | 0:
+					secs, n = binary.Uvarint(field[1:])
+					field = field[1+n:]
+				case 2<<3 | 5:
+					nsecs = binary.LittleEndian.Uint32(field[1:])
+					field = field[5:]
+				default:
+					t.Fatalf("unexpected mtime field %#x", field[0])
+				}
+			}
+			attrs.Mtime = time.Unix(int64(secs), int64(nsecs))
+		default:
+			t.Fatalf("unexpected wire type of tag %#x", tag)
+		}
+	}
+	return attrs
+}
+
+func TestAttributesRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	mtime := time.Unix(1700000000, 123456789)
+	for _, f := range []struct {
+		name string
+		mode os.FileMode
+	}{{"sub", 0o750}, {"sub/a.txt", 0o640}, {"b.txt", 0o604}} {
+		name, mode := f.name, f.mode
+		fp := filepath.Join(dir, filepath.FromSlash(name))
+		var err error
+		if strings.HasSuffix(name, ".txt") {
+			err = os.WriteFile(fp, []byte(name), 0o600)
+		} else {
+			err = os.Mkdir(fp, 0o700)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chmod(fp, mode); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, name := range []string{"sub/a.txt", "b.txt", "sub"} {
+		if err := os.Chtimes(filepath.Join(dir, name), mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	node, err := file.NewSerialFile(dir, file.PreserveMode(), file.PreserveMtime())
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := NewBuilder()
+	root, err := b.AddNode(ctx, node)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	get := func(p string) ipld.Node {
+		nd := root
+		for _, name := range strings.Split(p, "/") {
+			lnk, _, err := nd.ResolveLink([]string{name})
+			if err != nil {
+				t.Fatalf("%s: %v", p, err)
+			}
+			if nd, err = b.dserv.Get(ctx, lnk.Cid); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return nd
+	}
+	for name, mode := range map[string]os.FileMode{"sub": 0o750, "sub/a.txt": 0o640, "b.txt": 0o604} {
+		attrs := readAttributes(t, get(name))
+		if !attrs.HasMode || attrs.Mode != mode {
+			t.Errorf("%s: mode %o (%v), want %o", name, attrs.Mode, attrs.HasMode, mode)
+		}
+		if !attrs.Mtime.Equal(mtime) {
+			t.Errorf("%s: mtime %v, want %v", name, attrs.Mtime, mtime)
+		}
+	}
+
+	// A file keeps its content next to the metadata.
+	fsn, err := ft.ExtractFSNode(get("b.txt"))
+	if err != nil || string(fsn.Data()) != "b.txt" {
+		t.Errorf("b.txt: data %q (%v)", fsn.Data(), err)
+	}
+}
+
+func TestAttributesModeZero(t *testing.T) {
+	ctx := context.Background()
+	b := NewBuilder()
+	leaf, err := b.AddReader(ctx, strings.NewReader("locked"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	nd, err := b.withAttributes(ctx, leaf, file.Attributes{HasMode: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if attrs := readAttributes(t, nd); !attrs.HasMode || attrs.Mode != 0 {
+		t.Errorf("mode %o (%v), want an explicit 0000", attrs.Mode, attrs.HasMode)
+	}
+
+	if nd, err = b.withAttributes(ctx, leaf, file.Attributes{}); err != nil || !nd.Cid().Equals(leaf.Cid()) {
+		t.Errorf("no attributes: %s (%v), want the leaf as is", nd.Cid(), err)
+	}
+}
@@ -0,0 +1,121 @@
+package dag
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ipfs/boxo/blockservice"
+	"github.com/ipfs/boxo/blockstore"
+	"github.com/ipfs/boxo/exchange/offline"
+	"github.com/ipfs/boxo/ipld/merkledag"
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	ipld "github.com/ipfs/go-ipld-format"
+)
+
+// Builder assembles UnixFS DAGs locally in a blockstore in memory, or on
+// disk with NewDiskBuilder. Nothing leaves the process until the blocks are
+// exported as a CAR or pinned.
+type Builder struct {
+	bstore     blockstore.Blockstore
+	dserv      ipld.DAGService
+	cidBuilder cid.Builder
+	fetcher    Fetcher
+
+	shardThreshold int
+	discardLeaves  bool
+}
+
+// NewBuilder returns a Builder producing CIDv1 dag-pb nodes, the same as
+// the pinning services configured with `cid-version=1`.
+func NewBuilder() *Builder {
+	return newBuilder(blockstore.NewBlockstore(dssync.MutexWrap(datastore.NewMapDatastore())))
+}
+
+// NewDiskBuilder returns a Builder like NewBuilder that keeps its blocks in
+// files under dir instead of memory, for content larger than the memory it
+// may use. The caller creates dir and removes it once done.
+func NewDiskBuilder(dir string) *Builder {
+	return newBuilder(&diskBlockstore{dir: dir})
+}
+
+func newBuilder(bs blockstore.Blockstore) *Builder {
+	b := &Builder{
+		bstore:     bs,
+		cidBuilder: merkledag.V1CidPrefix(),
+	}
+	b.dserv = &fetchingDAG{
+		DAGService: merkledag.NewDAGService(blockservice.New(bs, offline.Exchange(bs))),
+		builder:    b,
+		fetched:    make(map[cid.Cid]ipld.Node),
+	}
+	return b
+}
+
+// SetFetcher sets where the Builder loads existing content from, it is
+// needed when editing directories that were pinned before.
+func (b *Builder) SetFetcher(f Fetcher) {
+	b.fetcher = f
+}
+
+// SetDiscardLeaves makes the Builder drop raw leaf blocks instead of storing
+// them, so computing CIDs of large trees needs little memory. The DAG can't
+// be exported or pinned afterwards.
+func (b *Builder) SetDiscardLeaves(discard bool) {
+	b.discardLeaves = discard
+}
+
+// DAGService returns the DAGService the Builder stores its nodes in.
+func (b *Builder) DAGService() ipld.DAGService {
+	return b.dserv
+}
+
+// Has reports whether the block of c is held locally.
+func (b *Builder) Has(ctx context.Context, c cid.Cid) (bool, error) {
+	return b.bstore.Has(ctx, c)
+}
+
+// Blocks returns the number of blocks reachable from root that are held
+// locally. Links to blocks that were never added to the Builder are skipped.
+func (b *Builder) Blocks(ctx context.Context, root cid.Cid) (count int, err error) {
+	err = b.walk(ctx, root, func(ipld.Node) error {
+		count++
+		return nil
+	})
+	return count, err
+}
+
+// walk visits every local node reachable from root once, parents first.
+func (b *Builder) walk(ctx context.Context, root cid.Cid, fn func(ipld.Node) error) error {
+	seen := cid.NewSet()
+
+	var visit func(c cid.Cid) error
+	visit = func(c cid.Cid) error {
+		if !seen.Visit(c) {
+			return nil
+		}
+		has, err := b.bstore.Has(ctx, c)
+		if err != nil {
+			return err
+		}
+		if !has {
+			return nil
+		}
+		nd, err := b.dserv.Get(ctx, c)
+		if err != nil {
+			return fmt.Errorf("load node %s failed: %v", c, err)
+		}
+		if err := fn(nd); err != nil {
+			return err
+		}
+		for _, lnk := range nd.Links() {
+			if err := visit(lnk.Cid); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	return visit(root)
+}
@@ -0,0 +1,195 @@
+package dag
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/ipfs/go-cid"
+	ipld "github.com/ipfs/go-ipld-format"
+)
+
+// WriteCAR exports the blocks reachable from root as a CARv1 stream. Only
+// blocks held by the Builder are written, links to content that is already
+// pinned elsewhere stay as plain references, which leaves a partial DAG that
+// the pinning services accept.
+func (b *Builder) WriteCAR(ctx context.Context, w io.Writer, root cid.Cid) error {
+	bw := bufio.NewWriter(w)
+
+	if err := writeSection(bw, carHeader(root)); err != nil {
+		return fmt.Errorf("write car header failed: %v", err)
+	}
+
+	err := b.walk(ctx, root, func(nd ipld.Node) error {
+		return writeSection(bw, nd.Cid().Bytes(), nd.RawData())
+	})
+	if err != nil {
+		return fmt.Errorf("write car blocks failed: %v", err)
+	}
+
+	return bw.Flush()
+}
+
+// CARReader streams WriteCAR through a pipe so it can be used as a request
+// body. The CAR is written once the reader is read, and GetBody writes it
+// again from the start, so retried requests don't buffer it in memory.
+func (b *Builder) CARReader(ctx context.Context, root cid.Cid) io.ReadCloser {
+	r, w := io.Pipe()
+	return &carReader{PipeReader: r, w: w, b: b, ctx: ctx, root: root}
+}
+
+type carReader struct {
+	*io.PipeReader
+	w     *io.PipeWriter
+	start sync.Once
+
+	b    *Builder
+	ctx  context.Context
+	root cid.Cid
+}
+
+func (r *carReader) Read(p []byte) (int, error) {
+	r.start.Do(func() {
+		go func() {
+			r.w.CloseWithError(r.b.WriteCAR(r.ctx, r.w, r.root))
+		}()
+	})
+	return r.PipeReader.Read(p)
+}
+
+// GetBody returns a new reader of the same CAR.
+func (r *carReader) GetBody() (io.ReadCloser, error) {
+	return r.b.CARReader(r.ctx, r.root), nil
+}
+
+// ReadCAR reads a CARv1 stream, it returns the roots from the header and
+// calls fn for every block in order.
+func ReadCAR(r io.Reader, fn func(c cid.Cid, data []byte) error) ([]cid.Cid, error) {
+	br := bufio.NewReader(r)
+
+	hdr, err := readSection(br)
+	if err != nil {
+		return nil, fmt.Errorf("read car header failed: %v", err)
+	}
+	roots, err := carRoots(hdr)
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		section, err := readSection(br)
+		if err == io.EOF {
+			return roots, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("read car block failed: %v", err)
+		}
+		n, c, err := cid.CidFromBytes(section)
+		if err != nil {
+			return nil, fmt.Errorf("read car block failed: %v", err)
+		}
+		if fn != nil {
+			if err := fn(c, section[n:]); err != nil {
+				return nil, err
+			}
+		}
+	}
+}
+
+// readSection reads a varint length prefixed section.
+func readSection(br *bufio.Reader) ([]byte, error) {
+	size, err := binary.ReadUvarint(br)
+	if err != nil {
+		return nil, err
+	}
+	if size > maxBlockSize+1024 {
+		return nil, fmt.Errorf("section of %d bytes is too large", size)
+	}
+	buf := make([]byte, size)
+	if _, err := io.ReadFull(br, buf); err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
+
+// carRoots extracts the tag(42) links of a CAR header. The header only holds
+// the roots and the version, so looking for the tags is enough.
+func carRoots(hdr []byte) (roots []cid.Cid, err error) {
+	for i := 0; i+3 < len(hdr); i++ {
+		if hdr[i] != 0xd8 || hdr[i+1] != 0x2a || hdr[i+2] < 0x40 || hdr[i+2] > 0x59 {
+			continue
+		}
+		start, size := i+3, int(hdr[i+2]&0x1f)
+		switch hdr[i+2] {
+		case 0x58:
+			start, size = i+4, int(hdr[i+3])
+		case 0x59:
+			if i+4 >= len(hdr) {
+				return nil, fmt.Errorf("invalid car header")
+			}
+			start, size = i+5, int(hdr[i+3])<<8|int(hdr[i+4])
+		}
+		if start+size > len(hdr) || size < 2 || hdr[start] != 0x00 {
+			return nil, fmt.Errorf("invalid car header")
+		}
+		c, err := cid.Cast(hdr[start+1 : start+size])
+		if err != nil {
+			return nil, fmt.Errorf("invalid car root: %v", err)
+		}
+		roots = append(roots, c)
+		i = start + size - 1
+	}
+	if len(roots) == 0 {
+		return nil, fmt.Errorf("car header has no roots")
+	}
+	return roots, nil
+}
+
+// writeSection writes a varint length prefix followed by the given chunks.
+func writeSection(w io.Writer, chunks ...[]byte) error {
+	var size int
+	for _, c := range chunks {
+		size += len(c)
+	}
+
+	buf := make([]byte, binary.MaxVarintLen64)
+	n := binary.PutUvarint(buf, uint64(size))
+	if _, err := w.Write(buf[:n]); err != nil {
+		return err
+	}
+	for _, c := range chunks {
+		if _, err := w.Write(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// carHeader encodes the dag-cbor header `{"roots": [root], "version": 1}`.
+// It is small and fixed enough that pulling in a CBOR codec isn't worth it.
+func carHeader(root cid.Cid) []byte {
+	link := append([]byte{0x00}, root.Bytes()...) // multibase identity prefix
+
+	hdr := []byte{0xa2}                              // map(2)
+	hdr = append(hdr, 0x65, 'r', 'o', 'o', 't', 's') // text(5) "roots"
+	hdr = append(hdr, 0x81, 0xd8, 0x2a)              // array(1), tag(42)
+	hdr = append(hdr, cborBytesHead(len(link))...)
+	hdr = append(hdr, link...)
+	hdr = append(hdr, 0x67, 'v', 'e', 'r', 's', 'i', 'o', 'n') // text(7) "version"
+	hdr = append(hdr, 0x01)                                    // uint(1)
+	return hdr
+}
+
+func cborBytesHead(n int) []byte {
+	switch {
+	case n < 24:
+		return []byte{0x40 | byte(n)}
+	case n < 1<<8:
+		return []byte{0x58, byte(n)}
+	default:
+		return []byte{0x59, byte(n >> 8), byte(n)}
+	}
+}
@@ -0,0 +1,80 @@
+package dag
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/heilart1n/justpin-ipfs/pinners"
+	"github.com/ipfs/boxo/ipld/merkledag"
+	ft "github.com/ipfs/boxo/ipld/unixfs"
+	"github.com/ipfs/go-cid"
+	ipld "github.com/ipfs/go-ipld-format"
+)
+
+// Part is an existing UnixFS file, or raw block, and the size of its content.
+type Part struct {
+	Cid  cid.Cid
+	Size uint64
+}
+
+// Concat builds a UnixFS file whose content is the parts one after the
+// other. Like Directory, the parts are referenced only, the new root is the
+// only block that gets stored, and the root block of every part is read,
+// locally or through the Builder's Fetcher, for the cumulative size of its
+// link.
+func (b *Builder) Concat(ctx context.Context, parts []Part) (ipld.Node, error) {
+	if len(parts) == 0 {
+		return nil, fmt.Errorf("no parts")
+	}
+	for i, part := range parts {
+		if !part.Cid.Defined() {
+			return nil, fmt.Errorf("undefined cid for part %d", i)
+		}
+	}
+
+	fsn := ft.NewFSNode(ft.TFile)
+	nd := new(merkledag.ProtoNode)
+	if err := nd.SetCidBuilder(b.cidBuilder); err != nil {
+		return nil, err
+	}
+	links := make([]*ipld.Link, len(parts))
+	for i, part := range parts {
+		links[i] = &ipld.Link{Cid: part.Cid}
+	}
+	if err := b.setLinkSizes(ctx, links); err != nil {
+		return nil, err
+	}
+	for i, part := range parts {
+		fsn.AddBlockSize(part.Size)
+		if err := nd.AddRawLink("", links[i]); err != nil {
+			return nil, err
+		}
+	}
+	data, err := fsn.GetBytes()
+	if err != nil {
+		return nil, err
+	}
+	nd.SetData(data)
+
+	if err := b.dserv.Add(ctx, nd); err != nil {
+		return nil, err
+	}
+	return nd, nil
+}
+
+// PinConcat builds the file of the already pinned parts, see Concat, and
+// pins the new root block only. The root blocks of the parts are read from
+// DefaultGateway, so it fails with an OfflinePinner.
+func PinConcat(ctx context.Context, p pinners.Pinner, parts []Part) (pinners.Result, error) {
+	fetcher, err := defaultFetcher(p)
+	if err != nil {
+		return nil, err
+	}
+	b := NewBuilder()
+	b.SetFetcher(fetcher)
+	nd, err := b.Concat(ctx, parts)
+	if err != nil {
+		return nil, err
+	}
+	return b.Pin(ctx, p, nd.Cid())
+}
@@ -0,0 +1,56 @@
+package dag
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	uio "github.com/ipfs/boxo/ipld/unixfs/io"
+)
+
+func TestConcatLinkSizes(t *testing.T) {
+	ctx := context.Background()
+	contents := []string{strings.Repeat("a", 1<<20), "tail"}
+
+	tree := NewBuilder()
+	var parts []Part
+	var want []uint64
+	for _, content := range contents {
+		nd, err := tree.AddReader(ctx, strings.NewReader(content))
+		if err != nil {
+			t.Fatal(err)
+		}
+		size, err := nd.Size()
+		if err != nil {
+			t.Fatal(err)
+		}
+		parts = append(parts, Part{Cid: nd.Cid(), Size: uint64(len(content))})
+		want = append(want, size)
+	}
+
+	// The parts are only known to the Builder through its Fetcher.
+	b := NewBuilder()
+	b.SetFetcher(builderFetcher{tree})
+	nd, err := b.Concat(ctx, parts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, lnk := range nd.Links() {
+		if lnk.Size != want[i] {
+			t.Errorf("link %d has size %d, want the cumulative size %d", i, lnk.Size, want[i])
+		}
+	}
+
+	fr, err := uio.NewDagReader(ctx, nd, b.dserv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := io.ReadAll(fr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != strings.Join(contents, "") {
+		t.Errorf("read %d bytes, want the parts one after the other", len(data))
+	}
+}
@@ -0,0 +1,163 @@
+package dag
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	ft "github.com/ipfs/boxo/ipld/unixfs"
+	"github.com/ipfs/boxo/ipld/unixfs/hamt"
+	uio "github.com/ipfs/boxo/ipld/unixfs/io"
+	"github.com/ipfs/go-cid"
+	ipld "github.com/ipfs/go-ipld-format"
+)
+
+// Directory builds a UnixFS directory whose entries point to existing CIDs.
+// The children are referenced only, their blocks don't need to be present
+// locally, so the new directory node is the only block that gets stored.
+// The root block of every child is still read, locally or through the
+// Builder's Fetcher, for the cumulative size recorded in its link, so the
+// directory gets the same CID as in Kubo.
+func (b *Builder) Directory(ctx context.Context, entries map[string]cid.Cid) (ipld.Node, error) {
+	links := make([]*ipld.Link, 0, len(entries))
+	for name, c := range entries {
+		if err := validName(name); err != nil {
+			return nil, err
+		}
+		if !c.Defined() {
+			return nil, fmt.Errorf("undefined cid for entry %q", name)
+		}
+		links = append(links, &ipld.Link{Name: name, Cid: c})
+	}
+	if err := b.setLinkSizes(ctx, links); err != nil {
+		return nil, err
+	}
+
+	return b.directoryFromLinks(ctx, links)
+}
+
+// sizeWorkers bounds the root blocks read at once by setLinkSizes.
+const sizeWorkers = 8
+
+// setLinkSizes sets the Size of the links to the cumulative size of the DAG
+// they point to.
+func (b *Builder) setLinkSizes(ctx context.Context, links []*ipld.Link) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		firstErr error
+	)
+	queue := make(chan *ipld.Link)
+	for i := 0; i < sizeWorkers && i < len(links); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for lnk := range queue {
+				size, err := b.cumulativeSize(ctx, lnk.Cid)
+				if err != nil {
+					mu.Lock()
+					if firstErr == nil {
+						firstErr = fmt.Errorf("entry %q: %v", lnk.Name, err)
+					}
+					mu.Unlock()
+					cancel()
+					continue
+				}
+				lnk.Size = size
+			}
+		}()
+	}
+	for _, lnk := range links {
+		queue <- lnk
+	}
+	close(queue)
+	wg.Wait()
+	return firstErr
+}
+
+// cumulativeSize returns the size of the DAG at c as Kubo records it in
+// links: the size of the root block plus the sizes in the root's links.
+func (b *Builder) cumulativeSize(ctx context.Context, c cid.Cid) (uint64, error) {
+	nd, err := b.dserv.Get(ctx, c)
+	if err != nil {
+		return 0, fmt.Errorf("read block %s failed: %v", c, err)
+	}
+	return nd.Size()
+}
+
+func (b *Builder) directoryFromLinks(ctx context.Context, links []*ipld.Link) (ipld.Node, error) {
+	return b.makeDir(ctx, links, b.cidBuilder)
+}
+
+// makeDir stores a directory holding links, sharded when it crosses the
+// Builder's threshold.
+func (b *Builder) makeDir(ctx context.Context, links []*ipld.Link, builder cid.Builder) (ipld.Node, error) {
+	if b.shouldShard(links) {
+		shard, err := hamt.NewShard(b.dserv, uio.DefaultShardWidth)
+		if err != nil {
+			return nil, err
+		}
+		shard.SetCidBuilder(builder)
+		for _, lnk := range links {
+			if err := shard.SetLink(ctx, lnk.Name, lnk); err != nil {
+				return nil, fmt.Errorf("add link %q failed: %v", lnk.Name, err)
+			}
+		}
+		return shard.Node()
+	}
+
+	nd := ft.EmptyDirNode()
+	if err := nd.SetCidBuilder(builder); err != nil {
+		return nil, err
+	}
+	for _, lnk := range links {
+		if err := nd.AddRawLink(lnk.Name, lnk); err != nil {
+			return nil, fmt.Errorf("add link %q failed: %v", lnk.Name, err)
+		}
+	}
+
+	if err := b.dserv.Add(ctx, nd); err != nil {
+		return nil, err
+	}
+	return nd, nil
+}
+
+// SetShardThreshold sets when directories are built as HAMT shards. With
+// the default of zero it follows Kubo: a directory is sharded once its
+// estimated block size reaches uio.HAMTShardingSize (256 KiB), so the CIDs
+// match `ipfs add`. A positive value shards any directory with more entries
+// than that, a negative one disables sharding.
+func (b *Builder) SetShardThreshold(entries int) {
+	b.shardThreshold = entries
+}
+
+func (b *Builder) shouldShard(links []*ipld.Link) bool {
+	switch {
+	case b.shardThreshold > 0:
+		return len(links) > b.shardThreshold
+	case b.shardThreshold < 0 || uio.HAMTShardingSize == 0:
+		return false
+	}
+
+	// Same estimate as uio.BasicDirectory: link name plus CID length.
+	var size int
+	for _, lnk := range links {
+		size += len(lnk.Name) + lnk.Cid.ByteLen()
+	}
+	return size >= uio.HAMTShardingSize
+}
+
+// validName checks that name can be used as a single directory entry.
+func validName(name string) error {
+	switch {
+	case name == "", name == ".", name == "..":
+		return fmt.Errorf("invalid entry name: %q", name)
+	case strings.Contains(name, "/"):
+		return fmt.Errorf("entry name must not contain '/': %q", name)
+	}
+	return nil
+}
@@ -0,0 +1,212 @@
+package dag
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	chunker "github.com/ipfs/boxo/chunker"
+	"github.com/ipfs/boxo/ipld/merkledag"
+	ft "github.com/ipfs/boxo/ipld/unixfs"
+	"github.com/ipfs/boxo/ipld/unixfs/importer/balanced"
+	"github.com/ipfs/boxo/ipld/unixfs/importer/helpers"
+	uio "github.com/ipfs/boxo/ipld/unixfs/io"
+	"github.com/ipfs/go-cid"
+	ipld "github.com/ipfs/go-ipld-format"
+)
+
+// builderFetcher loads blocks from another Builder, as a gateway would.
+type builderFetcher struct {
+	b *Builder
+}
+
+func (f builderFetcher) Fetch(ctx context.Context, c cid.Cid) ([]byte, error) {
+	blk, err := f.b.bstore.Get(ctx, c)
+	if err != nil {
+		return nil, err
+	}
+	return blk.RawData(), nil
+}
+
+// addFile imports content the way `ipfs add --cid-version=1` does.
+func addFile(t *testing.T, b *Builder, content string) ipld.Node {
+	t.Helper()
+	params := helpers.DagBuilderParams{
+		Dagserv:    b.DAGService(),
+		Maxlinks:   helpers.DefaultLinksPerBlock,
+		RawLeaves:  true,
+		CidBuilder: merkledag.V1CidPrefix(),
+	}
+	db, err := params.New(chunker.NewSizeSplitter(strings.NewReader(content), chunker.DefaultBlockSize))
+	if err != nil {
+		t.Fatal(err)
+	}
+	nd, err := balanced.Layout(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return nd
+}
+
+func TestDirectoryMatchesTree(t *testing.T) {
+	ctx := context.Background()
+	files := map[string]string{
+		"hello.txt": "hello world",
+		"big.bin":   strings.Repeat("0123456789", 100_000),
+	}
+	tree := NewBuilder()
+	dir := uio.NewDirectory(tree.DAGService())
+	dir.SetCidBuilder(merkledag.V1CidPrefix())
+	entries := map[string]cid.Cid{}
+	for name, content := range files {
+		nd := addFile(t, tree, content)
+		if err := dir.AddChild(ctx, name, nd); err != nil {
+			t.Fatal(err)
+		}
+		entries[name] = nd.Cid()
+	}
+	want, err := dir.GetNode()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The entries are only known to the Builder through its Fetcher.
+	b := NewBuilder()
+	b.SetFetcher(builderFetcher{tree})
+	got, err := b.Directory(ctx, entries)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.Cid().Equals(want.Cid()) {
+		t.Errorf("directory %s, want %s as built from the tree", got.Cid(), want.Cid())
+	}
+	if n, err := b.Blocks(ctx, got.Cid()); err != nil || n != 1 {
+		t.Errorf("%d blocks held (%v), want the directory only", n, err)
+	}
+
+	if _, err := NewBuilder().Directory(ctx, entries); err == nil {
+		t.Error("unknown entries: no error")
+	}
+}
+
+func TestCARReaderGetBody(t *testing.T) {
+	ctx := context.Background()
+	b := NewBuilder()
+	nd := addFile(t, b, strings.Repeat("x", 1<<20))
+
+	var want bytes.Buffer
+	if err := b.WriteCAR(ctx, &want, nd.Cid()); err != nil {
+		t.Fatal(err)
+	}
+	car := b.CARReader(ctx, nd.Cid())
+	defer car.Close()
+	for i := 0; i < 2; i++ {
+		body, err := car.(interface {
+			GetBody() (io.ReadCloser, error)
+		}).GetBody()
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := io.ReadAll(body)
+		body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, want.Bytes()) {
+			t.Fatalf("attempt %d: CAR differs", i)
+		}
+	}
+}
+
+// TestDirectorySharding builds directories on both sides of the sharding
+// size and compares them with the ones Kubo builds through uio.Directory.
+func TestDirectorySharding(t *testing.T) {
+	ctx := context.Background()
+	defer func(size int) { uio.HAMTShardingSize = size }(uio.HAMTShardingSize)
+	uio.HAMTShardingSize = 1024
+
+	b := NewBuilder()
+	var sharded bool
+	for n := 1; n <= 40; n++ {
+		entries := map[string]cid.Cid{}
+		kubo := uio.NewDirectory(b.DAGService())
+		kubo.SetCidBuilder(merkledag.V1CidPrefix())
+		for i := 0; i < n; i++ {
+			name := fmt.Sprintf("file-%03d", i)
+			nd, err := b.AddReader(ctx, strings.NewReader(name))
+			if err != nil {
+				t.Fatal(err)
+			}
+			entries[name] = nd.Cid()
+			if err := kubo.AddChild(ctx, name, nd); err != nil {
+				t.Fatal(err)
+			}
+		}
+		want, err := kubo.GetNode()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		got, err := b.Directory(ctx, entries)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !got.Cid().Equals(want.Cid()) {
+			t.Fatalf("%d entries: directory %s, want %s", n, got.Cid(), want.Cid())
+		}
+		if fsn, err := ft.ExtractFSNode(got); err == nil && fsn.Type() == ft.THAMTShard {
+			sharded = true
+		}
+	}
+	if !sharded {
+		t.Error("no directory was sharded")
+	}
+}
+
+func TestSetShardThreshold(t *testing.T) {
+	ctx := context.Background()
+	b := NewBuilder()
+	b.SetShardThreshold(3)
+
+	entries := map[string]cid.Cid{}
+	for i := 0; i < 4; i++ {
+		name := fmt.Sprintf("file-%d", i)
+		nd, err := b.AddReader(ctx, strings.NewReader(name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		entries[name] = nd.Cid()
+
+		dir, err := b.Directory(ctx, entries)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fsn, err := ft.ExtractFSNode(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if shard := fsn.Type() == ft.THAMTShard; shard != (len(entries) > 3) {
+			t.Errorf("%d entries: sharded = %v", len(entries), shard)
+		}
+
+		listed, err := uio.NewDirectoryFromNode(b.DAGService(), dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		links, err := listed.Links(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(links) != len(entries) {
+			t.Fatalf("%d entries listed, want %d", len(links), len(entries))
+		}
+		for _, lnk := range links {
+			if !lnk.Cid.Equals(entries[lnk.Name]) {
+				t.Errorf("entry %s: %s, want %s", lnk.Name, lnk.Cid, entries[lnk.Name])
+			}
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package dag
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/heilart1n/justpin-ipfs/file"
+	"github.com/ipfs/boxo/blockstore"
+	blocks "github.com/ipfs/go-block-format"
+	"github.com/ipfs/go-cid"
+	ipld "github.com/ipfs/go-ipld-format"
+	"github.com/multiformats/go-multihash"
+)
+
+// diskBlockstore keeps every block in a file of its own under dir, named by
+// its multihash. Blocks are looked up by multihash like in Kubo, listed
+// keys use the raw codec.
+type diskBlockstore struct {
+	dir string
+}
+
+var _ blockstore.Blockstore = (*diskBlockstore)(nil)
+
+func (bs *diskBlockstore) path(c cid.Cid) string {
+	return filepath.Join(bs.dir, c.Hash().HexString())
+}
+
+func (bs *diskBlockstore) DeleteBlock(ctx context.Context, c cid.Cid) error {
+	err := os.Remove(bs.path(c))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+func (bs *diskBlockstore) Has(ctx context.Context, c cid.Cid) (bool, error) {
+	_, err := os.Stat(bs.path(c))
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (bs *diskBlockstore) Get(ctx context.Context, c cid.Cid) (blocks.Block, error) {
+	data, err := os.ReadFile(bs.path(c))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ipld.ErrNotFound{Cid: c}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return blocks.NewBlockWithCid(data, c)
+}
+
+func (bs *diskBlockstore) GetSize(ctx context.Context, c cid.Cid) (int, error) {
+	fi, err := os.Stat(bs.path(c))
+	if errors.Is(err, fs.ErrNotExist) {
+		return -1, ipld.ErrNotFound{Cid: c}
+	}
+	if err != nil {
+		return -1, err
+	}
+	return int(fi.Size()), nil
+}
+
+// Put writes the block atomically, so a block is never seen half written.
+func (bs *diskBlockstore) Put(ctx context.Context, blk blocks.Block) error {
+	fp := bs.path(blk.Cid())
+	if _, err := os.Stat(fp); err == nil {
+		return nil
+	}
+	return file.WriteFileAtomic(fp, blk.RawData())
+}
+
+func (bs *diskBlockstore) PutMany(ctx context.Context, blks []blocks.Block) error {
+	for _, blk := range blks {
+		if err := bs.Put(ctx, blk); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (bs *diskBlockstore) AllKeysChan(ctx context.Context) (<-chan cid.Cid, error) {
+	entries, err := os.ReadDir(bs.dir)
+	if err != nil {
+		return nil, err
+	}
+	ch := make(chan cid.Cid)
+	go func() {
+		defer close(ch)
+		for _, de := range entries {
+			mh, err := multihash.FromHexString(de.Name())
+			if err != nil {
+				continue // temporary files
+			}
+			select {
+			case ch <- cid.NewCidV1(cid.Raw, mh):
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return ch, nil
+}
+
+func (bs *diskBlockstore) HashOnRead(enabled bool) {}
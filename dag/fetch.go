@@ -0,0 +1,179 @@
+package dag
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+
+	httpretry "github.com/heilart1n/justpin-ipfs/http"
+	"github.com/heilart1n/justpin-ipfs/pinners"
+	"github.com/ipfs/boxo/ipld/merkledag"
+	blocks "github.com/ipfs/go-block-format"
+	"github.com/ipfs/go-cid"
+	ipld "github.com/ipfs/go-ipld-format"
+)
+
+// DefaultGateway is the trustless gateway used when no Fetcher is set.
+const DefaultGateway = "https://trustless-gateway.link"
+
+// maxBlockSize bounds the blocks accepted from a Fetcher, it matches the
+// limit enforced by bitswap.
+const maxBlockSize = 2 << 20
+
+// Fetcher retrieves raw blocks of content that isn't held locally, e.g. the
+// directory nodes of an already pinned tree.
+type Fetcher interface {
+	Fetch(ctx context.Context, c cid.Cid) ([]byte, error)
+}
+
+// defaultFetcher returns a GatewayFetcher on DefaultGateway to read the
+// content pinned to p with. An OfflinePinner gets none, as it must not cause
+// requests.
+func defaultFetcher(p pinners.Pinner) (Fetcher, error) {
+	if op, ok := p.(pinners.OfflinePinner); ok && op.Offline() {
+		return nil, fmt.Errorf("%s: reading existing content needs a Fetcher offline", p.Name())
+	}
+	return NewGatewayFetcher(DefaultGateway, nil), nil
+}
+
+// GatewayFetcher fetches verified blocks from a trustless HTTP gateway.
+type GatewayFetcher struct {
+	*http.Client
+	gateway string
+}
+
+// NewGatewayFetcher returns a Fetcher for the given gateway, e.g.
+// "https://ipfs.io". DefaultGateway is used when gateway is empty.
+func NewGatewayFetcher(gateway string, httpClient *http.Client) *GatewayFetcher {
+	if gateway == "" {
+		gateway = DefaultGateway
+	}
+	return &GatewayFetcher{Client: httpClient, gateway: strings.TrimSuffix(gateway, "/")}
+}
+
+// Fetch requests c as `application/vnd.ipld.raw` and checks the data hashes
+// to c before returning it.
+func (f *GatewayFetcher) Fetch(ctx context.Context, c cid.Cid) ([]byte, error) {
+	endpoint := fmt.Sprintf("%s/ipfs/%s?format=raw", f.gateway, c)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/vnd.ipld.raw")
+
+	httpClient := httpretry.NewClient(f.Client)
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetch block %s failed: %s", c, resp.Status)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxBlockSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxBlockSize {
+		return nil, fmt.Errorf("block %s exceeds %d bytes", c, maxBlockSize)
+	}
+
+	got, err := c.Prefix().Sum(data)
+	if err != nil {
+		return nil, err
+	}
+	if !got.Equals(c) {
+		return nil, fmt.Errorf("block %s failed verification, got %s", c, got)
+	}
+
+	return data, nil
+}
+
+// fetchingDAG is the Builder's DAGService. New nodes are written to the
+// local store, reads fall back to the Builder's Fetcher and are cached
+// apart so they never end up in an exported CAR.
+type fetchingDAG struct {
+	ipld.DAGService
+	builder *Builder
+
+	mu      sync.Mutex
+	fetched map[cid.Cid]ipld.Node
+}
+
+func (d *fetchingDAG) Add(ctx context.Context, nd ipld.Node) error {
+	if d.builder.discardLeaves && nd.Cid().Prefix().Codec == cid.Raw {
+		return nil
+	}
+	return d.DAGService.Add(ctx, nd)
+}
+
+func (d *fetchingDAG) AddMany(ctx context.Context, nds []ipld.Node) error {
+	for _, nd := range nds {
+		if err := d.Add(ctx, nd); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *fetchingDAG) Get(ctx context.Context, c cid.Cid) (ipld.Node, error) {
+	nd, err := d.DAGService.Get(ctx, c)
+	if err == nil || !ipld.IsNotFound(err) || d.builder.fetcher == nil {
+		return nd, err
+	}
+
+	d.mu.Lock()
+	nd, ok := d.fetched[c]
+	d.mu.Unlock()
+	if ok {
+		return nd, nil
+	}
+
+	data, err := d.builder.fetcher.Fetch(ctx, c)
+	if err != nil {
+		return nil, err
+	}
+	blk, err := blocks.NewBlockWithCid(data, c)
+	if err != nil {
+		return nil, err
+	}
+
+	switch c.Prefix().Codec {
+	case cid.DagProtobuf:
+		nd, err = merkledag.DecodeProtobufBlock(blk)
+	case cid.Raw:
+		nd, err = merkledag.DecodeRawBlock(blk)
+	default:
+		err = fmt.Errorf("unsupported codec for %s", c)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	d.mu.Lock()
+	d.fetched[c] = nd
+	d.mu.Unlock()
+
+	return nd, nil
+}
+
+func (d *fetchingDAG) GetMany(ctx context.Context, cids []cid.Cid) <-chan *ipld.NodeOption {
+	out := make(chan *ipld.NodeOption, len(cids))
+	go func() {
+		defer close(out)
+		for _, c := range cids {
+			nd, err := d.Get(ctx, c)
+			select {
+			case out <- &ipld.NodeOption{Node: nd, Err: err}:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out
+}
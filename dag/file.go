@@ -0,0 +1,196 @@
+package dag
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/heilart1n/justpin-ipfs/file"
+	"github.com/heilart1n/justpin-ipfs/pinners"
+	chunker "github.com/ipfs/boxo/chunker"
+	"github.com/ipfs/boxo/ipld/merkledag"
+	ft "github.com/ipfs/boxo/ipld/unixfs"
+	"github.com/ipfs/boxo/ipld/unixfs/importer/balanced"
+	"github.com/ipfs/boxo/ipld/unixfs/importer/helpers"
+	ipld "github.com/ipfs/go-ipld-format"
+)
+
+// AddReader imports the content of r as a UnixFS file with the same
+// settings as `ipfs add --cid-version=1`: 256 KiB chunks, balanced layout
+// and raw leaves.
+func (b *Builder) AddReader(ctx context.Context, r io.Reader) (ipld.Node, error) {
+	params := helpers.DagBuilderParams{
+		Dagserv:    b.dserv,
+		Maxlinks:   helpers.DefaultLinksPerBlock,
+		RawLeaves:  true,
+		CidBuilder: b.cidBuilder,
+	}
+	db, err := params.New(chunker.NewSizeSplitter(r, chunker.DefaultBlockSize))
+	if err != nil {
+		return nil, err
+	}
+	return balanced.Layout(db)
+}
+
+// AddNode imports a file or directory Node and returns its root. The root
+// of a directory Node is the directory itself, it isn't wrapped.
+func (b *Builder) AddNode(ctx context.Context, node *file.Node) (ipld.Node, error) {
+	dirs := map[string][]*ipld.Link{"": nil}
+	attrs := map[string]file.Attributes{"": node.Attributes(node.Stat())}
+	var root ipld.Node
+
+	err := node.Walk(func(fp string, fi os.FileInfo) error {
+		if fi.IsDir() {
+			addLink(dirs, fp, nil)
+			attrs[fp] = node.Attributes(fi)
+			return nil
+		}
+
+		var nd ipld.Node
+		var err error
+		if fi.Mode()&os.ModeSymlink != 0 {
+			nd, err = b.addSymlink(ctx, node, fp)
+		} else {
+			nd, err = b.addFile(ctx, node, fp)
+		}
+		if err == nil {
+			nd, err = b.withAttributes(ctx, nd, node.Attributes(fi))
+		}
+		if err != nil {
+			return fmt.Errorf("import %s failed: %v", fp, err)
+		}
+		if !node.IsDir() {
+			root = nd
+			return nil
+		}
+
+		dir, name := path.Split(fp)
+		dir = strings.TrimSuffix(dir, "/")
+		lnk, err := ipld.MakeLink(nd)
+		if err != nil {
+			return err
+		}
+		lnk.Name = name
+		addLink(dirs, dir, lnk)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if root != nil {
+		return root, nil
+	}
+
+	return b.buildDirs(ctx, dirs, attrs)
+}
+
+func (b *Builder) addFile(ctx context.Context, node *file.Node, fp string) (ipld.Node, error) {
+	f, err := node.Open(fp)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return b.AddReader(ctx, f)
+}
+
+// addSymlink stores a preserved symlink as a UnixFS symlink node.
+func (b *Builder) addSymlink(ctx context.Context, node *file.Node, fp string) (ipld.Node, error) {
+	target, err := node.Readlink(fp)
+	if err != nil {
+		return nil, err
+	}
+	data, err := ft.SymlinkData(target)
+	if err != nil {
+		return nil, err
+	}
+
+	nd := merkledag.NodeWithData(data)
+	if err := nd.SetCidBuilder(b.cidBuilder); err != nil {
+		return nil, err
+	}
+	if err := b.dserv.Add(ctx, nd); err != nil {
+		return nil, err
+	}
+	return nd, nil
+}
+
+// addLink records lnk under dir and makes sure every parent of dir exists.
+// A nil lnk only records dir.
+func addLink(dirs map[string][]*ipld.Link, dir string, lnk *ipld.Link) {
+	if lnk != nil {
+		dirs[dir] = append(dirs[dir], lnk)
+	} else if _, ok := dirs[dir]; !ok {
+		dirs[dir] = nil
+	}
+	for dir != "" {
+		dir = strings.TrimSuffix(path.Dir(dir), ".")
+		if _, ok := dirs[dir]; ok {
+			break
+		}
+		dirs[dir] = nil
+	}
+}
+
+// buildDirs builds the collected directories from the deepest up, with
+// their attributes, and returns the root.
+func (b *Builder) buildDirs(ctx context.Context, dirs map[string][]*ipld.Link, attrs map[string]file.Attributes) (ipld.Node, error) {
+	order := make([]string, 0, len(dirs))
+	for dir := range dirs {
+		order = append(order, dir)
+	}
+	sort.Slice(order, func(i, j int) bool {
+		return depth(order[i]) > depth(order[j])
+	})
+
+	for _, dir := range order {
+		nd, err := b.directoryFromLinks(ctx, dirs[dir])
+		if err == nil {
+			nd, err = b.withAttributes(ctx, nd, attrs[dir])
+		}
+		if err != nil {
+			return nil, fmt.Errorf("build directory %s failed: %v", displayPath(dir), err)
+		}
+		if dir == "" {
+			return nd, nil
+		}
+
+		lnk, err := ipld.MakeLink(nd)
+		if err != nil {
+			return nil, err
+		}
+		parent, name := path.Split(dir)
+		lnk.Name = name
+		parent = strings.TrimSuffix(parent, "/")
+		dirs[parent] = append(dirs[parent], lnk)
+	}
+
+	return nil, fmt.Errorf("missing root directory")
+}
+
+func depth(dir string) int {
+	if dir == "" {
+		return 0
+	}
+	return strings.Count(dir, "/") + 1
+}
+
+// PinFile builds the DAG of the file or directory at fp locally and pins it
+// as a CAR, so directory layout and sharding don't depend on the provider.
+func PinFile(ctx context.Context, p pinners.Pinner, fp string, opts ...file.Option) (pinners.Result, error) {
+	node, err := file.NewSerialFile(fp, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	b := NewBuilder()
+	nd, err := b.AddNode(ctx, node)
+	if err != nil {
+		return nil, err
+	}
+	return b.Pin(ctx, p, nd.Cid())
+}
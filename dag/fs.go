@@ -0,0 +1,202 @@
+package dag
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"strings"
+	"time"
+
+	ft "github.com/ipfs/boxo/ipld/unixfs"
+	uio "github.com/ipfs/boxo/ipld/unixfs/io"
+	"github.com/ipfs/go-cid"
+	ipld "github.com/ipfs/go-ipld-format"
+)
+
+// FS returns a read-only fs.FS of the UnixFS DAG at root, which must be a
+// directory. File content is read from the Builder's DAGService. Symlinks
+// are listed but can't be opened.
+func (b *Builder) FS(ctx context.Context, root cid.Cid) fs.FS {
+	return &dagFS{ctx: ctx, builder: b, root: root}
+}
+
+type dagFS struct {
+	ctx     context.Context
+	builder *Builder
+	root    cid.Cid
+}
+
+func (fsys *dagFS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	nd, err := fsys.resolve(name)
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	info, err := fsys.stat(name, nd)
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+
+	if info.link {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	if info.IsDir() {
+		dir, err := uio.NewDirectoryFromNode(fsys.builder.dserv, nd)
+		if err != nil {
+			return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+		}
+		return &dagDir{fsys: fsys, name: name, info: info, dir: dir}, nil
+	}
+	rd, err := uio.NewDagReader(fsys.ctx, nd, fsys.builder.dserv)
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	return &dagFile{DagReader: rd, info: info}, nil
+}
+
+// resolve walks the directories from the root down to name.
+func (fsys *dagFS) resolve(name string) (ipld.Node, error) {
+	nd, err := fsys.builder.dserv.Get(fsys.ctx, fsys.root)
+	if err != nil || name == "." {
+		return nd, err
+	}
+
+	for _, elem := range strings.Split(name, "/") {
+		dir, err := uio.NewDirectoryFromNode(fsys.builder.dserv, nd)
+		if err == uio.ErrNotADir {
+			return nil, fs.ErrNotExist
+		}
+		if err != nil {
+			return nil, err
+		}
+		nd, err = dir.Find(fsys.ctx, elem)
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, fs.ErrNotExist
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return nd, nil
+}
+
+// stat describes nd found at name. Raw leaves are files.
+func (fsys *dagFS) stat(name string, nd ipld.Node) (*dagInfo, error) {
+	info := &dagInfo{name: name[strings.LastIndex(name, "/")+1:]}
+	if len(nd.Links()) == 0 && nd.Cid().Prefix().Codec == cid.Raw {
+		info.size = int64(len(nd.RawData()))
+		return info, nil
+	}
+
+	fsn, err := ft.ExtractFSNode(nd)
+	if err != nil {
+		return nil, err
+	}
+	switch fsn.Type() {
+	case ft.TDirectory, ft.THAMTShard:
+		info.dir = true
+	case ft.TSymlink:
+		info.link = true
+	default:
+		info.size = int64(fsn.FileSize())
+	}
+	return info, nil
+}
+
+// dagFile is an open file of a dagFS.
+type dagFile struct {
+	uio.DagReader
+	info *dagInfo
+}
+
+func (f *dagFile) Stat() (fs.FileInfo, error) {
+	return f.info, nil
+}
+
+// dagDir is an open directory of a dagFS.
+type dagDir struct {
+	fsys    *dagFS
+	name    string
+	info    *dagInfo
+	dir     uio.Directory
+	entries []fs.DirEntry
+	read    bool
+}
+
+func (d *dagDir) Stat() (fs.FileInfo, error) {
+	return d.info, nil
+}
+
+func (d *dagDir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.name, Err: fs.ErrInvalid}
+}
+
+func (d *dagDir) Close() error {
+	return nil
+}
+
+// ReadDir lists the entries of the directory, see fs.ReadDirFile.
+func (d *dagDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	if !d.read {
+		d.read = true
+		err := d.dir.ForEachLink(d.fsys.ctx, func(lnk *ipld.Link) error {
+			nd, err := lnk.GetNode(d.fsys.ctx, d.fsys.builder.dserv)
+			if err != nil {
+				return err
+			}
+			info, err := d.fsys.stat(lnk.Name, nd)
+			if err != nil {
+				return err
+			}
+			d.entries = append(d.entries, fs.FileInfoToDirEntry(info))
+			return nil
+		})
+		if err != nil {
+			return nil, &fs.PathError{Op: "readdir", Path: d.name, Err: err}
+		}
+	}
+
+	if n <= 0 {
+		entries := d.entries
+		d.entries = nil
+		return entries, nil
+	}
+	if len(d.entries) == 0 {
+		return nil, io.EOF
+	}
+	if n > len(d.entries) {
+		n = len(d.entries)
+	}
+	entries := d.entries[:n]
+	d.entries = d.entries[n:]
+	return entries, nil
+}
+
+// dagInfo describes a file or directory of a dagFS. UnixFS keeps no mode or
+// times by default, files are reported read-only.
+type dagInfo struct {
+	name string
+	size int64
+	dir  bool
+	link bool
+}
+
+func (fi *dagInfo) Name() string       { return fi.name }
+func (fi *dagInfo) Size() int64        { return fi.size }
+func (fi *dagInfo) ModTime() time.Time { return time.Time{} }
+func (fi *dagInfo) IsDir() bool        { return fi.dir }
+func (fi *dagInfo) Sys() any           { return nil }
+
+func (fi *dagInfo) Mode() fs.FileMode {
+	switch {
+	case fi.dir:
+		return fs.ModeDir | 0o555
+	case fi.link:
+		return fs.ModeSymlink | 0o777
+	}
+	return 0o444
+}
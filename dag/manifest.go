@@ -0,0 +1,71 @@
+package dag
+
+import (
+	"context"
+	"path"
+
+	"github.com/heilart1n/justpin-ipfs/file"
+	"github.com/heilart1n/justpin-ipfs/pinners"
+	uio "github.com/ipfs/boxo/ipld/unixfs/io"
+	"github.com/ipfs/go-cid"
+	ipld "github.com/ipfs/go-ipld-format"
+)
+
+// Manifest lists every file and directory below root. Sharded directories
+// are listed by entry name, not by their internal shard links.
+func (b *Builder) Manifest(ctx context.Context, root cid.Cid) (*pinners.Manifest, error) {
+	nd, err := b.dserv.Get(ctx, root)
+	if err != nil {
+		return nil, err
+	}
+
+	manifest := &pinners.Manifest{Root: root.String()}
+	if err := b.listDir(ctx, nd, "", manifest); err != nil {
+		return nil, err
+	}
+	manifest.Sort()
+
+	return manifest, nil
+}
+
+func (b *Builder) listDir(ctx context.Context, nd ipld.Node, prefix string, manifest *pinners.Manifest) error {
+	dir, err := uio.NewDirectoryFromNode(b.dserv, nd)
+	if err == uio.ErrNotADir {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	return dir.ForEachLink(ctx, func(lnk *ipld.Link) error {
+		p := path.Join(prefix, lnk.Name)
+		manifest.Entries = append(manifest.Entries, pinners.ManifestEntry{Path: p, Cid: lnk.Cid.String(), Size: lnk.Size})
+
+		child, err := b.dserv.Get(ctx, lnk.Cid)
+		if ipld.IsNotFound(err) {
+			return nil // linked content that isn't held locally
+		}
+		if err != nil {
+			return err
+		}
+		return b.listDir(ctx, child, p, manifest)
+	})
+}
+
+// Manifest computes the manifest of the file or directory at fp without
+// uploading anything. The CIDs match a `cid-version=1` upload. Leaf blocks
+// are discarded as they are hashed, so the tree isn't held in memory.
+func Manifest(ctx context.Context, fp string, opts ...file.Option) (*pinners.Manifest, error) {
+	node, err := file.NewSerialFile(fp, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	b := NewBuilder()
+	b.SetDiscardLeaves(true)
+	nd, err := b.AddNode(ctx, node)
+	if err != nil {
+		return nil, err
+	}
+	return b.Manifest(ctx, nd.Cid())
+}
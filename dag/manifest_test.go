@@ -0,0 +1,73 @@
+package dag
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/heilart1n/justpin-ipfs/file"
+)
+
+func TestManifest(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	files := map[string]string{
+		"a.txt":     "hello world",
+		"sub/b.bin": strings.Repeat("0123456789", 100_000),
+	}
+	for name, content := range files {
+		fp := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(fp), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(fp, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	manifest, err := Manifest(ctx, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The manifest drops the leaves, the CIDs must still match a full build.
+	node, err := file.NewSerialFile(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := NewBuilder()
+	root, err := b.AddNode(ctx, node)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if manifest.Root != root.Cid().String() {
+		t.Errorf("root %s, want %s", manifest.Root, root.Cid())
+	}
+	want, err := b.Manifest(ctx, root.Cid())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(manifest.Entries) != 3 || len(want.Entries) != 3 {
+		t.Fatalf("entries %v, want %v", manifest.Entries, want.Entries)
+	}
+	for i, e := range manifest.Entries {
+		if e != want.Entries[i] {
+			t.Errorf("entry %v, want %v", e, want.Entries[i])
+		}
+	}
+
+	for name, content := range files {
+		nd, err := NewBuilder().AddReader(ctx, strings.NewReader(content))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if e, ok := manifest.Lookup(name); !ok || e.Cid != nd.Cid().String() {
+			t.Errorf("%s: entry %v, want %s", name, e, nd.Cid())
+		}
+	}
+	if _, ok := manifest.Lookup("sub"); !ok {
+		t.Error("directory sub not listed")
+	}
+}
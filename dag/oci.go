@@ -0,0 +1,424 @@
+package dag
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/heilart1n/justpin-ipfs/file"
+	"github.com/heilart1n/justpin-ipfs/pinners"
+	uio "github.com/ipfs/boxo/ipld/unixfs/io"
+	ipld "github.com/ipfs/go-ipld-format"
+)
+
+// Media types of the OCI image spec.
+const (
+	MediaTypeImageIndex    = "application/vnd.oci.image.index.v1+json"
+	MediaTypeImageManifest = "application/vnd.oci.image.manifest.v1+json"
+	MediaTypeImageConfig   = "application/vnd.oci.image.config.v1+json"
+	MediaTypeImageLayer    = "application/vnd.oci.image.layer.v1.tar"
+
+	mediaTypeDockerManifestList = "application/vnd.docker.distribution.manifest.list.v2+json"
+	mediaTypeDockerManifest     = "application/vnd.docker.distribution.manifest.v2+json"
+)
+
+const (
+	ociLayoutFile      = "oci-layout"
+	ociIndexFile       = "index.json"
+	dockerManifestFile = "manifest.json"
+
+	// maxImageJSON bounds the manifests, indexes and configs read in memory.
+	maxImageJSON = 4 << 20
+)
+
+type descriptor struct {
+	MediaType   string            `json:"mediaType"`
+	Digest      string            `json:"digest"`
+	Size        int64             `json:"size"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+type imageIndex struct {
+	SchemaVersion int          `json:"schemaVersion"`
+	MediaType     string       `json:"mediaType,omitempty"`
+	Manifests     []descriptor `json:"manifests"`
+}
+
+type imageManifest struct {
+	SchemaVersion int          `json:"schemaVersion"`
+	MediaType     string       `json:"mediaType,omitempty"`
+	Config        descriptor   `json:"config"`
+	Layers        []descriptor `json:"layers"`
+}
+
+// dockerManifest is an entry of the manifest.json of `docker save`.
+type dockerManifest struct {
+	Config   string
+	RepoTags []string
+	Layers   []string
+}
+
+// imageBlob is a file of the image source, imported and hashed.
+type imageBlob struct {
+	nd     ipld.Node
+	digest string
+	size   int64
+}
+
+// image collects the files of an image source and lays them out again as
+// an OCI image layout.
+type image struct {
+	ctx      context.Context
+	b        *Builder
+	files    map[string]*imageBlob
+	byDigest map[string]*imageBlob
+	blobs    map[string]*imageBlob // the blobs of the layout, by digest
+}
+
+// AddImage imports the container image at fp as an OCI image layout and
+// returns the root directory. fp is either an OCI image layout directory or
+// the tarball of `docker save`, possibly compressed, which is converted.
+//
+// The layout holds `oci-layout`, `index.json` and the blobs reachable from
+// the index under `blobs/sha256/`, each blob a UnixFS file whose digest was
+// checked. Served by a gateway, the directory can be copied back with OCI
+// tools, e.g. `oras copy --from-oci-layout` or `skopeo copy oci:`.
+func (b *Builder) AddImage(ctx context.Context, fp string) (ipld.Node, error) {
+	fi, err := os.Stat(fp)
+	if err != nil {
+		return nil, err
+	}
+	if !fi.IsDir() {
+		f, err := os.Open(fp)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		return b.AddImageArchive(ctx, file.NewArchive(f))
+	}
+
+	node, err := file.NewSerialFile(fp, file.Symlinks(file.SymlinkSkip))
+	if err != nil {
+		return nil, err
+	}
+	img := b.newImage(ctx)
+	err = node.Walk(func(name string, fi os.FileInfo) error {
+		if fi.IsDir() {
+			return nil
+		}
+		f, err := node.Open(name)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		return img.add(name, f)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return img.layout()
+}
+
+// AddImageArchive is AddImage for an OCI image layout or a `docker save`
+// tarball read from a, e.g. the output of `docker save` itself. Layers are
+// bound by the limits of a like any file. Links of the tarball are skipped,
+// repeated layers are found by their digest.
+func (b *Builder) AddImageArchive(ctx context.Context, a *file.Archive) (ipld.Node, error) {
+	a.SkipLinks = true
+	img := b.newImage(ctx)
+	err := a.Walk(func(name string, fi fs.FileInfo, r io.Reader) error {
+		if fi.IsDir() {
+			return nil
+		}
+		return img.add(name, r)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return img.layout()
+}
+
+// PinImage imports the container image at fp, see Builder.AddImage, and
+// pins the layout as a CAR. The blocks are kept in a temporary directory
+// rather than memory, and removed once pinned.
+func PinImage(ctx context.Context, p pinners.Pinner, fp string) (pinners.Result, error) {
+	dir, err := os.MkdirTemp("", "justpin-image-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	b := NewDiskBuilder(dir)
+	nd, err := b.AddImage(ctx, fp)
+	if err != nil {
+		return nil, err
+	}
+	return b.Pin(ctx, p, nd.Cid())
+}
+
+func (b *Builder) newImage(ctx context.Context) *image {
+	return &image{
+		ctx:      ctx,
+		b:        b,
+		files:    map[string]*imageBlob{},
+		byDigest: map[string]*imageBlob{},
+		blobs:    map[string]*imageBlob{},
+	}
+}
+
+func (img *image) add(name string, r io.Reader) error {
+	if _, ok := img.files[name]; ok {
+		return fmt.Errorf("duplicate entry in image: %s", name)
+	}
+	h := sha256.New()
+	cr := &file.CountingReader{R: io.TeeReader(r, h)}
+	nd, err := img.b.AddReader(img.ctx, cr)
+	if err != nil {
+		return fmt.Errorf("import %s failed: %w", name, err)
+	}
+	blob := &imageBlob{nd: nd, digest: "sha256:" + hex.EncodeToString(h.Sum(nil)), size: cr.N}
+	img.files[name] = blob
+	img.byDigest[blob.digest] = blob
+	return nil
+}
+
+// layout checks the collected files and returns the OCI image layout. The
+// index and version of a layout are kept as they are.
+func (img *image) layout() (ipld.Node, error) {
+	dirs := map[string][]*ipld.Link{"": nil}
+	var index imageIndex
+	switch {
+	case img.files[ociLayoutFile] != nil:
+		var layout struct {
+			ImageLayoutVersion string `json:"imageLayoutVersion"`
+		}
+		if err := img.readJSON(img.files[ociLayoutFile], &layout); err != nil {
+			return nil, fmt.Errorf("read %s failed: %v", ociLayoutFile, err)
+		}
+		if !strings.HasPrefix(layout.ImageLayoutVersion, "1.") {
+			return nil, fmt.Errorf("unsupported image layout version %q", layout.ImageLayoutVersion)
+		}
+		if img.files[ociIndexFile] == nil {
+			return nil, fmt.Errorf("missing %s", ociIndexFile)
+		}
+		if err := img.readJSON(img.files[ociIndexFile], &index); err != nil {
+			return nil, fmt.Errorf("read %s failed: %v", ociIndexFile, err)
+		}
+		for _, desc := range index.Manifests {
+			if err := img.walkDescriptor(desc); err != nil {
+				return nil, err
+			}
+		}
+		for _, name := range []string{ociLayoutFile, ociIndexFile} {
+			if err := img.link(dirs, name, img.files[name].nd); err != nil {
+				return nil, err
+			}
+		}
+	case img.files[dockerManifestFile] != nil:
+		var err error
+		if index, err = img.convertDocker(); err != nil {
+			return nil, err
+		}
+		index.SchemaVersion = 2
+		index.MediaType = MediaTypeImageIndex
+		if _, err := img.addJSON(index, dirs, ociIndexFile); err != nil {
+			return nil, err
+		}
+		if _, err := img.addJSON(map[string]string{"imageLayoutVersion": "1.0.0"}, dirs, ociLayoutFile); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("not an OCI image layout nor a docker save archive")
+	}
+	if len(index.Manifests) == 0 {
+		return nil, fmt.Errorf("image has no manifest")
+	}
+
+	for digest, blob := range img.blobs {
+		alg, encoded, _ := strings.Cut(digest, ":")
+		if err := img.link(dirs, path.Join("blobs", alg, encoded), blob.nd); err != nil {
+			return nil, err
+		}
+	}
+	return img.b.buildDirs(img.ctx, dirs, nil)
+}
+
+// walkDescriptor checks that the blob of desc and the blobs it points to are
+// in the layout, then keeps them.
+func (img *image) walkDescriptor(desc descriptor) error {
+	blob, err := img.blob(desc)
+	if err != nil {
+		return err
+	}
+
+	switch desc.MediaType {
+	case MediaTypeImageIndex, mediaTypeDockerManifestList:
+		var index imageIndex
+		if err := img.readJSON(blob, &index); err != nil {
+			return fmt.Errorf("read index %s failed: %v", desc.Digest, err)
+		}
+		for _, child := range index.Manifests {
+			if err := img.walkDescriptor(child); err != nil {
+				return err
+			}
+		}
+	case MediaTypeImageManifest, mediaTypeDockerManifest:
+		var manifest imageManifest
+		if err := img.readJSON(blob, &manifest); err != nil {
+			return fmt.Errorf("read manifest %s failed: %v", desc.Digest, err)
+		}
+		if _, err := img.blob(manifest.Config); err != nil {
+			return err
+		}
+		for _, layer := range manifest.Layers {
+			if _, err := img.blob(layer); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// blob returns the blob of desc from the layout after checking its digest
+// and size.
+func (img *image) blob(desc descriptor) (*imageBlob, error) {
+	alg, encoded, ok := strings.Cut(desc.Digest, ":")
+	if !ok || alg != "sha256" || len(encoded) != sha256.Size*2 {
+		return nil, fmt.Errorf("unsupported digest %q", desc.Digest)
+	}
+	blob := img.files[path.Join("blobs", alg, encoded)]
+	if blob == nil {
+		return nil, fmt.Errorf("missing blob %s", desc.Digest)
+	}
+	if blob.digest != desc.Digest {
+		return nil, fmt.Errorf("blob %s has digest %s", desc.Digest, blob.digest)
+	}
+	if blob.size != desc.Size {
+		return nil, fmt.Errorf("blob %s has size %d, want %d", desc.Digest, blob.size, desc.Size)
+	}
+	img.blobs[blob.digest] = blob
+	return blob, nil
+}
+
+// convertDocker turns the images of a `docker save` tarball into OCI
+// manifests and returns the index of the layout.
+func (img *image) convertDocker() (imageIndex, error) {
+	var index imageIndex
+	var manifests []dockerManifest
+	if err := img.readJSON(img.files[dockerManifestFile], &manifests); err != nil {
+		return index, fmt.Errorf("read %s failed: %v", dockerManifestFile, err)
+	}
+
+	for _, m := range manifests {
+		config := img.files[m.Config]
+		if config == nil {
+			return index, fmt.Errorf("missing config %s", m.Config)
+		}
+		var rootfs struct {
+			RootFS struct {
+				DiffIDs []string `json:"diff_ids"`
+			} `json:"rootfs"`
+		}
+		if err := img.readJSON(config, &rootfs); err != nil {
+			return index, fmt.Errorf("read config %s failed: %v", m.Config, err)
+		}
+		if len(rootfs.RootFS.DiffIDs) != len(m.Layers) {
+			return index, fmt.Errorf("config %s lists %d layers, want %d", m.Config, len(rootfs.RootFS.DiffIDs), len(m.Layers))
+		}
+
+		manifest := imageManifest{
+			SchemaVersion: 2,
+			MediaType:     MediaTypeImageManifest,
+			Config:        img.keep(config, MediaTypeImageConfig),
+		}
+		for i, name := range m.Layers {
+			// Layers repeated within an image are saved as symlinks, which
+			// aren't read, the diff ID finds them by content instead.
+			layer := img.files[name]
+			if layer == nil {
+				layer = img.byDigest[rootfs.RootFS.DiffIDs[i]]
+			}
+			if layer == nil {
+				return index, fmt.Errorf("missing layer %s", name)
+			}
+			if layer.digest != rootfs.RootFS.DiffIDs[i] {
+				return index, fmt.Errorf("layer %s has digest %s, want %s", name, layer.digest, rootfs.RootFS.DiffIDs[i])
+			}
+			manifest.Layers = append(manifest.Layers, img.keep(layer, MediaTypeImageLayer))
+		}
+
+		desc, err := img.addJSON(manifest, nil, "")
+		if err != nil {
+			return index, err
+		}
+		desc.MediaType = MediaTypeImageManifest
+		if len(m.RepoTags) == 0 {
+			index.Manifests = append(index.Manifests, desc)
+		}
+		for _, tag := range m.RepoTags {
+			d := desc
+			d.Annotations = map[string]string{
+				"io.containerd.image.name":          tag,
+				"org.opencontainers.image.ref.name": tag[strings.LastIndex(tag, ":")+1:],
+			}
+			index.Manifests = append(index.Manifests, d)
+		}
+	}
+	return index, nil
+}
+
+// keep adds blob to the layout and returns its descriptor.
+func (img *image) keep(blob *imageBlob, mediaType string) descriptor {
+	img.blobs[blob.digest] = blob
+	return descriptor{MediaType: mediaType, Digest: blob.digest, Size: blob.size}
+}
+
+// addJSON imports v as JSON and links it at name in dirs, or keeps it as a
+// blob when name is empty.
+func (img *image) addJSON(v interface{}, dirs map[string][]*ipld.Link, name string) (descriptor, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return descriptor{}, err
+	}
+	nd, err := img.b.AddReader(img.ctx, bytes.NewReader(data))
+	if err != nil {
+		return descriptor{}, err
+	}
+	sum := sha256.Sum256(data)
+	blob := &imageBlob{nd: nd, digest: "sha256:" + hex.EncodeToString(sum[:]), size: int64(len(data))}
+	if name == "" {
+		return img.keep(blob, ""), nil
+	}
+	return descriptor{}, img.link(dirs, name, nd)
+}
+
+func (img *image) link(dirs map[string][]*ipld.Link, name string, nd ipld.Node) error {
+	lnk, err := ipld.MakeLink(nd)
+	if err != nil {
+		return err
+	}
+	dir, base := path.Split(name)
+	lnk.Name = base
+	addLink(dirs, strings.TrimSuffix(dir, "/"), lnk)
+	return nil
+}
+
+// readJSON decodes the JSON content of blob into v.
+func (img *image) readJSON(blob *imageBlob, v interface{}) error {
+	if blob.size > maxImageJSON {
+		return fmt.Errorf("larger than %d bytes", maxImageJSON)
+	}
+	rd, err := uio.NewDagReader(img.ctx, blob.nd, img.b.dserv)
+	if err != nil {
+		return err
+	}
+	return json.NewDecoder(rd).Decode(v)
+}
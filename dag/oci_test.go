@@ -0,0 +1,189 @@
+package dag
+
+import (
+	"archive/tar"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func digest(data []byte) string {
+	sum := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+func blobPath(d string) string {
+	return "blobs/sha256/" + strings.TrimPrefix(d, "sha256:")
+}
+
+func mustJSON(t *testing.T, v interface{}) []byte {
+	t.Helper()
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// testLayout returns the files of an OCI image layout with one manifest,
+// plus a blob nothing refers to.
+func testLayout(t *testing.T) (files map[string][]byte, layer []byte) {
+	layer = []byte("layer content")
+	config := mustJSON(t, map[string]interface{}{"rootfs": map[string]interface{}{"diff_ids": []string{digest(layer)}}})
+	manifest := mustJSON(t, imageManifest{
+		SchemaVersion: 2,
+		MediaType:     MediaTypeImageManifest,
+		Config:        descriptor{MediaType: MediaTypeImageConfig, Digest: digest(config), Size: int64(len(config))},
+		Layers:        []descriptor{{MediaType: MediaTypeImageLayer, Digest: digest(layer), Size: int64(len(layer))}},
+	})
+	index := mustJSON(t, imageIndex{
+		SchemaVersion: 2,
+		Manifests:     []descriptor{{MediaType: MediaTypeImageManifest, Digest: digest(manifest), Size: int64(len(manifest))}},
+	})
+	unused := []byte("unused")
+	return map[string][]byte{
+		ociLayoutFile:              []byte(`{"imageLayoutVersion":"1.0.0"}`),
+		ociIndexFile:               index,
+		blobPath(digest(config)):   config,
+		blobPath(digest(manifest)): manifest,
+		blobPath(digest(layer)):    layer,
+		blobPath(digest(unused)):   unused,
+	}, layer
+}
+
+func writeFiles(t *testing.T, files map[string][]byte) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, data := range files {
+		fp := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(fp), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(fp, data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestAddImageLayout(t *testing.T) {
+	ctx := context.Background()
+	files, layer := testLayout(t)
+
+	b := NewBuilder()
+	root, err := b.AddImage(ctx, writeFiles(t, files))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fsys := b.FS(ctx, root.Cid())
+	for name, want := range files {
+		got, err := fs.ReadFile(fsys, name)
+		if string(want) == "unused" {
+			if err == nil {
+				t.Errorf("unreferenced blob %s kept", name)
+			}
+			continue
+		}
+		if err != nil || string(got) != string(want) {
+			t.Errorf("%s = %q, %v", name, got, err)
+		}
+	}
+
+	// a blob whose size doesn't match its descriptor
+	files[blobPath(digest(layer))] = append(layer, '!')
+	if _, err := NewBuilder().AddImage(ctx, writeFiles(t, files)); err == nil {
+		t.Error("corrupted layer accepted")
+	}
+}
+
+func TestAddImageDockerSave(t *testing.T) {
+	ctx := context.Background()
+	layer := []byte("layer content")
+	config := mustJSON(t, map[string]interface{}{
+		"rootfs": map[string]interface{}{"diff_ids": []string{digest(layer), digest(layer)}},
+	})
+
+	fp := filepath.Join(t.TempDir(), "image.tar")
+	f, err := os.Create(fp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tw := tar.NewWriter(f)
+	entries := []struct {
+		hdr  tar.Header
+		data []byte
+	}{
+		{tar.Header{Name: dockerManifestFile}, mustJSON(t, []dockerManifest{{
+			Config:   "config.json",
+			RepoTags: []string{"example.com/app:1.0"},
+			Layers:   []string{"l1/layer.tar", "l2/layer.tar"},
+		}})},
+		{tar.Header{Name: "config.json"}, config},
+		{tar.Header{Name: "l1/", Typeflag: tar.TypeDir}, nil},
+		{tar.Header{Name: "l1/layer.tar"}, layer},
+		// a repeated layer is saved as a symlink
+		{tar.Header{Name: "l2/", Typeflag: tar.TypeDir}, nil},
+		{tar.Header{Name: "l2/layer.tar", Typeflag: tar.TypeSymlink, Linkname: "../l1/layer.tar"}, nil},
+	}
+	for _, e := range entries {
+		hdr := e.hdr
+		hdr.Mode, hdr.Size = 0o644, int64(len(e.data))
+		if hdr.Typeflag == 0 {
+			hdr.Typeflag = tar.TypeReg
+		}
+		if err := tw.WriteHeader(&hdr); err != nil {
+			t.Fatal(err)
+		}
+		tw.Write(e.data)
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	b := NewDiskBuilder(t.TempDir())
+	root, err := b.AddImage(ctx, fp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fsys := b.FS(ctx, root.Cid())
+
+	var index imageIndex
+	data, err := fs.ReadFile(fsys, ociIndexFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(data, &index); err != nil {
+		t.Fatal(err)
+	}
+	if len(index.Manifests) != 1 || index.Manifests[0].Annotations["org.opencontainers.image.ref.name"] != "1.0" {
+		t.Fatalf("index %s", data)
+	}
+
+	var manifest imageManifest
+	data, err = fs.ReadFile(fsys, blobPath(index.Manifests[0].Digest))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		t.Fatal(err)
+	}
+	if manifest.Config.Digest != digest(config) || len(manifest.Layers) != 2 {
+		t.Fatalf("manifest %s", data)
+	}
+	for _, l := range manifest.Layers {
+		got, err := fs.ReadFile(fsys, blobPath(l.Digest))
+		if err != nil || string(got) != string(layer) {
+			t.Errorf("layer %s = %q, %v", l.Digest, got, err)
+		}
+	}
+	if _, err := fs.Stat(fsys, ociLayoutFile); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,423 @@
+package dag
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/heilart1n/justpin-ipfs/pinners"
+	"github.com/ipfs/boxo/ipld/merkledag"
+	ft "github.com/ipfs/boxo/ipld/unixfs"
+	"github.com/ipfs/boxo/ipld/unixfs/hamt"
+	"github.com/ipfs/go-cid"
+	ipld "github.com/ipfs/go-ipld-format"
+)
+
+// OpKind is the kind of change applied to a directory entry.
+type OpKind int
+
+const (
+	OpAdd OpKind = iota
+	OpReplace
+	OpRemove
+)
+
+func (k OpKind) String() string {
+	switch k {
+	case OpAdd:
+		return "add"
+	case OpReplace:
+		return "replace"
+	case OpRemove:
+		return "remove"
+	default:
+		return fmt.Sprintf("OpKind(%d)", int(k))
+	}
+}
+
+// Op is a single change to a directory tree. Path is slash separated and
+// relative to the root, missing parent directories are created by OpAdd.
+// Size is the cumulative size of the linked DAG, it's read from the root
+// block of Cid when zero, as Directory does.
+type Op struct {
+	Kind OpKind
+	Path string
+	Cid  cid.Cid
+	Size uint64
+}
+
+// AddEntry returns an Op adding c at p, it fails if p already exists.
+func AddEntry(p string, c cid.Cid) Op {
+	return Op{Kind: OpAdd, Path: p, Cid: c}
+}
+
+// ReplaceEntry returns an Op pointing the existing entry p to c.
+func ReplaceEntry(p string, c cid.Cid) Op {
+	return Op{Kind: OpReplace, Path: p, Cid: c}
+}
+
+// RemoveEntry returns an Op removing the existing entry p.
+func RemoveEntry(p string) Op {
+	return Op{Kind: OpRemove, Path: p}
+}
+
+// Patch applies ops to the directory root and returns the new root node.
+// Only the directories along the changed paths are rewritten and stored
+// locally, everything else is kept as a link to the existing blocks, which
+// are loaded through the Builder's Fetcher.
+func (b *Builder) Patch(ctx context.Context, root cid.Cid, ops []Op) (ipld.Node, error) {
+	tree := newPatchTree()
+	for _, op := range ops {
+		if err := tree.insert(op); err != nil {
+			return nil, err
+		}
+	}
+
+	nd, err := b.dserv.Get(ctx, root)
+	if err != nil {
+		return nil, fmt.Errorf("load root %s failed: %v", root, err)
+	}
+
+	return b.patchDir(ctx, nd, tree, "")
+}
+
+func (b *Builder) patchDir(ctx context.Context, nd ipld.Node, tree *patchTree, prefix string) (ipld.Node, error) {
+	ed, err := b.openDir(nd)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", displayPath(prefix), err)
+	}
+
+	// the links of added and replaced entries, with the size Kubo records
+	links := map[string]*ipld.Link{}
+	var unsized []*ipld.Link
+	for name, op := range tree.ops {
+		if op.Kind == OpRemove {
+			continue
+		}
+		links[name] = &ipld.Link{Name: name, Cid: op.Cid, Size: op.Size}
+		if op.Size == 0 {
+			unsized = append(unsized, links[name])
+		}
+	}
+	if err := b.setLinkSizes(ctx, unsized); err != nil {
+		return nil, fmt.Errorf("%s: %v", displayPath(prefix), err)
+	}
+
+	for _, name := range sortedKeys(tree.ops) {
+		op := tree.ops[name]
+		lnk, err := ed.find(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+
+		switch {
+		case op.Kind == OpAdd && lnk != nil:
+			return nil, fmt.Errorf("add %s: entry already exists", op.Path)
+		case op.Kind != OpAdd && lnk == nil:
+			return nil, fmt.Errorf("%s %s: entry does not exist", op.Kind, op.Path)
+		}
+
+		if op.Kind == OpRemove {
+			err = ed.remove(ctx, name)
+		} else {
+			err = ed.set(ctx, name, links[name])
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s %s failed: %v", op.Kind, op.Path, err)
+		}
+	}
+
+	for _, name := range sortedKeys(tree.children) {
+		sub := tree.children[name]
+		subPath := path.Join(prefix, name)
+
+		lnk, err := ed.find(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+
+		var child ipld.Node
+		switch {
+		case lnk != nil:
+			if child, err = b.dserv.Get(ctx, lnk.Cid); err != nil {
+				return nil, fmt.Errorf("load %s failed: %v", subPath, err)
+			}
+		case !sub.onlyAdds():
+			return nil, fmt.Errorf("%s: directory does not exist", subPath)
+		}
+
+		child, err = b.patchDir(ctx, child, sub, subPath)
+		if err != nil {
+			return nil, err
+		}
+		size, err := child.Size()
+		if err != nil {
+			return nil, err
+		}
+		if err := ed.set(ctx, name, &ipld.Link{Name: name, Cid: child.Cid(), Size: size}); err != nil {
+			return nil, err
+		}
+	}
+
+	return ed.node(ctx)
+}
+
+// openDir returns an editor for a basic or sharded directory node, a nil
+// node opens a new empty directory.
+func (b *Builder) openDir(nd ipld.Node) (dirEditor, error) {
+	if nd == nil {
+		pn := ft.EmptyDirNode()
+		if err := pn.SetCidBuilder(b.cidBuilder); err != nil {
+			return nil, err
+		}
+		return &basicEditor{pn, b}, nil
+	}
+
+	pn, ok := nd.(*merkledag.ProtoNode)
+	if !ok {
+		return nil, errors.New("not a directory")
+	}
+	fsn, err := ft.FSNodeFromBytes(pn.Data())
+	if err != nil {
+		return nil, err
+	}
+
+	switch fsn.Type() {
+	case ft.TDirectory:
+		return &basicEditor{pn.Copy().(*merkledag.ProtoNode), b}, nil
+	case ft.THAMTShard:
+		shard, err := hamt.NewHamtFromDag(b.dserv, nd)
+		if err != nil {
+			return nil, err
+		}
+		return &shardEditor{shard: shard, builder: b}, nil
+	default:
+		return nil, errors.New("not a directory")
+	}
+}
+
+// dirEditor edits the links of a single directory, find returns a nil link
+// when the entry does not exist.
+type dirEditor interface {
+	find(ctx context.Context, name string) (*ipld.Link, error)
+	set(ctx context.Context, name string, lnk *ipld.Link) error
+	remove(ctx context.Context, name string) error
+	node(ctx context.Context) (ipld.Node, error)
+}
+
+type basicEditor struct {
+	nd      *merkledag.ProtoNode
+	builder *Builder
+}
+
+func (e *basicEditor) find(_ context.Context, name string) (*ipld.Link, error) {
+	lnk, err := e.nd.GetNodeLink(name)
+	if err == merkledag.ErrLinkNotFound {
+		return nil, nil
+	}
+	return lnk, err
+}
+
+func (e *basicEditor) set(_ context.Context, name string, lnk *ipld.Link) error {
+	if err := e.nd.RemoveNodeLink(name); err != nil && err != merkledag.ErrLinkNotFound {
+		return err
+	}
+	return e.nd.AddRawLink(name, lnk)
+}
+
+func (e *basicEditor) remove(_ context.Context, name string) error {
+	return e.nd.RemoveNodeLink(name)
+}
+
+// node stores the edited directory, switching to a HAMT shard when it grew
+// past the threshold. A directory that stays basic keeps its UnixFS data,
+// and so its mode and mtime.
+func (e *basicEditor) node(ctx context.Context) (ipld.Node, error) {
+	if e.builder.shouldShard(e.nd.Links()) {
+		return e.builder.makeDir(ctx, e.nd.Links(), e.nd.CidBuilder())
+	}
+	if err := e.builder.dserv.Add(ctx, e.nd); err != nil {
+		return nil, err
+	}
+	return e.nd, nil
+}
+
+type shardEditor struct {
+	shard   *hamt.Shard
+	builder *Builder
+	removed bool
+}
+
+func (e *shardEditor) find(ctx context.Context, name string) (*ipld.Link, error) {
+	lnk, err := e.shard.Find(ctx, name)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	return lnk, err
+}
+
+func (e *shardEditor) set(ctx context.Context, name string, lnk *ipld.Link) error {
+	return e.shard.SetLink(ctx, name, lnk)
+}
+
+func (e *shardEditor) remove(ctx context.Context, name string) error {
+	e.removed = true
+	return e.shard.Remove(ctx, name)
+}
+
+// node stores the edited shard. Like Kubo, a shard that shrank below the
+// threshold goes back to a basic directory, which needs all of its links.
+func (e *shardEditor) node(ctx context.Context) (ipld.Node, error) {
+	if e.removed {
+		links, err := e.shard.EnumLinks(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if !e.builder.shouldShard(links) {
+			return e.builder.makeDir(ctx, links, e.shard.CidBuilder())
+		}
+	}
+	return e.shard.Node()
+}
+
+// patchTree groups ops by directory so every directory is rewritten once.
+type patchTree struct {
+	ops      map[string]Op
+	children map[string]*patchTree
+}
+
+func newPatchTree() *patchTree {
+	return &patchTree{ops: map[string]Op{}, children: map[string]*patchTree{}}
+}
+
+func (t *patchTree) insert(op Op) error {
+	clean := strings.Trim(path.Clean("/"+op.Path), "/")
+	if clean == "" {
+		return fmt.Errorf("invalid path: %q", op.Path)
+	}
+	if op.Kind != OpRemove && !op.Cid.Defined() {
+		return fmt.Errorf("%s %s: undefined cid", op.Kind, op.Path)
+	}
+	op.Path = clean
+
+	segments := strings.Split(clean, "/")
+	node := t
+	for _, seg := range segments[:len(segments)-1] {
+		if _, ok := node.ops[seg]; ok {
+			return fmt.Errorf("conflicting operations on %s", op.Path)
+		}
+		sub, ok := node.children[seg]
+		if !ok {
+			sub = newPatchTree()
+			node.children[seg] = sub
+		}
+		node = sub
+	}
+
+	name := segments[len(segments)-1]
+	if _, ok := node.ops[name]; ok {
+		return fmt.Errorf("conflicting operations on %s", op.Path)
+	}
+	if _, ok := node.children[name]; ok {
+		return fmt.Errorf("conflicting operations on %s", op.Path)
+	}
+	node.ops[name] = op
+
+	return nil
+}
+
+// onlyAdds reports whether the subtree can be created from scratch.
+func (t *patchTree) onlyAdds() bool {
+	for _, op := range t.ops {
+		if op.Kind != OpAdd {
+			return false
+		}
+	}
+	for _, sub := range t.children {
+		if !sub.onlyAdds() {
+			return false
+		}
+	}
+	return true
+}
+
+// Patch describes an update of a pinned directory.
+type Patch struct {
+	// Root is the directory being updated.
+	Root cid.Cid
+	// Ops are the changes, applied in a single pass.
+	Ops []Op
+	// Fetcher loads the existing directory nodes, it defaults to a
+	// GatewayFetcher on DefaultGateway. An OfflinePinner needs one.
+	Fetcher Fetcher
+	// UnpinOld unpins Root once the new root has been pinned.
+	UnpinOld bool
+}
+
+// PinPatch applies the patch and pins the rewritten directory nodes only.
+// If UnpinOld is set and unpinning fails, the new result is still returned
+// together with the error.
+//
+// Example:
+//
+// > result, err := dag.PinPatch(ctx, pinner, dag.Patch{
+// >	Root: bundleCid,
+// >	Ops: []dag.Op{
+// >		dag.ReplaceEntry("js/app.js", appCid),
+// >		dag.RemoveEntry("js/app.js.map"),
+// >	},
+// >	UnpinOld: true,
+// > })
+func PinPatch(ctx context.Context, p pinners.Pinner, patch Patch) (pinners.Result, error) {
+	fetcher := patch.Fetcher
+	if fetcher == nil {
+		var err error
+		if fetcher, err = defaultFetcher(p); err != nil {
+			return nil, err
+		}
+	}
+	b := NewBuilder()
+	b.SetFetcher(fetcher)
+
+	nd, err := b.Patch(ctx, patch.Root, patch.Ops)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := b.Pin(ctx, p, nd.Cid())
+	if err != nil {
+		return nil, err
+	}
+
+	if patch.UnpinOld && !nd.Cid().Equals(patch.Root) {
+		up, ok := p.(pinners.Unpinner)
+		if !ok {
+			return result, fmt.Errorf("%s: pinner does not support unpinning", p.Name())
+		}
+		if err := up.Unpin(patch.Root.String()); err != nil {
+			return result, fmt.Errorf("unpin old root %s failed: %w", patch.Root, err)
+		}
+	}
+
+	return result, nil
+}
+
+func displayPath(p string) string {
+	if p == "" {
+		return "/"
+	}
+	return p
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,215 @@
+package dag
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/heilart1n/justpin-ipfs/pinners"
+	"github.com/ipfs/boxo/ipld/merkledag"
+	ft "github.com/ipfs/boxo/ipld/unixfs"
+	"github.com/ipfs/go-cid"
+	ipld "github.com/ipfs/go-ipld-format"
+)
+
+// carPinner counts the blocks of the CARs it gets and the roots unpinned.
+type carPinner struct {
+	pinners.Pinner
+	blocks   int
+	unpinned []string
+}
+
+type cidResult string
+
+func (r cidResult) GetHash() string { return string(r) }
+func (r cidResult) GetLink() string { return "" }
+
+func (p *carPinner) Name() string { return "car" }
+
+// PinCAR counts the block sections of the CAR, the first one is the root
+// as WriteCAR visits parents first.
+func (p *carPinner) PinCAR(rd io.Reader) (pinners.Result, error) {
+	br := bufio.NewReader(rd)
+	var root cid.Cid
+	for i := 0; ; i++ {
+		n, err := binary.ReadUvarint(br)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		section := make([]byte, n)
+		if _, err := io.ReadFull(br, section); err != nil {
+			return nil, err
+		}
+		if i == 0 {
+			continue // header
+		}
+		_, c, err := cid.CidFromBytes(section)
+		if err != nil {
+			return nil, err
+		}
+		if i == 1 {
+			root = c
+		}
+		p.blocks++
+	}
+	return cidResult(root.String()), nil
+}
+
+func (p *carPinner) Unpin(hash string) error {
+	p.unpinned = append(p.unpinned, hash)
+	return nil
+}
+
+// patchFixture holds the files of the patch tests, and the directory tree
+// a/b/sub built from them.
+type patchFixture struct {
+	src              *Builder
+	a, b, c, n, root cid.Cid
+}
+
+func newPatchFixture(t *testing.T) *patchFixture {
+	t.Helper()
+	f := &patchFixture{src: NewBuilder()}
+	for _, file := range []struct {
+		c       *cid.Cid
+		content string
+	}{
+		{&f.a, "a"},
+		{&f.b, strings.Repeat("b", 1<<20)},
+		{&f.c, "c"},
+		{&f.n, strings.Repeat("n", 300_000)},
+	} {
+		*file.c = addFile(t, f.src, file.content).Cid()
+	}
+	f.root = f.dir(t, map[string]cid.Cid{
+		"a.txt": f.a,
+		"b.bin": f.b,
+		"sub":   f.dir(t, map[string]cid.Cid{"c.txt": f.c}),
+	})
+	return f
+}
+
+func (f *patchFixture) dir(t *testing.T, entries map[string]cid.Cid) cid.Cid {
+	t.Helper()
+	nd, err := f.src.Directory(context.Background(), entries)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return nd.Cid()
+}
+
+// patchOps replaces, removes and adds files at several depths.
+func patchOps(f *patchFixture) []Op {
+	return []Op{
+		ReplaceEntry("a.txt", f.n),
+		RemoveEntry("b.bin"),
+		AddEntry("sub/d/e.txt", f.a),
+		AddEntry("new/x.txt", f.c),
+	}
+}
+
+func TestPatchMatchesRebuild(t *testing.T) {
+	ctx := context.Background()
+	f := newPatchFixture(t)
+
+	// The tree is only known to the Builder through its Fetcher.
+	b := NewBuilder()
+	b.SetFetcher(builderFetcher{f.src})
+	got, err := b.Patch(ctx, f.root, patchOps(f))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := f.dir(t, map[string]cid.Cid{
+		"a.txt": f.n,
+		"sub": f.dir(t, map[string]cid.Cid{
+			"c.txt": f.c,
+			"d":     f.dir(t, map[string]cid.Cid{"e.txt": f.a}),
+		}),
+		"new": f.dir(t, map[string]cid.Cid{"x.txt": f.c}),
+	})
+	if !got.Cid().Equals(want) {
+		t.Errorf("patched %s, want %s as rebuilt", got.Cid(), want)
+	}
+
+	for _, ops := range [][]Op{
+		{AddEntry("a.txt", f.c)},
+		{ReplaceEntry("missing", f.c)},
+		{RemoveEntry("sub/missing")},
+		{ReplaceEntry("a.txt", f.c), RemoveEntry("a.txt")},
+		{RemoveEntry("")},
+	} {
+		if _, err := b.Patch(ctx, f.root, ops); err == nil {
+			t.Errorf("%v: no error", ops)
+		}
+	}
+}
+
+func TestPatchKeepsAttributes(t *testing.T) {
+	ctx := context.Background()
+	f := newPatchFixture(t)
+
+	// UnixFS 1.5 mode 0750 and mtime, after the fields of a directory
+	data := ft.FolderPBData()
+	data = binary.AppendUvarint(data, 7<<3|0)
+	data = binary.AppendUvarint(data, 0o750)
+	data = append(data, 8<<3|2, 6, 1<<3|0)
+	data = binary.AppendUvarint(data, 1700000000)
+	root := merkledag.NodeWithData(data)
+	root.SetCidBuilder(f.src.cidBuilder)
+	if err := root.AddRawLink("a.txt", &ipld.Link{Cid: f.a, Size: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.src.dserv.Add(ctx, root); err != nil {
+		t.Fatal(err)
+	}
+
+	b := NewBuilder()
+	b.SetFetcher(builderFetcher{f.src})
+	got, err := b.Patch(ctx, root.Cid(), []Op{AddEntry("c.txt", f.c)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got.(*merkledag.ProtoNode).Data(), data) {
+		t.Errorf("patched directory lost its mode and mtime")
+	}
+	if len(got.Links()) != 2 {
+		t.Errorf("%d links, want 2", len(got.Links()))
+	}
+}
+
+func TestPinPatch(t *testing.T) {
+	ctx := context.Background()
+	f := newPatchFixture(t)
+	p := &carPinner{}
+	result, err := PinPatch(ctx, p, Patch{
+		Root:     f.root,
+		Ops:      patchOps(f),
+		Fetcher:  builderFetcher{f.src},
+		UnpinOld: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b := NewBuilder()
+	b.SetFetcher(builderFetcher{f.src})
+	want, err := b.Patch(ctx, f.root, patchOps(f))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// root, sub, sub/d and new are rewritten, the files are linked only
+	if result.GetHash() != want.Cid().String() || p.blocks != 4 {
+		t.Errorf("pinned %s with %d blocks, want %s with 4", result.GetHash(), p.blocks, want.Cid())
+	}
+	if len(p.unpinned) != 1 || p.unpinned[0] != f.root.String() {
+		t.Errorf("unpinned %v, want %s", p.unpinned, f.root)
+	}
+}
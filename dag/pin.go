@@ -0,0 +1,86 @@
+package dag
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/heilart1n/justpin-ipfs/pinners"
+	"github.com/ipfs/go-cid"
+)
+
+// Pin uploads the local blocks reachable from root to the pinner. A single
+// block goes through `dag/put` when the pinner supports it, anything else is
+// sent as a CAR.
+func (b *Builder) Pin(ctx context.Context, p pinners.Pinner, root cid.Cid) (pinners.Result, error) {
+	count, err := b.Blocks(ctx, root)
+	if err != nil {
+		return nil, err
+	}
+	if count == 0 {
+		return nil, fmt.Errorf("root %s is not held locally", root)
+	}
+
+	if bp, ok := p.(pinners.BlockPinner); ok && count == 1 {
+		if codec, ok := codecNames[root.Prefix().Codec]; ok {
+			blk, err := b.bstore.Get(ctx, root)
+			if err != nil {
+				return nil, err
+			}
+			return bp.PinBlock(codec, blk.RawData())
+		}
+	}
+
+	cp, ok := p.(pinners.CARPinner)
+	if !ok {
+		return nil, fmt.Errorf("%s: pinner does not accept CARs", p.Name())
+	}
+
+	car := b.CARReader(ctx, root)
+	defer car.Close()
+
+	return cp.PinCAR(car)
+}
+
+// PinDirectory composes a UnixFS directory from already pinned CIDs and pins
+// the new directory block only. The root blocks of the entries are read
+// from DefaultGateway for their sizes, so it fails with an OfflinePinner.
+//
+// Example:
+//
+// > result, err := dag.PinDirectory(ctx, pinner, map[string]cid.Cid{
+// >	"logo.png": logoCid,
+// >	"app.js":   appCid,
+// > })
+func PinDirectory(ctx context.Context, p pinners.Pinner, entries map[string]cid.Cid) (pinners.Result, error) {
+	fetcher, err := defaultFetcher(p)
+	if err != nil {
+		return nil, err
+	}
+	b := NewBuilder()
+	b.SetFetcher(fetcher)
+	nd, err := b.Directory(ctx, entries)
+	if err != nil {
+		return nil, err
+	}
+	return b.Pin(ctx, p, nd.Cid())
+}
+
+// codecNames maps codecs to the names used by the `dag/put` API.
+var codecNames = map[uint64]string{
+	cid.DagProtobuf: "dag-pb",
+	cid.Raw:         "raw",
+}
+
+// SameCid reports whether a and b are the same content, CIDv0 and CIDv1 of
+// the same node included, as providers may report either.
+func SameCid(a, b string) bool {
+	ca, err := cid.Decode(a)
+	if err != nil {
+		return false
+	}
+	cb, err := cid.Decode(b)
+	if err != nil {
+		return false
+	}
+	return ca.Type() == cb.Type() && ca.Hash().HexString() == cb.Hash().HexString()
+}
@@ -0,0 +1,286 @@
+package deploy
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/heilart1n/justpin-ipfs/file"
+	"golang.org/x/net/html"
+)
+
+// IndexFile is the page gateways serve for a directory.
+const IndexFile = "index.html"
+
+// Problem is something wrong with a file of a site.
+type Problem struct {
+	Path    string
+	Line    int // 0 when it doesn't apply
+	Message string
+}
+
+func (p Problem) String() string {
+	if p.Line > 0 {
+		return fmt.Sprintf("%s:%d: %s", p.Path, p.Line, p.Message)
+	}
+	return fmt.Sprintf("%s: %s", p.Path, p.Message)
+}
+
+// CheckError lists the problems found by Check.
+type CheckError struct {
+	Problems []Problem
+}
+
+func (e *CheckError) Error() string {
+	lines := make([]string, len(e.Problems))
+	for i, p := range e.Problems {
+		lines[i] = p.String()
+	}
+	return fmt.Sprintf("site check failed:\n\t%s", strings.Join(lines, "\n\t"))
+}
+
+// linkAttrs are the attributes of HTML elements pointing to other files.
+var linkAttrs = map[string]bool{"href": true, "src": true, "srcset": true, "poster": true, "data": true}
+
+// site is the content of a site directory as it will be pinned.
+type site struct {
+	node      *file.Node
+	files     map[string]bool
+	dirs      map[string]bool
+	redirects []Redirect
+}
+
+// Check validates the static site in dir, walked with opts like it will be
+// pinned: the root has an index.html, relative links of the HTML pages
+// point to files of the site, and _redirects holds valid rules. It returns a
+// *CheckError listing every problem found.
+func Check(dir string, opts ...file.Option) error {
+	node, err := file.NewSerialFile(dir, opts...)
+	if err != nil {
+		return err
+	}
+	if !node.IsDir() {
+		return fmt.Errorf("%s is not a directory", dir)
+	}
+	return check(node)
+}
+
+func check(node *file.Node) error {
+	s := &site{node: node, files: map[string]bool{}, dirs: map[string]bool{"": true}}
+	var pages []string
+	_ = node.Walk(func(fp string, fi os.FileInfo) error {
+		if fi.IsDir() {
+			s.dirs[fp] = true
+			return nil
+		}
+		s.files[fp] = true
+		for dir := path.Dir(fp); dir != "."; dir = path.Dir(dir) {
+			s.dirs[dir] = true
+		}
+		if ext := strings.ToLower(path.Ext(fp)); ext == ".html" || ext == ".htm" {
+			pages = append(pages, fp)
+		}
+		return nil
+	})
+
+	var problems []Problem
+	if !s.files[IndexFile] {
+		problems = append(problems, Problem{Path: IndexFile, Message: "missing, gateways would list the directory instead"})
+	}
+	if s.files[RedirectsFile] {
+		rules, ps, err := s.readRedirects()
+		if err != nil {
+			return err
+		}
+		s.redirects = rules
+		problems = append(problems, ps...)
+	}
+	for _, page := range pages {
+		ps, err := s.checkPage(page)
+		if err != nil {
+			return fmt.Errorf("read %s failed: %v", page, err)
+		}
+		problems = append(problems, ps...)
+	}
+
+	if len(problems) > 0 {
+		sort.SliceStable(problems, func(i, j int) bool {
+			if problems[i].Path != problems[j].Path {
+				return problems[i].Path < problems[j].Path
+			}
+			return problems[i].Line < problems[j].Line
+		})
+		return &CheckError{Problems: problems}
+	}
+	return nil
+}
+
+func (s *site) readRedirects() ([]Redirect, []Problem, error) {
+	f, err := s.node.Open(RedirectsFile)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+
+	data, err := io.ReadAll(io.LimitReader(f, maxRedirectsSize+1))
+	if err != nil {
+		return nil, nil, err
+	}
+	rules, problems := ParseRedirects(data)
+	for _, rule := range rules {
+		to := rule.To
+		if !strings.HasPrefix(to, "/") || strings.Contains(to, ":") {
+			continue // external or filled from the request
+		}
+		if !s.exists(strings.TrimPrefix(to, "/"), strings.HasSuffix(to, "/")) {
+			problems = append(problems, Problem{Path: RedirectsFile, Line: rule.Line, Message: fmt.Sprintf("target %s not found", to)})
+		}
+	}
+	return rules, problems, nil
+}
+
+// checkPage reports the links of the page at fp that don't resolve.
+func (s *site) checkPage(fp string) ([]Problem, error) {
+	f, err := s.node.Open(fp)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var problems []Problem
+	dir := path.Dir(fp) // relative links resolve against it
+	z := html.NewTokenizer(f)
+	for {
+		switch z.Next() {
+		case html.ErrorToken:
+			if z.Err() == io.EOF {
+				return problems, nil
+			}
+			return problems, z.Err()
+		case html.StartTagToken, html.SelfClosingTagToken:
+			tag, hasAttr := z.TagName()
+			if string(tag) == "base" {
+				for hasAttr {
+					var key, val []byte
+					key, val, hasAttr = z.TagAttr()
+					if string(key) != "href" {
+						continue
+					}
+					var msg string
+					if dir, msg = baseDir(dir, strings.TrimSpace(string(val))); msg != "" {
+						problems = append(problems, Problem{Path: fp, Message: fmt.Sprintf("base %q %s", val, msg)})
+					}
+				}
+				if dir == "" {
+					return problems, nil // links resolve against another site
+				}
+				continue
+			}
+			for hasAttr {
+				var key, val []byte
+				key, val, hasAttr = z.TagAttr()
+				if !linkAttrs[string(key)] {
+					continue
+				}
+				for _, link := range links(string(key), string(val)) {
+					if msg := s.resolve(dir, link); msg != "" {
+						problems = append(problems, Problem{Path: fp, Message: fmt.Sprintf("link %q %s", link, msg)})
+					}
+				}
+			}
+		}
+	}
+}
+
+// links returns the URLs of an attribute value, srcset holds several.
+func links(attr, val string) []string {
+	if attr != "srcset" {
+		return []string{strings.TrimSpace(val)}
+	}
+	var urls []string
+	for _, candidate := range strings.Split(val, ",") {
+		if fields := strings.Fields(candidate); len(fields) > 0 {
+			urls = append(urls, fields[0])
+		}
+	}
+	return urls
+}
+
+// baseDir returns the directory that links resolve against after a
+// `<base href>`, from dir before it. It is "" when they resolve against
+// another site, with why when href is invalid.
+func baseDir(dir, href string) (string, string) {
+	u, err := url.Parse(href)
+	if err != nil {
+		return "", "is not a valid URL"
+	}
+	if u.Scheme != "" || u.Host != "" {
+		return "", ""
+	}
+	if u.Path == "" {
+		return dir, ""
+	}
+	p := u.Path
+	if !strings.HasPrefix(p, "/") {
+		p = path.Join(dir, p)
+		if strings.HasPrefix(p, "..") {
+			return "", "points outside of the site"
+		}
+	}
+	if !strings.HasSuffix(u.Path, "/") {
+		p = path.Dir(p)
+	}
+	if p = strings.Trim(path.Clean("/"+p), "/"); p == "" {
+		p = "."
+	}
+	return p, ""
+}
+
+// resolve returns why link, found in a page whose links resolve against
+// dir, doesn't resolve, or "" when it does or isn't a link to the site.
+func (s *site) resolve(dir, link string) string {
+	if link == "" || strings.HasPrefix(link, "#") {
+		return ""
+	}
+	u, err := url.Parse(link)
+	if err != nil {
+		return "is not a valid URL"
+	}
+	if u.Scheme != "" || u.Host != "" || u.Path == "" {
+		return ""
+	}
+
+	var target string
+	if strings.HasPrefix(u.Path, "/") {
+		target = path.Clean(u.Path)
+	} else {
+		target = path.Join("/", dir, u.Path)
+		if strings.HasPrefix(path.Join(dir, u.Path), "..") {
+			return "points outside of the site"
+		}
+	}
+	for _, rule := range s.redirects {
+		if rule.match(target) {
+			return ""
+		}
+	}
+
+	if !s.exists(strings.TrimPrefix(target, "/"), strings.HasSuffix(u.Path, "/")) {
+		return "not found"
+	}
+	return ""
+}
+
+// exists reports whether p, relative to the root, is a file or a directory
+// with an index.html. A trailing slash asks for the directory.
+func (s *site) exists(p string, dir bool) bool {
+	p = strings.Trim(path.Clean("/"+p), "/")
+	if !dir && s.files[p] {
+		return true
+	}
+	return s.dirs[p] && s.files[path.Join(p, IndexFile)]
+}
@@ -0,0 +1,136 @@
+// Package deploy publishes static websites: it checks a site directory,
+// pins it to several providers and reports the URLs it is served at.
+package deploy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/heilart1n/justpin-ipfs/dag"
+	"github.com/heilart1n/justpin-ipfs/file"
+	"github.com/heilart1n/justpin-ipfs/pinners"
+	"github.com/ipfs/go-cid"
+	"github.com/multiformats/go-multibase"
+)
+
+const (
+	// DefaultPathGateway serves content at /ipfs/<cid>/.
+	DefaultPathGateway = "https://ipfs.io"
+	// DefaultSubdomainGateway serves content at <cid>.ipfs.<host>, with an
+	// origin of its own per site.
+	DefaultSubdomainGateway = "https://dweb.link"
+)
+
+// ErrRootMismatch is reported for a pinner whose pin doesn't have the root
+// computed locally, e.g. when the provider wrapped the site in a directory.
+var ErrRootMismatch = errors.New("pinned root differs from site root")
+
+// Report is the outcome of Deploy.
+type Report struct {
+	// Root is the CID of the site, computed locally.
+	Root string
+	// Results are the pins by pinner name.
+	Results map[string]pinners.Result
+	// Errors are the failed pins by pinner name. A pin whose root isn't
+	// Root is in Results too, with an error wrapping ErrRootMismatch.
+	Errors map[string]error
+}
+
+// Deploy checks the site in dir, then pins it to every pinner. The site is
+// walked with opts for both, whatever walk options the pinners have. It
+// fails without pinning anything when Check does, and otherwise returns the
+// report along with the errors of the pinners that failed or pinned another
+// root.
+func Deploy(dir string, targets []pinners.Pinner, opts ...file.Option) (*Report, error) {
+	if len(targets) == 0 {
+		return nil, fmt.Errorf("no pinners to deploy to")
+	}
+	if err := Check(dir, opts...); err != nil {
+		return nil, err
+	}
+
+	ctx := context.Background()
+	root, err := dag.Manifest(ctx, dir, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("compute root failed: %v", err)
+	}
+
+	report := &Report{Root: root.Root, Results: map[string]pinners.Result{}, Errors: map[string]error{}}
+	var errs []error
+	for _, p := range targets {
+		result, err := pin(ctx, p, dir, opts)
+		if err != nil {
+			err = fmt.Errorf("%s: %w", p.Name(), err)
+			report.Errors[p.Name()] = err
+			errs = append(errs, err)
+			continue
+		}
+		report.Results[p.Name()] = result
+		if !dag.SameCid(result.GetHash(), root.Root) {
+			err = fmt.Errorf("%s: %w: %s != %s", p.Name(), ErrRootMismatch, result.GetHash(), root.Root)
+			report.Errors[p.Name()] = err
+			errs = append(errs, err)
+		}
+	}
+
+	return report, errors.Join(errs...)
+}
+
+// pin pins dir to p with opts, as files when p takes a file.Node or else as
+// a CAR built locally.
+func pin(ctx context.Context, p pinners.Pinner, dir string, opts []file.Option) (pinners.Result, error) {
+	node, err := file.NewSerialFile(dir, opts...)
+	if err != nil {
+		return nil, err
+	}
+	if np, ok := p.(pinners.NodePinner); ok {
+		return np.PinNode(node)
+	}
+
+	b := dag.NewBuilder()
+	nd, err := b.AddNode(ctx, node)
+	if err != nil {
+		return nil, err
+	}
+	return b.Pin(ctx, p, nd.Cid())
+}
+
+// PathURL returns the URL of the site on a path gateway, such as
+// DefaultPathGateway.
+func (r *Report) PathURL(gateway string) string {
+	return strings.TrimSuffix(gateway, "/") + "/ipfs/" + r.Root + "/"
+}
+
+// SubdomainURL returns the URL of the site on a subdomain gateway, such as
+// DefaultSubdomainGateway. The CID is given in base32, as DNS labels are
+// case-insensitive.
+func (r *Report) SubdomainURL(gateway string) (string, error) {
+	u, err := url.Parse(gateway)
+	if err != nil || u.Host == "" {
+		return "", fmt.Errorf("invalid gateway: %s", gateway)
+	}
+	c, err := cid.Decode(r.Root)
+	if err != nil {
+		return "", err
+	}
+	label, err := cid.NewCidV1(c.Type(), c.Hash()).StringOfBase(multibase.Base32)
+	if err != nil {
+		return "", err
+	}
+	if len(label) > 63 {
+		return "", fmt.Errorf("cid %s is too long for a DNS label", label)
+	}
+
+	u.Host = label + ".ipfs." + u.Host
+	u.Path = "/"
+	return u.String(), nil
+}
+
+// DNSLink returns the value of the `_dnslink` TXT record pointing a domain
+// to the site.
+func (r *Report) DNSLink() string {
+	return "dnslink=/ipfs/" + r.Root
+}
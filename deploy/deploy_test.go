@@ -0,0 +1,94 @@
+package deploy
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/heilart1n/justpin-ipfs/file"
+	"github.com/heilart1n/justpin-ipfs/pinners"
+	"github.com/heilart1n/justpin-ipfs/pinners/dryrun"
+)
+
+// writeSite writes files to a new directory and returns it.
+func writeSite(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		fp := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(fp), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(fp, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+// wrappingPinner pins a site inside another directory, like a provider
+// wrapping uploads.
+type wrappingPinner struct {
+	*dryrun.Client
+}
+
+func (p wrappingPinner) Name() string { return "wrapping" }
+
+func (p wrappingPinner) PinNode(node *file.Node) (pinners.Result, error) {
+	return p.Client.PinWithBytes([]byte("not the site"))
+}
+
+func TestDeployVerifiesRoot(t *testing.T) {
+	dir := writeSite(t, map[string]string{"index.html": "<p>hello</p>"})
+
+	report, err := Deploy(dir, []pinners.Pinner{dryrun.NewClient(nil), wrappingPinner{dryrun.NewClient(nil)}})
+	if !errors.Is(err, ErrRootMismatch) {
+		t.Fatalf("Deploy = %v, want ErrRootMismatch", err)
+	}
+	if got := report.Results[dryrun.ClientName]; got == nil || got.GetHash() != report.Root {
+		t.Errorf("dry run pinned %v, want %s", got, report.Root)
+	}
+	if _, ok := report.Errors[dryrun.ClientName]; ok {
+		t.Errorf("dry run reported %v", report.Errors[dryrun.ClientName])
+	}
+	if !errors.Is(report.Errors["wrapping"], ErrRootMismatch) {
+		t.Errorf("wrapping pinner reported %v", report.Errors["wrapping"])
+	}
+	if report.Results["wrapping"] == nil {
+		t.Error("mismatched pin missing from Results")
+	}
+}
+
+func TestCheckBase(t *testing.T) {
+	tests := []struct {
+		name, page string
+		problem    string
+	}{
+		{"relative to base", `<base href="/docs/"><a href="a.html">`, ""},
+		{"missing below base", `<base href="/docs/"><a href="b.html">`, `"b.html" not found`},
+		{"base file", `<base href="/docs/index.html"><a href="a.html">`, ""},
+		{"relative base", `<base href="docs/"><a href="a.html">`, ""},
+		{"absolute links ignore base", `<base href="/docs/"><a href="/index.html">`, ""},
+		{"external base", `<base href="https://example.com/"><a href="nope.html">`, ""},
+		{"base outside", `<base href="../"><a href="a.html">`, "points outside of the site"},
+		{"no base", `<a href="a.html">`, `"a.html" not found`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := writeSite(t, map[string]string{
+				"index.html":      tt.page,
+				"docs/index.html": "",
+				"docs/a.html":     "",
+			})
+			err := Check(dir)
+			switch {
+			case tt.problem == "" && err != nil:
+				t.Errorf("Check = %v", err)
+			case tt.problem != "" && (err == nil || !strings.Contains(err.Error(), tt.problem)):
+				t.Errorf("Check = %v, want %q", err, tt.problem)
+			}
+		})
+	}
+}
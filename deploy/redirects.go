@@ -0,0 +1,129 @@
+package deploy
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// RedirectsFile is the name of the redirect rules read by IPFS gateways at
+// the root of a site.
+const RedirectsFile = "_redirects"
+
+// maxRedirectsSize is the largest _redirects file gateways accept.
+const maxRedirectsSize = 64 << 10
+
+// Redirect is a rule of a _redirects file.
+type Redirect struct {
+	From   string
+	To     string
+	Status int
+	Line   int
+}
+
+// ParseRedirects parses a _redirects file as specified for IPFS gateways:
+// one `from to [status]` rule per line, `:name` placeholders and a final
+// `*` splat in from. Every invalid line is reported as a Problem.
+func ParseRedirects(data []byte) ([]Redirect, []Problem) {
+	if len(data) > maxRedirectsSize {
+		return nil, []Problem{{Path: RedirectsFile, Message: fmt.Sprintf("file is larger than %d bytes", maxRedirectsSize)}}
+	}
+
+	var rules []Redirect
+	var problems []Problem
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		rule, err := parseRedirect(strings.Fields(text))
+		if err != nil {
+			problems = append(problems, Problem{Path: RedirectsFile, Line: line, Message: err.Error()})
+			continue
+		}
+		rule.Line = line
+		rules = append(rules, rule)
+	}
+
+	return rules, problems
+}
+
+func parseRedirect(fields []string) (Redirect, error) {
+	if len(fields) < 2 || len(fields) > 3 {
+		return Redirect{}, fmt.Errorf("want `from to [status]`, got %d fields", len(fields))
+	}
+	rule := Redirect{From: fields[0], To: fields[1], Status: 301}
+
+	if len(fields) == 3 {
+		status, err := strconv.Atoi(fields[2])
+		if err != nil {
+			return rule, fmt.Errorf("invalid status %q", fields[2])
+		}
+		rule.Status = status
+	}
+	switch rule.Status {
+	case 200, 404, 410, 451:
+		if !strings.HasPrefix(rule.To, "/") {
+			return rule, fmt.Errorf("status %d needs a path to serve, got %q", rule.Status, rule.To)
+		}
+	case 301, 302, 303, 307, 308:
+	default:
+		return rule, fmt.Errorf("unsupported status %d", rule.Status)
+	}
+
+	if !strings.HasPrefix(rule.From, "/") {
+		return rule, fmt.Errorf("from must be a path starting with /, got %q", rule.From)
+	}
+	placeholders := map[string]bool{}
+	segments := strings.Split(rule.From, "/")
+	for i, seg := range segments {
+		switch {
+		case seg == "*":
+			if i != len(segments)-1 {
+				return rule, fmt.Errorf("splat must end from, got %q", rule.From)
+			}
+			placeholders["splat"] = true
+		case strings.Contains(seg, "*"):
+			return rule, fmt.Errorf("splat must be a whole segment, got %q", rule.From)
+		case strings.HasPrefix(seg, ":"):
+			placeholders[seg[1:]] = true
+		}
+	}
+
+	if !strings.HasPrefix(rule.To, "/") {
+		u, err := url.Parse(rule.To)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return rule, fmt.Errorf("to must be a path or an http(s) URL, got %q", rule.To)
+		}
+	}
+	for _, seg := range strings.Split(rule.To, "/") {
+		if name, ok := strings.CutPrefix(seg, ":"); ok && !placeholders[name] {
+			return rule, fmt.Errorf("placeholder :%s is not set by from", name)
+		}
+	}
+
+	return rule, nil
+}
+
+// match reports whether the slash rooted path p is caught by the rule.
+func (r Redirect) match(p string) bool {
+	from := strings.Split(r.From, "/")
+	segs := strings.Split(p, "/")
+	for i, seg := range from {
+		if seg == "*" {
+			return true
+		}
+		if i >= len(segs) {
+			return false
+		}
+		if !strings.HasPrefix(seg, ":") && seg != segs[i] {
+			return false
+		}
+	}
+	return len(from) == len(segs)
+}
@@ -0,0 +1,399 @@
+package file
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"strings"
+	"sync"
+)
+
+// ArchiveFormat is the container format of an Archive.
+type ArchiveFormat int
+
+const (
+	// ArchiveAuto detects the format from the first bytes of the stream.
+	ArchiveAuto ArchiveFormat = iota
+	ArchiveTar
+	ArchiveTarGz
+	ArchiveZip
+)
+
+// String returns the name of the format.
+func (f ArchiveFormat) String() string {
+	switch f {
+	case ArchiveTar:
+		return "tar"
+	case ArchiveTarGz:
+		return "tar.gz"
+	case ArchiveZip:
+		return "zip"
+	}
+	return "auto"
+}
+
+// ErrArchiveLimit is wrapped by the errors of an Archive crossing one of its
+// ArchiveLimits.
+var ErrArchiveLimit = errors.New("archive exceeds limit")
+
+// ArchiveLimits bound what an Archive may expand to, against archive bombs.
+// Sizes are counted on the bytes actually read, not on what the headers
+// claim. Zero disables a limit.
+type ArchiveLimits struct {
+	// MaxEntries is the number of files and directories.
+	MaxEntries int
+	// MaxFileSize is the expanded size of a single file.
+	MaxFileSize int64
+	// MaxTotalSize is the expanded size of all files, and the most a zip
+	// read from a plain stream is copied to a temporary file.
+	MaxTotalSize int64
+	// MaxRatio is the expansion ratio of a compressed zip entry.
+	MaxRatio int64
+}
+
+// DefaultArchiveLimits are the limits of NewArchive.
+var DefaultArchiveLimits = ArchiveLimits{
+	MaxEntries:   100000,
+	MaxFileSize:  1 << 30,
+	MaxTotalSize: 4 << 30,
+	MaxRatio:     100,
+}
+
+// Archive is a tar, tar.gz or zip stream whose content is pinned as a
+// directory, without extracting it anywhere. Symlinks and hard links are an
+// error, as their targets can't be checked to stay in the archive, unless
+// SkipLinks leaves them out.
+//
+// An Archive is read once.
+//
+// Example:
+//
+// > f, err := os.Open("site.tar.gz")
+// >
+// > result, err := pinner.Pin(file.NewArchive(f))
+type Archive struct {
+	// Name names the directory for providers that show one, optional.
+	Name   string
+	Format ArchiveFormat
+	Limits ArchiveLimits
+	// SkipLinks leaves symlinks and hard links out instead of failing.
+	SkipLinks bool
+
+	r      io.Reader
+	closer io.Closer // releases the source once walked
+}
+
+// NewArchive returns an Archive reading r, with its format detected and
+// DefaultArchiveLimits.
+func NewArchive(r io.Reader) *Archive {
+	return &Archive{r: r, Limits: DefaultArchiveLimits}
+}
+
+// Walk calls fn for every directory and regular file of the archive in
+// archive order. name is the cleaned slash separated path of the entry, r
+// reads the content of a file and is nil for a directory.
+//
+// An entry whose path is absolute or leaves the archive with ".." is an
+// error, not skipped, and so is any other entry type, such as a device or
+// a sparse file.
+func (a *Archive) Walk(fn func(name string, fi fs.FileInfo, r io.Reader) error) error {
+	if a.r == nil {
+		return fmt.Errorf("archive already read")
+	}
+	src := a.r
+	a.r = nil
+	if a.closer != nil {
+		defer a.closer.Close()
+	}
+
+	r, format := src, a.Format
+	if format == ArchiveAuto {
+		br := bufio.NewReaderSize(src, 512)
+		var err error
+		if format, err = detectArchive(br); err != nil {
+			return err
+		}
+		r = br
+	}
+
+	w := &archiveWalker{limits: a.Limits, skipLinks: a.SkipLinks, fn: fn}
+	switch format {
+	case ArchiveTar:
+		return w.tar(r)
+	case ArchiveTarGz:
+		gz, err := gzip.NewReader(r)
+		if err != nil {
+			return fmt.Errorf("read gzip failed: %v", err)
+		}
+		defer gz.Close()
+		return w.tar(gz)
+	case ArchiveZip:
+		if _, ok := src.(io.ReadSeeker); ok {
+			if _, ok := src.(io.ReaderAt); ok {
+				r = src // sniffing doesn't matter to ReadAt
+			}
+		}
+		return w.zip(r)
+	}
+	return fmt.Errorf("unsupported archive format: %d", format)
+}
+
+// detectArchive sniffs the format from the magic numbers of br.
+func detectArchive(br *bufio.Reader) (ArchiveFormat, error) {
+	head, err := br.Peek(512)
+	if err != nil && err != io.EOF {
+		return ArchiveAuto, fmt.Errorf("read archive failed: %v", err)
+	}
+	switch {
+	case bytes.HasPrefix(head, []byte("PK\x03\x04")), bytes.HasPrefix(head, []byte("PK\x05\x06")):
+		return ArchiveZip, nil
+	case bytes.HasPrefix(head, []byte{0x1f, 0x8b}):
+		return ArchiveTarGz, nil
+	case len(head) >= 262 && string(head[257:262]) == "ustar":
+		return ArchiveTar, nil
+	}
+	return ArchiveAuto, fmt.Errorf("unrecognized archive format")
+}
+
+type archiveWalker struct {
+	limits    ArchiveLimits
+	skipLinks bool
+	fn        func(name string, fi fs.FileInfo, r io.Reader) error
+	entries   int
+	total     int64
+	tmp       *os.File // copy of a zip stream
+}
+
+// link fails on the link entry at name, unless links are skipped.
+func (w *archiveWalker) link(name string) error {
+	if w.skipLinks {
+		return nil
+	}
+	return fmt.Errorf("link in archive: %s, set SkipLinks to leave links out", name)
+}
+
+func (w *archiveWalker) tar(r io.Reader) error {
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("read tar failed: %v", err)
+		}
+
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			err = w.entry(hdr.Name, hdr.FileInfo(), nil)
+		case tar.TypeReg, tar.TypeRegA:
+			err = w.entry(hdr.Name, hdr.FileInfo(), tr)
+		case tar.TypeSymlink, tar.TypeLink:
+			err = w.link(hdr.Name)
+		case tar.TypeXGlobalHeader:
+			continue // pax records, e.g. the commit of `git archive`
+		default:
+			err = fmt.Errorf("unsupported entry type %q in archive: %s", hdr.Typeflag, hdr.Name)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (w *archiveWalker) zip(r io.Reader) error {
+	defer func() {
+		if w.tmp != nil {
+			w.tmp.Close()
+			os.Remove(w.tmp.Name())
+		}
+	}()
+	ra, size, err := w.readerAt(r)
+	if err != nil {
+		return err
+	}
+	zr, err := zip.NewReader(ra, size)
+	if err != nil {
+		return fmt.Errorf("read zip failed: %v", err)
+	}
+
+	for _, f := range zr.File {
+		fi := f.FileInfo()
+		switch {
+		case fi.IsDir():
+			err = w.entry(f.Name, fi, nil)
+		case fi.Mode().IsRegular():
+			err = w.zipFile(f)
+		case fi.Mode()&fs.ModeSymlink != 0:
+			err = w.link(f.Name)
+		default:
+			err = fmt.Errorf("unsupported entry type %s in archive: %s", fi.Mode().Type(), f.Name)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (w *archiveWalker) zipFile(f *zip.File) error {
+	if w.limits.MaxRatio > 0 && f.CompressedSize64 > 0 && f.UncompressedSize64/f.CompressedSize64 > uint64(w.limits.MaxRatio) {
+		return fmt.Errorf("%w: %s expands %d times, the limit is %d", ErrArchiveLimit, f.Name, f.UncompressedSize64/f.CompressedSize64, w.limits.MaxRatio)
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return fmt.Errorf("read zip entry %s failed: %v", f.Name, err)
+	}
+	defer rc.Close()
+
+	return w.entry(f.Name, f.FileInfo(), rc)
+}
+
+// readerAt gives random access to a zip, which keeps its index at the end.
+// A plain stream is copied to a temporary file, up to MaxTotalSize, removed
+// once the walk is done.
+func (w *archiveWalker) readerAt(r io.Reader) (io.ReaderAt, int64, error) {
+	if ra, ok := r.(io.ReaderAt); ok {
+		if s, ok := r.(io.Seeker); ok {
+			size, err := s.Seek(0, io.SeekEnd)
+			if err != nil {
+				return nil, 0, err
+			}
+			return ra, size, nil
+		}
+	}
+
+	tmp, err := os.CreateTemp("", "justpin-zip-")
+	if err != nil {
+		return nil, 0, err
+	}
+	w.tmp = tmp
+
+	lr := r
+	if w.limits.MaxTotalSize > 0 {
+		lr = io.LimitReader(r, w.limits.MaxTotalSize+1)
+	}
+	size, err := io.Copy(tmp, lr)
+	if err != nil {
+		return nil, 0, fmt.Errorf("read zip failed: %v", err)
+	}
+	if w.limits.MaxTotalSize > 0 && size > w.limits.MaxTotalSize {
+		return nil, 0, fmt.Errorf("%w: zip is larger than %d bytes", ErrArchiveLimit, w.limits.MaxTotalSize)
+	}
+	return tmp, size, nil
+}
+
+// entry checks the entry at name and passes it on with its content bounded
+// by the limits.
+func (w *archiveWalker) entry(name string, fi fs.FileInfo, r io.Reader) error {
+	if fi.IsDir() && (name == "./" || name == ".") {
+		return nil // the archive's own directory
+	}
+	clean, err := archivePath(name)
+	if err != nil {
+		return err
+	}
+	w.entries++
+	if w.limits.MaxEntries > 0 && w.entries > w.limits.MaxEntries {
+		return fmt.Errorf("%w: more than %d entries", ErrArchiveLimit, w.limits.MaxEntries)
+	}
+	if r != nil {
+		r = &limitedReader{r: r, name: clean, w: w}
+	}
+	return w.fn(clean, fi, r)
+}
+
+// archivePath cleans the path of an entry and rejects any that would land
+// outside of the archive's directory.
+func archivePath(name string) (string, error) {
+	p := strings.TrimSuffix(strings.TrimPrefix(name, "./"), "/")
+	if strings.Contains(p, `\`) || !fs.ValidPath(p) || p == "." {
+		return "", fmt.Errorf("unsafe path in archive: %q", name)
+	}
+	return p, nil
+}
+
+// limitedReader counts the bytes of a file against MaxFileSize and
+// MaxTotalSize.
+type limitedReader struct {
+	r    io.Reader
+	name string
+	n    int64
+	w    *archiveWalker
+}
+
+func (lr *limitedReader) Read(p []byte) (int, error) {
+	n, err := lr.r.Read(p)
+	lr.n += int64(n)
+	lr.w.total += int64(n)
+	if max := lr.w.limits.MaxFileSize; max > 0 && lr.n > max {
+		return n, fmt.Errorf("%w: %s is larger than %d bytes", ErrArchiveLimit, lr.name, max)
+	}
+	if max := lr.w.limits.MaxTotalSize; max > 0 && lr.w.total > max {
+		return n, fmt.Errorf("%w: files are larger than %d bytes at %s", ErrArchiveLimit, max, lr.name)
+	}
+	return n, err
+}
+
+// NewArchiveNode returns a directory Node streaming the files of a, each
+// read from the archive when Walk reaches it, in archive order, so nothing
+// is extracted or kept. Directories aren't listed. Like the Archive, the
+// Node is walked once, a retried upload fails.
+func NewArchiveNode(a *Archive) *Node {
+	return &Node{
+		stat:    &readerInfo{name: ".", dir: true},
+		archive: &archiveStream{archive: a},
+	}
+}
+
+// archiveStream hands out the file an archive Node is at in its Walk.
+type archiveStream struct {
+	archive *Archive
+
+	mutex sync.Mutex
+	name  string
+	r     io.Reader
+}
+
+func (s *archiveStream) walk(fn func(fp string, fi os.FileInfo) error) error {
+	seen := map[string]bool{}
+	return s.archive.Walk(func(name string, fi fs.FileInfo, r io.Reader) error {
+		if r == nil {
+			return nil // directories come with their files
+		}
+		if seen[name] {
+			return fmt.Errorf("duplicate entry in archive: %s", name)
+		}
+		seen[name] = true
+
+		s.set(name, r)
+		defer s.set("", nil)
+		return fn(name, fi)
+	})
+}
+
+func (s *archiveStream) set(name string, r io.Reader) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.name, s.r = name, r
+}
+
+func (s *archiveStream) open(fp string) (fs.File, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.r == nil || fp != s.name {
+		return nil, fmt.Errorf("entry %s is not being walked or already read", fp)
+	}
+	r := s.r
+	s.r = nil
+	return &readerFile{Reader: r, fi: &readerInfo{name: path.Base(fp)}}, nil
+}
@@ -0,0 +1,81 @@
+package file
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"io"
+	"io/fs"
+	"strings"
+	"testing"
+)
+
+func TestZipStream(t *testing.T) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	w, err := zw.Create("a.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write([]byte("hello"))
+	zw.Close()
+
+	var names []string
+	// a plain reader, neither a Seeker nor a ReaderAt
+	a := NewArchive(io.MultiReader(&buf))
+	err = a.Walk(func(name string, fi fs.FileInfo, r io.Reader) error {
+		names = append(names, name)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(names) != 1 || names[0] != "a.txt" {
+		t.Errorf("walked %v", names)
+	}
+}
+
+func TestArchiveEntryTypes(t *testing.T) {
+	walk := func(hdr *tar.Header) error {
+		var buf bytes.Buffer
+		tw := tar.NewWriter(&buf)
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		if err := tw.WriteHeader(&tar.Header{Name: "a.txt", Typeflag: tar.TypeReg, Mode: 0o644}); err != nil {
+			t.Fatal(err)
+		}
+		tw.Close()
+		return NewArchive(&buf).Walk(func(string, fs.FileInfo, io.Reader) error { return nil })
+	}
+
+	// git archive starts with the commit as a pax global header
+	if err := walk(&tar.Header{Typeflag: tar.TypeXGlobalHeader, PAXRecords: map[string]string{"comment": "abc"}}); err != nil {
+		t.Errorf("pax global header: %v", err)
+	}
+	for _, typ := range []byte{tar.TypeFifo, tar.TypeChar, tar.TypeBlock} {
+		err := walk(&tar.Header{Name: "dev", Typeflag: typ, Mode: 0o644})
+		if err == nil || !strings.Contains(err.Error(), "unsupported entry type") || !strings.Contains(err.Error(), "dev") {
+			t.Errorf("type %q: err = %v, want it reported", typ, err)
+		}
+	}
+
+	// Go can't write sparse entries, patch the type of a regular one.
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	tw.WriteHeader(&tar.Header{Name: "sparse", Typeflag: tar.TypeReg, Mode: 0o644, Format: tar.FormatGNU})
+	tw.Close()
+	data := buf.Bytes()
+	data[156] = tar.TypeGNUSparse
+	var sum int64
+	copy(data[148:156], "        ")
+	for _, c := range data[:512] {
+		sum += int64(c)
+	}
+	copy(data[148:156], fmt.Sprintf("%06o\x00 ", sum))
+	err := NewArchive(bytes.NewReader(data)).Walk(func(string, fs.FileInfo, io.Reader) error { return nil })
+	if err == nil || !strings.Contains(err.Error(), "unsupported entry type 'S' in archive: sparse") {
+		t.Errorf("sparse entry: err = %v, want it reported", err)
+	}
+}
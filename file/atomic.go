@@ -0,0 +1,49 @@
+package file
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// WriteFileAtomic writes data to a temporary file next to fp, then renames
+// it to fp: readers see either the old content or the new one, never a
+// partial write. The data is synced before the rename so a crash can't
+// leave fp empty either.
+func WriteFileAtomic(fp string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(fp), "."+filepath.Base(fp)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), fp)
+}
+
+// CountingReader counts the bytes read from R and keeps the last error,
+// io.EOF included, for callers that only see what a consumer of the reader
+// returns.
+type CountingReader struct {
+	R   io.Reader
+	N   int64
+	Err error
+}
+
+func (cr *CountingReader) Read(p []byte) (int, error) {
+	n, err := cr.R.Read(p)
+	cr.N += int64(n)
+	if err != nil {
+		cr.Err = err
+	}
+	return n, err
+}
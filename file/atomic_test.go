@@ -0,0 +1,41 @@
+package file
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWriteFileAtomic(t *testing.T) {
+	dir := t.TempDir()
+	fp := filepath.Join(dir, "state.json")
+	for _, content := range []string{"first", "second"} {
+		if err := WriteFileAtomic(fp, []byte(content)); err != nil {
+			t.Fatal(err)
+		}
+		data, err := os.ReadFile(fp)
+		if err != nil || string(data) != content {
+			t.Errorf("read %q, %v, want %q", data, err, content)
+		}
+	}
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 1 {
+		t.Errorf("temporary files left: %v", entries)
+	}
+
+	if err := WriteFileAtomic(filepath.Join(dir, "missing", "state.json"), nil); err == nil {
+		t.Errorf("wrote to a missing directory")
+	}
+}
+
+func TestCountingReader(t *testing.T) {
+	cr := &CountingReader{R: strings.NewReader("hello")}
+	if _, err := io.ReadAll(cr); err != nil {
+		t.Fatal(err)
+	}
+	if cr.N != 5 || cr.Err != io.EOF {
+		t.Errorf("counted %d, %v, want 5, EOF", cr.N, cr.Err)
+	}
+}
@@ -0,0 +1,50 @@
+package file
+
+import (
+	"os"
+	"time"
+)
+
+// Attributes are the UnixFS 1.5 metadata of an entry. Mode is recorded when
+// HasMode is set, so a mode of 0000 is kept, a zero Mtime is not recorded.
+type Attributes struct {
+	Mode    os.FileMode
+	HasMode bool
+	Mtime   time.Time
+}
+
+// IsZero reports whether there is nothing to record.
+func (a Attributes) IsZero() bool {
+	return !a.HasMode && a.Mtime.IsZero()
+}
+
+// UnixMode returns Mode as POSIX permission bits, including the setuid,
+// setgid and sticky bits, as stored in UnixFS.
+func (a Attributes) UnixMode() uint32 {
+	mode := uint32(a.Mode.Perm())
+	if a.Mode&os.ModeSetuid != 0 {
+		mode |= 0o4000
+	}
+	if a.Mode&os.ModeSetgid != 0 {
+		mode |= 0o2000
+	}
+	if a.Mode&os.ModeSticky != 0 {
+		mode |= 0o1000
+	}
+	return mode
+}
+
+// Attributes returns the metadata kept for fi, an entry passed to Walk or
+// the Stat of the Node. It is empty unless the Node was created with
+// PreserveMode or PreserveMtime.
+func (n *Node) Attributes(fi os.FileInfo) Attributes {
+	var attrs Attributes
+	if n.mode && fi.Mode()&os.ModeSymlink == 0 {
+		attrs.Mode = fi.Mode() & (os.ModePerm | os.ModeSetuid | os.ModeSetgid | os.ModeSticky)
+		attrs.HasMode = true
+	}
+	if n.mtime {
+		attrs.Mtime = fi.ModTime()
+	}
+	return attrs
+}
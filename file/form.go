@@ -0,0 +1,153 @@
+package file
+
+import (
+	"fmt"
+	"net/textproto"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Form describes the multipart payload a pinning service expects for file
+// and directory uploads. Each provider declares its own Form, so the
+// payload only carries what that provider documents.
+type Form struct {
+	// Fields are extra form fields written before the files, e.g. Pinata's
+	// `pinataOptions`.
+	Fields []FormField
+	// FileField is the form name of the file parts, "file" if empty.
+	FileField string
+	// Attachment uses "attachment" dispositions instead of "form-data".
+	Attachment bool
+	// Directories writes an `application/x-directory` part ahead of the
+	// content of every directory, as Kubo's `/api/v0/add` expects.
+	Directories bool
+	// Symlinks sends preserved symlinks as `application/symlink` parts. The
+	// upload fails on a preserved symlink without it.
+	Symlinks bool
+	// Attributes adds the preserved mode and mtime of an entry to its
+	// Content-Disposition, as Kubo's `/api/v0/add` reads them.
+	Attributes bool
+	// EncodePath encodes the file name of a part from its slash separated
+	// path, including the Node's mapped directory. Paths are sent as is if
+	// it's nil.
+	EncodePath func(p string) string
+}
+
+// FormField is a plain form field of a Form.
+type FormField struct {
+	Name        string
+	Value       string
+	ContentType string
+}
+
+// NewMultiForm constructs a MultiFileReader sending node as described by
+// form. Nothing is read from disk until the reader is read. It fails when
+// the form can't carry the node, see Check.
+//
+// Example:
+//
+// > node, err := file.NewSerialFile("directory-path")
+// >
+// > node.MapDirectory("a-dir-name-show-in-pinning-service")
+// >
+// > mfr, err := file.NewMultiForm(node, file.Form{FileField: "file"})
+func NewMultiForm(node *Node, form Form) (*MultiFileReader, error) {
+	if len(node.files) == 0 && node.archive == nil {
+		return nil, fmt.Errorf("node.files empty")
+	}
+	if err := form.Check(node); err != nil {
+		return nil, err
+	}
+	if form.FileField == "" {
+		form.FileField = "file"
+	}
+
+	mfr := newMultiFileReader(node, form, "")
+	for _, field := range form.Fields {
+		header := textproto.MIMEHeader{}
+		header.Set("Content-Disposition", fmt.Sprintf(`%s; name="%s"`, form.disposition(), field.Name))
+		if field.ContentType != "" {
+			header.Set("Content-Type", field.ContentType)
+		}
+		if err := mfr.Write(header, []byte(field.Value)); err != nil {
+			return nil, fmt.Errorf("error writing metadata headers: %v", err)
+		}
+	}
+
+	return mfr, nil
+}
+
+// Check reports an error when node holds something form would drop:
+// preserved symlinks without Symlinks, empty directories without
+// Directories, or a preserved mode or mtime without Attributes.
+func (form Form) Check(node *Node) error {
+	if !form.Attributes && (node.mode || node.mtime) {
+		return fmt.Errorf("mode and mtime are not supported by this form")
+	}
+	for i, fi := range node.files {
+		rel := filepath.ToSlash(node.paths[i])
+		switch {
+		case !form.Symlinks && fi.Mode()&os.ModeSymlink != 0:
+			return fmt.Errorf("symlinks are not supported by this form: %s", rel)
+		case !form.Directories && fi.IsDir() && node.emptyDir(i):
+			return fmt.Errorf("empty directories are not supported by this form: %s", rel)
+		}
+	}
+	return nil
+}
+
+// emptyDir reports whether the directory listed at i has nothing below it,
+// entries are listed ahead of their content.
+func (n *Node) emptyDir(i int) bool {
+	if i+1 == len(n.paths) {
+		return true
+	}
+	dir := filepath.ToSlash(n.paths[i]) + "/"
+	return !strings.HasPrefix(filepath.ToSlash(n.paths[i+1]), dir)
+}
+
+func (form Form) disposition() string {
+	if form.Attachment {
+		return "attachment"
+	}
+	return "form-data"
+}
+
+func (form Form) filename(p string) string {
+	if form.EncodePath != nil {
+		return form.EncodePath(p)
+	}
+	return p
+}
+
+// fileHeader returns the part header of the file or directory at p.
+func (form Form) fileHeader(p, contentType string, attrs Attributes) textproto.MIMEHeader {
+	disposition := fmt.Sprintf(`%s; name="%s"; filename="%s"`, form.disposition(), form.FileField, form.filename(p))
+	if form.Attributes {
+		if attrs.HasMode {
+			disposition += fmt.Sprintf("; mode=%04o", attrs.UnixMode())
+		}
+		if !attrs.Mtime.IsZero() {
+			disposition += fmt.Sprintf("; mtime=%d", attrs.Mtime.Unix())
+			if nsecs := attrs.Mtime.Nanosecond(); nsecs != 0 {
+				disposition += fmt.Sprintf("; mtime-nsecs=%d", nsecs)
+			}
+		}
+	}
+
+	header := textproto.MIMEHeader{}
+	header.Set("Content-Disposition", disposition)
+	header.Set("Content-Type", contentType)
+	return header
+}
+
+// parentDirs returns the ancestors of p from the top, p excluded.
+func parentDirs(p string) []string {
+	var dirs []string
+	for dir := path.Dir(p); dir != "." && dir != "/"; dir = path.Dir(dir) {
+		dirs = append([]string{dir}, dirs...)
+	}
+	return dirs
+}
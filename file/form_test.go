@@ -0,0 +1,43 @@
+package file
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFormCheck(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "full", "empty"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "full", "a.txt"), []byte("hello"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		opts []Option
+		form Form
+		ok   bool
+	}{
+		{"plain", nil, Form{}, true},
+		{"empty dirs", []Option{EmptyDirs()}, Form{}, false},
+		{"empty dirs with directories", []Option{EmptyDirs()}, Form{Directories: true}, true},
+		{"mode", []Option{PreserveMode()}, Form{}, false},
+		{"mtime", []Option{PreserveMtime()}, Form{Directories: true}, false},
+		{"attributes", []Option{PreserveMode(), PreserveMtime()}, Form{Attributes: true}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			node, err := NewSerialFile(dir, tt.opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = NewMultiForm(node, tt.form)
+			if (err == nil) != tt.ok {
+				t.Errorf("NewMultiForm = %v, ok %v", err, tt.ok)
+			}
+		})
+	}
+}
@@ -0,0 +1,105 @@
+package file
+
+import (
+	"fmt"
+	"io/fs"
+	"path"
+)
+
+// NewFSFile adopts the file or directory at root in fsys, such as an
+// embed.FS or a fstest.MapFS, and returns a Node like NewSerialFile does.
+// root is a slash separated path in fsys, "." for all of it.
+//
+// A fs.FS can't read links, entries it reports as symlinks are followed
+// through fs.Stat, or left out with SymlinkSkip.
+//
+// Example:
+//
+// > //go:embed site
+// > var site embed.FS
+// >
+// > node, err := file.NewFSFile(site, "site")
+func NewFSFile(fsys fs.FS, root string, opts ...Option) (node *Node, err error) {
+	node = &Node{root: root, fsys: fsys}
+	if !fs.ValidPath(root) {
+		return node, fmt.Errorf("invalid path: %s", root)
+	}
+	stat, err := fs.Stat(fsys, root)
+	if err != nil {
+		return node, fmt.Errorf("lookup path failed: %v", err)
+	}
+	node.stat = stat
+	o := newWalkOptions(opts)
+	node.mode, node.mtime = o.mode, o.mtime
+	switch mode := stat.Mode(); {
+	case mode.IsRegular():
+		if err := newSizeLimit(o).add(path.Base(root), stat.Size()); err != nil {
+			return node, err
+		}
+		node.files = append(node.files, stat)
+		node.paths = append(node.paths, root)
+	case mode.IsDir():
+		filter, err := newFilter(func(name string) ([]byte, error) {
+			return fs.ReadFile(fsys, path.Join(root, name))
+		}, o)
+		if err != nil {
+			return node, err
+		}
+		w := &walker{
+			node:      node,
+			filter:    filter,
+			policy:    o.symlinks,
+			dirs:      o.emptyDirs || o.mode || o.mtime,
+			emptyDirs: o.emptyDirs,
+			limit:     newSizeLimit(o),
+		}
+		if err := w.walkFS(fsys, root, ""); err != nil {
+			return node, fmt.Errorf("read directory failed: %w", err)
+		}
+	default:
+		return node, fmt.Errorf("unrecognized file type for %s: %s", root, mode.String())
+	}
+	return
+}
+
+// walkFS reads dir of fsys, found at rel below the root.
+func (w *walker) walkFS(fsys fs.FS, dir, rel string) error {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return err
+	}
+
+	for _, de := range entries {
+		fp := path.Join(dir, de.Name())
+		relPath := path.Join(rel, de.Name())
+
+		if de.Type()&fs.ModeSymlink != 0 && w.policy == SymlinkSkip {
+			continue
+		}
+		fi, err := fs.Stat(fsys, fp)
+		if err != nil {
+			return err
+		}
+		if w.filter.skip(relPath, fi.IsDir()) {
+			continue
+		}
+
+		switch {
+		case fi.IsDir():
+			err = w.addDir(relPath, fi, func() error {
+				return w.walkFS(fsys, fp, relPath)
+			})
+			if err != nil {
+				return err
+			}
+		case fi.Mode().IsRegular():
+			if err := w.addFile(relPath, fi); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("unrecognized file type for %s: %s", relPath, fi.Mode().String())
+		}
+	}
+
+	return nil
+}
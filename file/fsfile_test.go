@@ -0,0 +1,71 @@
+package file
+
+import (
+	"io"
+	"reflect"
+	"testing"
+	"testing/fstest"
+)
+
+func TestFSFile(t *testing.T) {
+	fsys := fstest.MapFS{
+		"site/index.html":     {Data: []byte("<h1>hi</h1>")},
+		"site/css/main.css":   {Data: []byte("body{}")},
+		"site/.git/HEAD":      {Data: []byte("ref")},
+		"site/img/a/logo.png": {Data: []byte("png")},
+		"other.txt":           {Data: []byte("other")},
+	}
+
+	node, err := NewFSFile(fsys, "site", SkipHidden())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if node.Name() != "site" || !node.IsDir() {
+		t.Errorf("name %q, dir %v", node.Name(), node.IsDir())
+	}
+	want := []string{"css/main.css", "img/a/logo.png", "index.html"}
+	if got := walkPaths(t, node); !reflect.DeepEqual(got, want) {
+		t.Errorf("walked %v, want %v", got, want)
+	}
+	if size, err := node.Size(); err != nil || size != int64(len("<h1>hi</h1>body{}png")) {
+		t.Errorf("size %d (%v)", size, err)
+	}
+
+	// Files are opened from fsys, as often as needed.
+	for i := 0; i < 2; i++ {
+		f, err := node.Open("img/a/logo.png")
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, _ := io.ReadAll(f)
+		f.Close()
+		if string(data) != "png" {
+			t.Errorf("read %q", data)
+		}
+	}
+	if !node.Reopenable() {
+		t.Error("fs.FS node isn't reopenable")
+	}
+
+	file, err := NewFSFile(fsys, "site/css/main.css")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := walkPaths(t, file); !reflect.DeepEqual(got, []string{"main.css"}) {
+		t.Errorf("single file walked %v", got)
+	}
+
+	root, err := NewFSFile(fsys, ".")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if root.Name() != "" || len(walkPaths(t, root)) != 5 {
+		t.Errorf("root %q walked %v", root.Name(), walkPaths(t, root))
+	}
+
+	for _, root := range []string{"missing", "/site", "site/../other.txt"} {
+		if _, err := NewFSFile(fsys, root); err == nil {
+			t.Errorf("NewFSFile(%q): no error", root)
+		}
+	}
+}
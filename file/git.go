@@ -0,0 +1,108 @@
+package file
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// GitArchive returns the tree of the commit rev resolves to, a branch, tag
+// or hash, in the git repository at repo, and the full commit hash. The
+// tree is streamed by `git archive`, nothing is checked out, and paths
+// marked `export-ignore` in the commit's .gitattributes are left out.
+//
+// It runs the git command, which must be in the PATH. Symlinks of the tree
+// fail the walk like in any Archive, unless SkipLinks is set on it.
+func GitArchive(repo, rev string) (*Archive, string, error) {
+	if rev == "" || strings.HasPrefix(rev, "-") {
+		return nil, "", fmt.Errorf("invalid revision: %q", rev)
+	}
+	if _, err := exec.LookPath("git"); err != nil {
+		return nil, "", fmt.Errorf("git is required: %v", err)
+	}
+
+	out, err := git(repo, "rev-parse", "--verify", "--quiet", rev+"^{commit}").Output()
+	if err != nil {
+		return nil, "", fmt.Errorf("resolve revision %s failed: %v", rev, gitError(err))
+	}
+	commit := strings.TrimSpace(string(out))
+
+	// The name of "." is the one of the working directory.
+	abs, err := filepath.Abs(repo)
+	if err != nil {
+		return nil, "", err
+	}
+
+	cmd := git(repo, "archive", "--format=tar", commit)
+	stderr := &bytes.Buffer{}
+	cmd.Stderr = stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, "", err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, "", fmt.Errorf("git archive failed: %v", err)
+	}
+
+	ga := &gitArchive{ReadCloser: stdout, cmd: cmd, stderr: stderr}
+	archive := NewArchive(ga)
+	archive.Format = ArchiveTar
+	archive.Name = filepath.Base(abs)
+	archive.closer = ga
+	return archive, commit, nil
+}
+
+func git(repo string, args ...string) *exec.Cmd {
+	return exec.Command("git", append([]string{"-C", repo}, args...)...)
+}
+
+// gitError adds what git printed to the error of a command run with Output.
+func gitError(err error) error {
+	if ee, ok := err.(*exec.ExitError); ok && len(ee.Stderr) > 0 {
+		return fmt.Errorf("%v: %s", err, bytes.TrimSpace(ee.Stderr))
+	}
+	return err
+}
+
+// gitArchive is the output of a running `git archive`, its exit status is
+// reported at the end of the stream.
+type gitArchive struct {
+	io.ReadCloser
+	cmd    *exec.Cmd
+	stderr *bytes.Buffer
+
+	once sync.Once
+	err  error
+}
+
+func (g *gitArchive) Read(p []byte) (int, error) {
+	n, err := g.ReadCloser.Read(p)
+	if err == io.EOF {
+		if werr := g.wait(); werr != nil {
+			return n, werr
+		}
+	}
+	return n, err
+}
+
+// Close stops git if the archive wasn't read to the end.
+func (g *gitArchive) Close() error {
+	g.once.Do(func() {
+		_ = g.cmd.Process.Kill()
+		_ = g.cmd.Wait()
+	})
+	return nil
+}
+
+func (g *gitArchive) wait() error {
+	g.once.Do(func() {
+		if err := g.cmd.Wait(); err != nil {
+			g.err = fmt.Errorf("git archive failed: %v: %s", err, bytes.TrimSpace(g.stderr.Bytes()))
+		}
+	})
+	return g.err
+}
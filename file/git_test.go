@@ -0,0 +1,155 @@
+package file
+
+import (
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// testRepo creates a git repository holding files and symlinks to the
+// targets of links, committed and tagged v1, and returns its path.
+func testRepo(t *testing.T, files, links map[string]string) string {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	repo := t.TempDir()
+	for name, content := range files {
+		fp := filepath.Join(repo, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(fp), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(fp, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for name, target := range links {
+		if err := os.Symlink(target, filepath.Join(repo, name)); err != nil {
+			t.Skip(err)
+		}
+	}
+	for _, args := range [][]string{
+		{"init", "-q"},
+		{"add", "-A"},
+		{"-c", "user.name=test", "-c", "user.email=test@example.com", "commit", "-q", "-m", "init"},
+		{"tag", "v1"},
+	} {
+		if out, err := git(repo, args...).CombinedOutput(); err != nil {
+			t.Fatalf("git %s: %v: %s", args[0], err, out)
+		}
+	}
+	return repo
+}
+
+// archiveFiles walks a and returns the content of its files by name.
+func archiveFiles(a *Archive) (map[string]string, error) {
+	files := map[string]string{}
+	err := a.Walk(func(name string, fi fs.FileInfo, r io.Reader) error {
+		if r == nil {
+			return nil
+		}
+		data, err := io.ReadAll(r)
+		files[name] = string(data)
+		return err
+	})
+	return files, err
+}
+
+func TestGitArchive(t *testing.T) {
+	repo := testRepo(t, map[string]string{
+		"index.html":     "hello",
+		"docs/a.md":      "a",
+		"secret.txt":     "secret",
+		".gitattributes": "secret.txt export-ignore\n",
+	}, nil)
+	head, err := git(repo, "rev-parse", "HEAD").Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, rev := range []string{"HEAD", "v1", strings.TrimSpace(string(head))} {
+		a, commit, err := GitArchive(repo, rev)
+		if err != nil {
+			t.Fatalf("GitArchive(%s): %v", rev, err)
+		}
+		if commit != strings.TrimSpace(string(head)) {
+			t.Errorf("GitArchive(%s) commit %s, want %s", rev, commit, head)
+		}
+		if a.Name != filepath.Base(repo) {
+			t.Errorf("archive name %q", a.Name)
+		}
+		files, err := archiveFiles(a)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := map[string]string{"index.html": "hello", "docs/a.md": "a", ".gitattributes": "secret.txt export-ignore\n"}
+		if !reflect.DeepEqual(files, want) {
+			t.Errorf("GitArchive(%s) files %v, want %v", rev, files, want)
+		}
+	}
+}
+
+func TestGitArchiveRevisions(t *testing.T) {
+	repo := testRepo(t, map[string]string{"a.txt": "a"}, nil)
+	for _, rev := range []string{"", "--output=/tmp/x", "missing"} {
+		if _, _, err := GitArchive(repo, rev); err == nil {
+			t.Errorf("GitArchive(%q) didn't fail", rev)
+		}
+	}
+	if _, _, err := GitArchive(t.TempDir(), "HEAD"); err == nil {
+		t.Error("GitArchive outside of a repository didn't fail")
+	}
+}
+
+func TestGitArchiveSymlinks(t *testing.T) {
+	repo := testRepo(t, map[string]string{"a.txt": "a"}, map[string]string{"b.txt": "a.txt"})
+
+	a, _, err := GitArchive(repo, "HEAD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := archiveFiles(a); err == nil || !strings.Contains(err.Error(), "b.txt") {
+		t.Errorf("walk with a symlink = %v, want an error naming it", err)
+	}
+
+	a, _, err = GitArchive(repo, "HEAD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.SkipLinks = true
+	files, err := archiveFiles(a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(files, map[string]string{"a.txt": "a"}) {
+		t.Errorf("files %v", files)
+	}
+}
+
+func TestGitArchiveName(t *testing.T) {
+	repo := testRepo(t, map[string]string{"a.txt": "a"}, nil)
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(repo); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	a, _, err := GitArchive(".", "HEAD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := filepath.Base(repo); a.Name != want {
+		t.Errorf("name %q, want %q", a.Name, want)
+	}
+	if _, err := archiveFiles(a); err != nil {
+		t.Error(err)
+	}
+}
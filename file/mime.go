@@ -1,52 +1,125 @@
 package file
 
 import (
-	"bufio"
+	"bytes"
 	"io"
+	"mime"
 	"net/http"
 	"os"
-	// "github.com/gabriel-vasile/mimetype"
+	"path"
+	"strings"
 )
 
+// sniffLen is the number of bytes http.DetectContentType considers.
+const sniffLen = 512
+
+const defaultType = "application/octet-stream"
+
 // MediaType returns the file's mime type. If the mime type cannot be
 // determined, it returns "application/octet-stream".
 //
-// The i should be a *os.File, io.Reader, or byte slice.
+// The i should be a *os.File, io.Reader, or byte slice. A *os.File is read
+// in place and its offset is left untouched, so is an io.ReadSeeker. Any
+// other io.Reader loses the sniffed bytes.
+//
+// Deprecated: use DetectContentType, which keeps the sniffed bytes of any
+// reader.
 func MediaType(i interface{}) string {
-	defaultType := "application/octet-stream"
-
-	// var err error
-	// var mtype *mimetype.MIME
-	// switch v := i.(type) {
-	// case *os.File:
-	// 	mtype, err = mimetype.DetectFile(v.Name())
-	// case io.Reader:
-	// 	mtype, err = mimetype.DetectReader(v)
-	// case []byte:
-	// 	mtype = mimetype.Detect(v)
-	// default:
-	// 	return defaultType
-	// }
-
-	// if err != nil {
-	// 	return defaultType
-	// }
-	// return mtype.String()
-
 	switch v := i.(type) {
+	case ContentTyper:
+		return v.ContentType()
 	case *os.File:
-		scanner := bufio.NewScanner(v)
-		return http.DetectContentType(scanner.Bytes())
+		buf := make([]byte, sniffLen)
+		n, err := v.ReadAt(buf, 0)
+		if err != nil && err != io.EOF {
+			return defaultType
+		}
+		return detect(buf[:n], v.Name())
 	case io.Reader:
-		rd := bufio.NewReader(v)
-		buf, err := rd.Peek(8192)
+		contentType, _, err := DetectContentType(v, "")
 		if err != nil {
 			return defaultType
 		}
-		return http.DetectContentType(buf)
+		return contentType
 	case []byte:
-		return http.DetectContentType(v)
+		return detect(v, "")
 	}
 
 	return defaultType
 }
+
+// ContentTyper is implemented by readers that know their content type, see
+// WithContentType.
+type ContentTyper interface {
+	ContentType() string
+}
+
+type typedReader struct {
+	io.Reader
+	contentType string
+}
+
+func (r *typedReader) ContentType() string {
+	return r.contentType
+}
+
+// WithContentType attaches an explicit content type to rd, it is used as is
+// instead of detecting one.
+func WithContentType(rd io.Reader, contentType string) io.Reader {
+	return &typedReader{Reader: rd, contentType: contentType}
+}
+
+// DetectContentType returns the content type of rd along with a reader that
+// replays the sniffed bytes before the rest of rd, so nothing is lost for
+// the upload. An io.ReadSeeker, such as a bytes.Reader, is sought back and
+// returned as is. The type comes from, in order: an explicit type set with
+// WithContentType, the content itself, and the extension of name when the
+// content alone is inconclusive.
+func DetectContentType(rd io.Reader, name string) (string, io.Reader, error) {
+	if ct, ok := rd.(ContentTyper); ok {
+		return ct.ContentType(), rd, nil
+	}
+	if f, ok := rd.(*os.File); ok && name == "" {
+		name = f.Name()
+	}
+
+	// A pipe or a terminal has a Seek that fails.
+	rs, ok := rd.(io.ReadSeeker)
+	var offset int64
+	if ok {
+		var err error
+		offset, err = rs.Seek(0, io.SeekCurrent)
+		ok = err == nil
+	}
+
+	buf := make([]byte, sniffLen)
+	n, err := io.ReadFull(rd, buf)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return defaultType, nil, err
+	}
+	buf = buf[:n]
+
+	if ok {
+		if _, err := rs.Seek(offset, io.SeekStart); err != nil {
+			return defaultType, nil, err
+		}
+		return detect(buf, name), rd, nil
+	}
+	return detect(buf, name), io.MultiReader(bytes.NewReader(buf), rd), nil
+}
+
+// detect sniffs buf and falls back to the extension of name for the types
+// sniffing can't tell apart, such as CSS, JavaScript or SVG.
+func detect(buf []byte, name string) string {
+	sniffed := http.DetectContentType(buf)
+	if sniffed != defaultType && !strings.HasPrefix(sniffed, "text/plain") && !strings.HasPrefix(sniffed, "text/xml") {
+		return sniffed
+	}
+
+	if name != "" {
+		if byExt := mime.TypeByExtension(path.Ext(name)); byExt != "" {
+			return byExt
+		}
+	}
+	return sniffed
+}
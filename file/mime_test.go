@@ -0,0 +1,64 @@
+package file
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+)
+
+const page = "<!DOCTYPE html><html><body>hello</body></html>"
+
+func TestDetectContentTypeKeepsContent(t *testing.T) {
+	for name, rd := range map[string]io.Reader{
+		"reader": io.MultiReader(strings.NewReader(page)),
+		"seeker": strings.NewReader(page),
+	} {
+		contentType, body, err := DetectContentType(rd, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if contentType != "text/html; charset=utf-8" {
+			t.Errorf("%s: type %q", name, contentType)
+		}
+		data, _ := io.ReadAll(body)
+		if string(data) != page {
+			t.Errorf("%s: read %q, want the whole content", name, data)
+		}
+	}
+}
+
+func TestDetectContentTypeSeeker(t *testing.T) {
+	rd := bytes.NewReader([]byte("skip" + page))
+	rd.Seek(4, io.SeekStart)
+	_, body, err := DetectContentType(rd, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body != io.Reader(rd) {
+		t.Error("a seeker isn't returned as is")
+	}
+	if rd.Len() != len(page) {
+		t.Errorf("%d bytes left, want %d", rd.Len(), len(page))
+	}
+}
+
+func TestDetectContentTypeByName(t *testing.T) {
+	for name, want := range map[string]string{
+		"style.css": "text/css; charset=utf-8",
+		"app.js":    "text/javascript; charset=utf-8",
+		"blob":      "text/plain; charset=utf-8",
+	} {
+		got, _, err := DetectContentType(strings.NewReader("a { color: red }"), name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("%s: type %q, want %q", name, got, want)
+		}
+	}
+	got, _, _ := DetectContentType(WithContentType(strings.NewReader(page), "image/png"), "")
+	if got != "image/png" {
+		t.Errorf("explicit type %q, want image/png", got)
+	}
+}
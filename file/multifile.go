@@ -1,12 +1,12 @@
 package file
 
 import (
-	"bytes"
 	"fmt"
 	"io"
 	"mime/multipart"
 	"net/textproto"
 	"os"
+	"path"
 	"path/filepath"
 	"sync"
 
@@ -15,11 +15,27 @@ import (
 
 // MultiFileReader reads from a `commands.Node` (which can be a directory of
 // files or a regular file) as HTTP multipart encoded data.
+//
+// The multipart body is produced while it is read: each file is opened when
+// its part is reached and closed right after, so memory use and open file
+// descriptors stay flat whatever the size of the directory.
 type MultiFileReader struct {
-	io.Reader
+	*io.PipeReader
 
+	pw       *io.PipeWriter
 	mpWriter *multipart.Writer
 	mutex    *sync.Mutex
+
+	node    *Node
+	form    Form
+	parts   []formPart
+	started bool
+}
+
+// formPart is an extra part written before the files.
+type formPart struct {
+	header  textproto.MIMEHeader
+	content []byte
 }
 
 // NewMultiFileReader constructs a files.MultiFileReader via github.com/ipfs/go-ipfs-files.
@@ -42,123 +58,180 @@ func NewMultiFileReader(path string, rawAbsPath, form bool) (*files.MultiFileRea
 	return files.NewMultiFileReader(d, form, rawAbsPath), nil
 }
 
-// CreateMultiForm constructs a MultiFileReader. `path` should be a Node in serialfile.
-// If `form` is set to true, the Content-Disposition will be "form-data".
-// Otherwise, it will be "attachment".
-//
-// It returns an io.Reader and error.
-//
-// Example:
+// CreateMultiForm constructs a MultiFileReader with Pinata's form fields.
+// `path` should be a Node in serialfile. If `form` is set to true, the
+// Content-Disposition will be "form-data". Otherwise, it will be "attachment".
 //
-// > node, err := file.NewSerialFile("directory-path")
-// >
-// > node.MapDirectory("a-dir-name-show-in-pinning-service")
+// Deprecated: use NewMultiForm with the Form of the target provider.
 func CreateMultiForm(node *Node, form bool) (mfr *MultiFileReader, err error) {
-	if len(node.files) == 0 {
-		return mfr, fmt.Errorf("node.files empty")
-	}
-
-	dispositionPrefix := "attachment"
-	if form {
-		dispositionPrefix = "form-data"
-	}
-
-	// New multipart writer.
-	body := &bytes.Buffer{}
-	writer := multipart.NewWriter(body)
-
-	// // Metadata part.
-	// metadataHeader := textproto.MIMEHeader{}
-	// metadataHeader.Set("Content-Disposition", fmt.Sprintf(`%s; filename="folderName"`, dispositionPrefix))
-	// metadataHeader.Set("Content-Type", "application/x-directory")
-	// // Metadata content.
-	// part, err := writer.CreatePart(metadataHeader)
-	// if err != nil {
-	// 	return nil, fmt.Errorf("Error writing metadata headers: %v", err)
-	// }
-	// part.Write([]byte(metadataHeader))
-
-	type meta struct {
-		key  string
-		name string
-		data string
-	}
-	metadata := []meta{
-		// For pinata
-		{
-			key:  "Content-Disposition",
-			name: fmt.Sprintf(`%s; name="pinataMetadata"`, dispositionPrefix),
-			data: fmt.Sprintf(`{"name":"%s"}`, filepath.Base(node.base)),
-		},
-		{
-			key:  "Content-Disposition",
-			name: fmt.Sprintf(`%s; name="pinataOptions"`, dispositionPrefix),
-			data: `{"cidVersion":"1","wrapWithDirectory":false}`,
+	return NewMultiForm(node, Form{
+		Fields: []FormField{
+			{Name: "pinataMetadata", Value: fmt.Sprintf(`{"name":"%s"}`, filepath.Base(node.base))},
+			{Name: "pinataOptions", Value: `{"cidVersion":"1","wrapWithDirectory":false}`},
 		},
+		Attachment: !form,
+	})
+}
+
+func newMultiFileReader(node *Node, form Form, boundary string) *MultiFileReader {
+	pr, pw := io.Pipe()
+	writer := multipart.NewWriter(pw)
+	if boundary != "" {
+		_ = writer.SetBoundary(boundary)
+	}
+
+	return &MultiFileReader{
+		PipeReader: pr,
+		pw:         pw,
+		mpWriter:   writer,
+		mutex:      &sync.Mutex{},
+		node:       node,
+		form:       form,
 	}
-	for _, m := range metadata {
-		header := textproto.MIMEHeader{}
-		header.Set(m.key, m.name)
-		part, err := writer.CreatePart(header)
+}
+
+// Read reads the multipart body, the parts are written on the first call.
+func (mfr *MultiFileReader) Read(buf []byte) (int, error) {
+	mfr.mutex.Lock()
+	if !mfr.started {
+		mfr.started = true
+		go mfr.writeAll()
+	}
+	mfr.mutex.Unlock()
+
+	return mfr.PipeReader.Read(buf)
+}
+
+// GetBody returns a new reader producing the same body from the start, it
+// lets HTTP retries re-read the files instead of buffering the whole body.
+func (mfr *MultiFileReader) GetBody() (io.ReadCloser, error) {
+	mfr.mutex.Lock()
+	defer mfr.mutex.Unlock()
+
+	clone := newMultiFileReader(mfr.node, mfr.form, mfr.Boundary())
+	clone.parts = append([]formPart(nil), mfr.parts...)
+	return clone, nil
+}
+
+func (mfr *MultiFileReader) writeAll() {
+	err := mfr.writeParts()
+	if err == nil {
+		err = mfr.mpWriter.Close()
+	}
+	if err != nil {
+		err = fmt.Errorf("error closing multipart writer: %v", err)
+	}
+	mfr.pw.CloseWithError(err)
+}
+
+func (mfr *MultiFileReader) writeParts() error {
+	for _, p := range mfr.parts {
+		part, err := mfr.mpWriter.CreatePart(p.header)
 		if err != nil {
-			return nil, fmt.Errorf("error writing metadata headers: %v", err)
+			return fmt.Errorf("error writing metadata headers: %v", err)
+		}
+		if _, err := part.Write(p.content); err != nil {
+			return err
 		}
-		_, _ = part.Write([]byte(m.data))
 	}
 
-	for _, fp := range node.paths {
-		fn := node.root
-		switch {
-		case node.stat.IsDir():
-			fn = filepath.Join(node.root, fp)
-		case node.stat.Mode().IsRegular():
-			fp = filepath.Base(fn)
+	node := mfr.node
+	base := path.Clean(filepath.ToSlash(node.base))
+	dirs := map[string]bool{}
+	writeDir := func(dir string, attrs Attributes) error {
+		if dirs[dir] {
+			return nil
 		}
-		f, err := os.Open(fn)
-		if err != nil {
-			return mfr, fmt.Errorf("error reading media file: %v", err)
+		dirs[dir] = true
+		if _, err := mfr.mpWriter.CreatePart(mfr.form.fileHeader(dir, "application/x-directory", attrs)); err != nil {
+			return fmt.Errorf("error writing directory headers: %v", err)
 		}
-		defer f.Close()
-
-		filename := filepath.Join(node.base, fp)
-		// absPath, _ := filepath.Abs(fn)
-		mediaHeader := textproto.MIMEHeader{}
-		// mediaHeader.Set("Abspath", absPath)
-		mediaHeader.Set("Content-Disposition", fmt.Sprintf(`%s; name="file"; filename="%s"`, dispositionPrefix, filename))
-		mediaHeader.Set("Content-Type", "application/octet-stream")
-		part, err := writer.CreatePart(mediaHeader)
-		if err != nil {
-			return mfr, fmt.Errorf("error writing media headers: %v", err)
+		return nil
+	}
+
+	return node.Walk(func(fp string, fi os.FileInfo) error {
+		name := path.Join(filepath.ToSlash(node.base), fp)
+
+		if mfr.form.Directories {
+			for _, dir := range parentDirs(name) {
+				var attrs Attributes
+				if dir == base {
+					attrs = node.Attributes(node.stat)
+				}
+				if err := writeDir(dir, attrs); err != nil {
+					return err
+				}
+			}
 		}
 
-		if _, err := io.Copy(part, f); err != nil {
-			return mfr, fmt.Errorf("error writing media: %v", err)
+		switch {
+		case fi.IsDir():
+			// directories only have a part of their own, empty ones are
+			// lost without it
+			if !mfr.form.Directories {
+				return nil
+			}
+			return writeDir(name, node.Attributes(fi))
+		case fi.Mode()&os.ModeSymlink != 0:
+			return mfr.writeSymlink(fp, name, node.Attributes(fi))
 		}
+		return mfr.writeFile(fp, name, node.Attributes(fi))
+	})
+}
+
+// writeFile copies a single file into a new part and closes it. The part
+// is typed as the file when it's a ContentTyper.
+func (mfr *MultiFileReader) writeFile(fp, name string, attrs Attributes) error {
+	f, err := mfr.node.Open(fp)
+	if err != nil {
+		return fmt.Errorf("error reading media file: %v", err)
 	}
+	defer f.Close()
 
-	// Close multipart writer.
-	if err := writer.Close(); err != nil {
-		return mfr, fmt.Errorf("error closing multipart writer: %v", err)
+	contentType := "application/octet-stream"
+	if ct, ok := f.(ContentTyper); ok {
+		contentType = ct.ContentType()
 	}
 
-	return &MultiFileReader{
-		bytes.NewReader(body.Bytes()),
-		writer,
-		&sync.Mutex{},
-	}, nil
+	part, err := mfr.mpWriter.CreatePart(mfr.form.fileHeader(name, contentType, attrs))
+	if err != nil {
+		return fmt.Errorf("error writing media headers: %v", err)
+	}
+	if _, err := io.Copy(part, f); err != nil {
+		return fmt.Errorf("error writing media: %v", err)
+	}
+	return nil
 }
 
-// TODO: create multipart via Read
-// func (mfr *MultiFileReader) Read(buf []byte) (written int, err error) {
-// 	return
-// }
+// writeSymlink writes a preserved symlink as an `application/symlink` part
+// holding its target.
+func (mfr *MultiFileReader) writeSymlink(fp, name string, attrs Attributes) error {
+	if !mfr.form.Symlinks {
+		return fmt.Errorf("symlinks are not supported by this form: %s", fp)
+	}
+	target, err := mfr.node.Readlink(fp)
+	if err != nil {
+		return err
+	}
+
+	part, err := mfr.mpWriter.CreatePart(mfr.form.fileHeader(name, "application/symlink", attrs))
+	if err != nil {
+		return fmt.Errorf("error writing symlink headers: %v", err)
+	}
+	_, err = io.WriteString(part, target)
+	return err
+}
 
+// Write queues an extra part, written before the files. It fails once the
+// reader has started.
 func (mfr *MultiFileReader) Write(header textproto.MIMEHeader, content []byte) error {
-	part, err := mfr.mpWriter.CreatePart(header)
-	if err != nil {
-		return fmt.Errorf("write header failed: %v", err)
+	mfr.mutex.Lock()
+	defer mfr.mutex.Unlock()
+
+	if mfr.started {
+		return fmt.Errorf("write header failed: multipart body already started")
 	}
-	_, _ = part.Write(content)
+	mfr.parts = append(mfr.parts, formPart{header: header, content: content})
 
 	return nil
 }
@@ -0,0 +1,250 @@
+package file
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"strings"
+
+	"github.com/bmatcuk/doublestar/v4"
+	ignore "github.com/crackcomm/go-gitignore"
+)
+
+const (
+	// IPFSIgnoreFile is the ignore file read by `ipfs add --ignore-rules-path`.
+	IPFSIgnoreFile = ".ipfsignore"
+	// GitIgnoreFile is git's ignore file, with the same syntax.
+	GitIgnoreFile = ".gitignore"
+)
+
+var (
+	// ErrFileTooLarge is returned by NewSerialFile for a file above
+	// MaxFileSize.
+	ErrFileTooLarge = errors.New("file exceeds the size limit")
+	// ErrTotalTooLarge is returned by NewSerialFile once the files add up
+	// to more than MaxTotalSize.
+	ErrTotalTooLarge = errors.New("files exceed the total size limit")
+)
+
+// Option configures how NewSerialFile walks a directory.
+type Option func(*walkOptions)
+
+type walkOptions struct {
+	skipHidden  bool
+	ignoreFiles []string
+	patterns    []string
+	symlinks    SymlinkPolicy
+	emptyDirs   bool
+	mode        bool
+	mtime       bool
+	globs       []string
+	maxFile     int64
+	maxTotal    int64
+}
+
+// SymlinkPolicy decides how symbolic links inside a directory are handled.
+type SymlinkPolicy int
+
+const (
+	// SymlinkFollow uploads what links point to, a link leading back to one
+	// of its parent directories is an error. It is the default.
+	SymlinkFollow SymlinkPolicy = iota
+	// SymlinkFollowWithinRoot follows links like SymlinkFollow, but fails on
+	// any link resolving outside the walked directory.
+	SymlinkFollowWithinRoot
+	// SymlinkPreserve keeps links as UnixFS symlink nodes, with their target
+	// as is. Only providers accepting symlinks can upload them.
+	SymlinkPreserve
+	// SymlinkSkip leaves links out.
+	SymlinkSkip
+)
+
+// Symlinks sets the SymlinkPolicy of the walk.
+func Symlinks(policy SymlinkPolicy) Option {
+	return func(o *walkOptions) {
+		o.symlinks = policy
+	}
+}
+
+// EmptyDirs keeps directories without any file, they are dropped by
+// default.
+func EmptyDirs() Option {
+	return func(o *walkOptions) {
+		o.emptyDirs = true
+	}
+}
+
+// PreserveMode records the permission bits of every entry as UnixFS 1.5
+// metadata, like `ipfs add --preserve-mode`.
+func PreserveMode() Option {
+	return func(o *walkOptions) {
+		o.mode = true
+	}
+}
+
+// PreserveMtime records the modification time of every entry as UnixFS 1.5
+// metadata, like `ipfs add --preserve-mtime`.
+func PreserveMtime() Option {
+	return func(o *walkOptions) {
+		o.mtime = true
+	}
+}
+
+// SkipHidden leaves out files and directories whose name starts with a dot.
+func SkipHidden() Option {
+	return func(o *walkOptions) {
+		o.skipHidden = true
+	}
+}
+
+// IgnoreFile reads gitignore-style rules from the file name at the root of
+// the walked directory, e.g. IPFSIgnoreFile. A missing file is skipped.
+func IgnoreFile(name string) Option {
+	return func(o *walkOptions) {
+		o.ignoreFiles = append(o.ignoreFiles, name)
+	}
+}
+
+// IgnorePatterns adds gitignore-style rules, such as "node_modules/" or
+// "*.log".
+func IgnorePatterns(patterns ...string) Option {
+	return func(o *walkOptions) {
+		o.patterns = append(o.patterns, patterns...)
+	}
+}
+
+// Globs selects files with doublestar patterns matched against their slash
+// separated path below the root, such as "**/*.png". Patterns starting with
+// "!" exclude, e.g. "!**/*.map". A file is kept when it matches an include
+// pattern, or there is none, and no exclude pattern. Directories are kept
+// for the files they hold.
+func Globs(patterns ...string) Option {
+	return func(o *walkOptions) {
+		o.globs = append(o.globs, patterns...)
+	}
+}
+
+// MaxFileSize fails the walk on any file larger than size bytes, with an
+// error naming it that wraps ErrFileTooLarge.
+func MaxFileSize(size int64) Option {
+	return func(o *walkOptions) {
+		o.maxFile = size
+	}
+}
+
+// MaxTotalSize fails the walk once the files add up to more than size
+// bytes, with an error naming the file crossing the limit that wraps
+// ErrTotalTooLarge.
+func MaxTotalSize(size int64) Option {
+	return func(o *walkOptions) {
+		o.maxTotal = size
+	}
+}
+
+// WalkConfig holds the options a pinner walks directories with. Pinners
+// embed it to implement pinners.WalkConfigurer.
+type WalkConfig struct {
+	opts []Option
+}
+
+// SetWalkOptions sets the options PinFile and PinDir walk directories with,
+// such as ignore rules.
+func (c *WalkConfig) SetWalkOptions(opts ...Option) {
+	c.opts = opts
+}
+
+// WalkOptions returns the options set by SetWalkOptions.
+func (c *WalkConfig) WalkOptions() []Option {
+	return c.opts
+}
+
+// filter decides which entries of a walk are kept.
+type filter struct {
+	skipHidden bool
+	rules      *ignore.GitIgnore
+	include    []string
+	exclude    []string
+}
+
+func newWalkOptions(opts []Option) *walkOptions {
+	o := new(walkOptions)
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// newFilter builds the filter of o, readFile reads a file at the root of
+// the walk.
+func newFilter(readFile func(name string) ([]byte, error), o *walkOptions) (*filter, error) {
+	var lines []string
+	for _, name := range o.ignoreFiles {
+		data, err := readFile(name)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("read ignore file failed: %v", err)
+		}
+		lines = append(lines, strings.Split(string(data), "\n")...)
+	}
+	lines = append(lines, o.patterns...)
+
+	f := &filter{skipHidden: o.skipHidden}
+	if len(lines) > 0 {
+		rules, err := ignore.CompileIgnoreLines(lines...)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ignore rules: %v", err)
+		}
+		f.rules = rules
+	}
+	for _, glob := range o.globs {
+		pattern, exclude := strings.CutPrefix(glob, "!")
+		if !doublestar.ValidatePattern(pattern) {
+			return nil, fmt.Errorf("invalid glob pattern: %s", glob)
+		}
+		if exclude {
+			f.exclude = append(f.exclude, pattern)
+		} else {
+			f.include = append(f.include, pattern)
+		}
+	}
+	return f, nil
+}
+
+// skip reports whether the entry at the slash separated relative path rel
+// is left out.
+func (f *filter) skip(rel string, isDir bool) bool {
+	if f.skipHidden && strings.HasPrefix(path.Base(rel), ".") {
+		return true
+	}
+	if !isDir && !f.selected(rel) {
+		return true
+	}
+	if f.rules == nil {
+		return false
+	}
+	if isDir {
+		return f.rules.MatchesPath(rel + "/")
+	}
+	return f.rules.MatchesPath(rel)
+}
+
+// selected reports whether the file at rel passes the globs.
+func (f *filter) selected(rel string) bool {
+	for _, pattern := range f.exclude {
+		if doublestar.MatchUnvalidated(pattern, rel) {
+			return false
+		}
+	}
+	if len(f.include) == 0 {
+		return true
+	}
+	for _, pattern := range f.include {
+		if doublestar.MatchUnvalidated(pattern, rel) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,128 @@
+package file
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func walkPaths(t *testing.T, node *Node) []string {
+	t.Helper()
+	var paths []string
+	err := node.Walk(func(fp string, fi os.FileInfo) error {
+		if !fi.IsDir() {
+			paths = append(paths, fp)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+func TestIgnoreRules(t *testing.T) {
+	root := t.TempDir()
+	for name, content := range map[string]string{
+		".ipfsignore":          "*.log\nbuild/\n",
+		".DS_Store":            "",
+		"index.html":           "",
+		"debug.log":            "",
+		"build/out.js":         "",
+		"node_modules/a/a.js":  "",
+		"assets/.hidden/x.png": "",
+		"assets/logo.png":      "",
+	} {
+		fp := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(fp), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(fp, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	node, err := NewSerialFile(root,
+		IgnoreFile(IPFSIgnoreFile),
+		IgnorePatterns("node_modules/"),
+		SkipHidden(),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"assets/logo.png", "index.html"}
+	if got := walkPaths(t, node); !reflect.DeepEqual(got, want) {
+		t.Errorf("walked %v, want %v", got, want)
+	}
+}
+
+func TestWalkConfig(t *testing.T) {
+	var c WalkConfig
+	if len(c.WalkOptions()) != 0 {
+		t.Error("options set by default")
+	}
+	c.SetWalkOptions(SkipHidden(), IgnoreFile(IPFSIgnoreFile))
+	if len(c.WalkOptions()) != 2 {
+		t.Errorf("%d options, want 2", len(c.WalkOptions()))
+	}
+}
+
+func TestGlobs(t *testing.T) {
+	dir := writeTree(t, map[string]string{
+		"index.html":        "",
+		"app.js":            "",
+		"app.js.map":        "",
+		"img/logo.png":      "",
+		"img/icons/a.png":   "",
+		"img/icons/a.png.x": "",
+	})
+	node, err := NewSerialFile(dir, Globs("**/*.png", "*.js*", "!**/*.map"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"app.js", "img/icons/a.png", "img/logo.png"}
+	if got := walkPaths(t, node); !reflect.DeepEqual(got, want) {
+		t.Errorf("walked %v, want %v", got, want)
+	}
+
+	if _, err := NewSerialFile(dir, Globs("[")); err == nil {
+		t.Error("invalid glob: no error")
+	}
+}
+
+func TestMaxFileSize(t *testing.T) {
+	dir := writeTree(t, map[string]string{"small.txt": "1234", "sub/big.txt": "12345"})
+	if _, err := NewSerialFile(dir, MaxFileSize(5)); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := NewSerialFile(dir, MaxFileSize(4))
+	if !errors.Is(err, ErrFileTooLarge) || !strings.Contains(err.Error(), "sub/big.txt is 5 bytes") {
+		t.Errorf("err = %v, want sub/big.txt over the file limit", err)
+	}
+	_, err = NewSerialFile(filepath.Join(dir, "sub", "big.txt"), MaxFileSize(4))
+	if !errors.Is(err, ErrFileTooLarge) {
+		t.Errorf("single file: err = %v, want ErrFileTooLarge", err)
+	}
+}
+
+func TestMaxTotalSize(t *testing.T) {
+	dir := writeTree(t, map[string]string{"a.txt": "1234", "b.txt": "12345", "c.log": "123"})
+	if _, err := NewSerialFile(dir, MaxTotalSize(12)); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := NewSerialFile(dir, MaxTotalSize(8))
+	if !errors.Is(err, ErrTotalTooLarge) || !strings.Contains(err.Error(), "b.txt brings the total to 9 bytes") {
+		t.Errorf("err = %v, want b.txt over the total limit", err)
+	}
+
+	// Files left out by the filters don't count.
+	if _, err := NewSerialFile(dir, MaxTotalSize(9), Globs("*.txt")); err != nil {
+		t.Errorf("filtered: %v", err)
+	}
+}
@@ -0,0 +1,171 @@
+package file
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// NewReaderDir returns a directory Node holding the named readers, keyed by
+// their slash separated path in the directory, such as "img/a.png". Each
+// reader is consumed by the first upload and closed if it's an io.Closer,
+// so a retried request can't send it again.
+//
+// Example:
+//
+// > node, err := file.NewReaderDir(map[string]io.Reader{
+// > 	"index.html": strings.NewReader("<h1>hello</h1>"),
+// > 	"img/a.png":  png,
+// > })
+func NewReaderDir(entries map[string]io.Reader) (*Node, error) {
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("no entries")
+	}
+
+	node := &Node{
+		stat:    &readerInfo{name: ".", dir: true},
+		readers: &readerSet{entries: make(map[string]io.Reader, len(entries))},
+	}
+	for name, rd := range entries {
+		if !fs.ValidPath(name) || name == "." {
+			return nil, fmt.Errorf("invalid entry name: %q", name)
+		}
+		if rd == nil {
+			return nil, fmt.Errorf("nil reader for entry %q", name)
+		}
+		node.readers.entries[name] = rd
+		node.paths = append(node.paths, name)
+	}
+	for _, name := range node.paths {
+		for _, dir := range parentDirs(name) {
+			if _, ok := node.readers.entries[dir]; ok {
+				return nil, fmt.Errorf("entry %q is also a directory", dir)
+			}
+		}
+	}
+
+	// walk order: the content of a directory is listed together
+	sort.Slice(node.paths, func(i, j int) bool {
+		return lessPath(node.paths[i], node.paths[j])
+	})
+	for _, name := range node.paths {
+		node.files = append(node.files, &readerInfo{name: path.Base(name), size: readerLen(node.readers.entries[name])})
+	}
+
+	return node, nil
+}
+
+// NewReaderFile returns a single file Node of rd named name, read once
+// like the entries of NewReaderDir. A reader set up with WithContentType, or
+// any other ContentTyper, keeps its type in the upload.
+func NewReaderFile(name string, rd io.Reader) (*Node, error) {
+	if name == "" || strings.Contains(name, "/") || name == "." || name == ".." {
+		return nil, fmt.Errorf("invalid file name: %q", name)
+	}
+	if rd == nil {
+		return nil, fmt.Errorf("nil reader for %q", name)
+	}
+
+	info := &readerInfo{name: name, size: readerLen(rd)}
+	return &Node{
+		stat:    info,
+		files:   []fs.FileInfo{info},
+		paths:   []string{name},
+		readers: &readerSet{entries: map[string]io.Reader{name: rd}},
+	}, nil
+}
+
+// lessPath orders slash separated paths element by element.
+func lessPath(a, b string) bool {
+	as, bs := strings.Split(a, "/"), strings.Split(b, "/")
+	for i := 0; i < len(as) && i < len(bs); i++ {
+		if as[i] != bs[i] {
+			return as[i] < bs[i]
+		}
+	}
+	return len(as) < len(bs)
+}
+
+// readerLen returns the size of rd when it knows it, e.g. a bytes.Reader.
+func readerLen(rd io.Reader) int64 {
+	if l, ok := rd.(interface{ Len() int }); ok {
+		return int64(l.Len())
+	}
+	return 0
+}
+
+// readerSet hands out every reader of a NewReaderDir Node once.
+type readerSet struct {
+	mutex   sync.Mutex
+	entries map[string]io.Reader
+}
+
+func (s *readerSet) open(fp string) (fs.File, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	rd, ok := s.entries[fp]
+	if !ok {
+		return nil, fmt.Errorf("entry %s not found or already read", fp)
+	}
+	delete(s.entries, fp)
+
+	f := &readerFile{Reader: rd, fi: &readerInfo{name: path.Base(fp), size: readerLen(rd)}}
+	if ct, ok := rd.(ContentTyper); ok {
+		return &typedReaderFile{readerFile: f, contentType: ct.ContentType()}, nil
+	}
+	return f, nil
+}
+
+// readerFile is an entry of a NewReaderDir Node opened as a fs.File.
+type readerFile struct {
+	io.Reader
+	fi fs.FileInfo
+}
+
+func (f *readerFile) Stat() (fs.FileInfo, error) {
+	return f.fi, nil
+}
+
+func (f *readerFile) Close() error {
+	if c, ok := f.Reader.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// typedReaderFile is a readerFile whose reader has a content type.
+type typedReaderFile struct {
+	*readerFile
+	contentType string
+}
+
+func (f *typedReaderFile) ContentType() string {
+	return f.contentType
+}
+
+// readerInfo describes an entry of a NewReaderDir Node, the size is zero
+// when the reader doesn't tell it.
+type readerInfo struct {
+	name string
+	size int64
+	dir  bool
+}
+
+func (fi *readerInfo) Name() string       { return fi.name }
+func (fi *readerInfo) Size() int64        { return fi.size }
+func (fi *readerInfo) ModTime() time.Time { return time.Time{} }
+func (fi *readerInfo) IsDir() bool        { return fi.dir }
+func (fi *readerInfo) Sys() any           { return nil }
+
+func (fi *readerInfo) Mode() fs.FileMode {
+	if fi.dir {
+		return fs.ModeDir | 0o755
+	}
+	return 0o644
+}
@@ -0,0 +1,110 @@
+package file
+
+import (
+	"io"
+	"mime/multipart"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReaderDir(t *testing.T) {
+	node, err := NewReaderDir(map[string]io.Reader{
+		"index.html": strings.NewReader("<h1>hi</h1>"),
+		"img/a.png":  strings.NewReader("png"),
+		"img/b/c.js": strings.NewReader("js"),
+		"z.txt":      WithContentType(strings.NewReader("z"), "text/plain"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the content of a directory is listed together
+	var paths []string
+	node.Walk(func(fp string, fi os.FileInfo) error {
+		paths = append(paths, fp)
+		return nil
+	})
+	want := []string{"img/a.png", "img/b/c.js", "index.html", "z.txt"}
+	if !reflect.DeepEqual(paths, want) {
+		t.Errorf("walked %v, want %v", paths, want)
+	}
+	if node.Reopenable() || node.Name() != "" {
+		t.Errorf("reopenable %v, name %q", node.Reopenable(), node.Name())
+	}
+
+	mfr, err := NewMultiForm(node, Form{FileField: "file"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mr := multipart.NewReader(mfr, mfr.Boundary())
+	files := map[string]string{}
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, _ := io.ReadAll(part)
+		files[part.FileName()] = string(data) + " " + part.Header.Get("Content-Type")
+	}
+	if files["a.png"] != "png application/octet-stream" || files["z.txt"] != "z text/plain" || len(files) != 4 {
+		t.Errorf("form files %v", files)
+	}
+
+	// Every reader was consumed by the first body.
+	body, err := mfr.GetBody()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.ReadAll(body); err == nil || !strings.Contains(err.Error(), "already read") {
+		t.Errorf("second read = %v, want an already read error", err)
+	}
+	if _, err := node.Open("z.txt"); err == nil {
+		t.Error("second Open didn't fail")
+	}
+}
+
+func TestReaderDirInvalid(t *testing.T) {
+	for _, entries := range []map[string]io.Reader{
+		nil,
+		{"": strings.NewReader("")},
+		{"../a": strings.NewReader("")},
+		{"/a": strings.NewReader("")},
+		{"a": nil},
+		{"a": strings.NewReader(""), "a/b": strings.NewReader("")},
+	} {
+		if _, err := NewReaderDir(entries); err == nil {
+			t.Errorf("NewReaderDir(%v): no error", entries)
+		}
+	}
+}
+
+func TestReaderFile(t *testing.T) {
+	node, err := NewReaderFile("a.txt", strings.NewReader("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if node.IsDir() || node.Name() != "a.txt" {
+		t.Errorf("dir %v, name %q", node.IsDir(), node.Name())
+	}
+	f, err := node.Open("a.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := io.ReadAll(f); string(data) != "hello" {
+		t.Errorf("read %q", data)
+	}
+	if _, err := node.Open("a.txt"); err == nil {
+		t.Error("second Open didn't fail")
+	}
+
+	for _, name := range []string{"", ".", "..", "a/b"} {
+		if _, err := NewReaderFile(name, strings.NewReader("")); err == nil {
+			t.Errorf("NewReaderFile(%q): no error", name)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package file
+
+import (
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// RemoteFile is the body of a URL being pinned, read as it is uploaded.
+type RemoteFile struct {
+	// Name comes from the Content-Disposition of the response, or else the
+	// last element of the URL path.
+	Name string
+	// Size is the Content-Length of the response, -1 if unknown.
+	Size int64
+
+	contentType string
+	body        io.ReadCloser
+	maxSize     int64
+	read        int64
+}
+
+// Fetch requests rawURL and returns its body without reading it. A body
+// larger than maxSize fails with an error wrapping ErrFileTooLarge, up front
+// when the Content-Length tells it or else while it is read. A maxSize of
+// zero or less is no limit.
+func Fetch(client *http.Client, rawURL string, maxSize int64) (*RemoteFile, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid url: %v", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("unsupported url scheme: %s", u.Scheme)
+	}
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	resp, err := client.Get(u.String())
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("fetch %s failed: %s", u.Redacted(), resp.Status)
+	}
+
+	name := remoteName(resp, u)
+	if maxSize > 0 && resp.ContentLength > maxSize {
+		resp.Body.Close()
+		return nil, fmt.Errorf("%w: %s is %d bytes, the limit is %d", ErrFileTooLarge, name, resp.ContentLength, maxSize)
+	}
+
+	contentType := resp.Header.Get("Content-Type")
+	if contentType == "" {
+		if contentType = mime.TypeByExtension(path.Ext(name)); contentType == "" {
+			contentType = defaultType
+		}
+	}
+
+	return &RemoteFile{
+		Name:        name,
+		Size:        resp.ContentLength,
+		contentType: contentType,
+		body:        resp.Body,
+		maxSize:     maxSize,
+	}, nil
+}
+
+// remoteName picks the file name of a response.
+func remoteName(resp *http.Response, u *url.URL) string {
+	if _, params, err := mime.ParseMediaType(resp.Header.Get("Content-Disposition")); err == nil {
+		if name := cleanName(params["filename"]); name != "" {
+			return name
+		}
+	}
+	if name := cleanName(path.Base(u.Path)); name != "" {
+		return name
+	}
+	return RandString(6, "lower")
+}
+
+// cleanName keeps the last element of a name sent by a server, or returns
+// "" when nothing usable is left.
+func cleanName(name string) string {
+	name = path.Base(strings.ReplaceAll(name, `\`, "/"))
+	switch name {
+	case ".", "..", "/":
+		return ""
+	}
+	return name
+}
+
+// ContentType returns the upstream Content-Type, or the type of the file
+// name's extension when the response had none.
+func (f *RemoteFile) ContentType() string {
+	return f.contentType
+}
+
+func (f *RemoteFile) Read(p []byte) (int, error) {
+	n, err := f.body.Read(p)
+	f.read += int64(n)
+	if f.maxSize > 0 && f.read > f.maxSize {
+		return n, fmt.Errorf("%w: %s is larger than %d bytes", ErrFileTooLarge, f.Name, f.maxSize)
+	}
+	return n, err
+}
+
+// Close closes the response body.
+func (f *RemoteFile) Close() error {
+	return f.body.Close()
+}
+
+// Node returns a single file Node of f, named f.Name.
+func (f *RemoteFile) Node() (*Node, error) {
+	return NewReaderFile(f.Name, f)
+}
@@ -3,47 +3,92 @@ package file
 import (
 	"crypto/rand"
 	"fmt"
+	"io/fs"
 	"math/big"
 	"os"
+	"path"
 	"path/filepath"
 	"strings"
 )
 
 // Node represents a serial files.
 type Node struct {
-	base  string
-	root  string
-	files []os.FileInfo
-	paths []string // relative path
-	stat  os.FileInfo
+	base    string
+	root    string
+	files   []os.FileInfo
+	paths   []string          // relative path
+	targets map[string]string // preserved symlinks by relative path
+	stat    os.FileInfo
+	fsys    fs.FS          // nil for files on disk
+	readers *readerSet     // set by NewReaderDir
+	archive *archiveStream // set by NewArchiveNode
+	mode    bool
+	mtime   bool
 }
 
 // NewSerialFile adopts serial files and returns a Node represents a file,
-// directory, or special file.
-func NewSerialFile(root string) (node *Node, err error) {
+// directory, or special file. The options filter the entries of a directory.
+//
+// Example:
+//
+// > node, err := file.NewSerialFile("site", file.SkipHidden(), file.IgnoreFile(file.IPFSIgnoreFile))
+func NewSerialFile(root string, opts ...Option) (node *Node, err error) {
 	node = new(Node)
 	node.root = root
-	stat, err := os.Stat(root)
+	o := newWalkOptions(opts)
+	node.mode, node.mtime = o.mode, o.mtime
+	stat, err := os.Lstat(root)
 	if err != nil {
 		return node, fmt.Errorf("lookup path failed: %v", err)
 	}
+	// a symlinked root follows the policy like any link below it
+	if stat.Mode()&os.ModeSymlink != 0 {
+		switch o.symlinks {
+		case SymlinkSkip:
+			return node, fmt.Errorf("lookup path failed: %s is a symlink", root)
+		case SymlinkPreserve:
+			target, err := os.Readlink(root)
+			if err != nil {
+				return node, fmt.Errorf("lookup path failed: %v", err)
+			}
+			node.stat = stat
+			node.targets = map[string]string{filepath.Base(root): target}
+			node.files = append(node.files, stat)
+			node.paths = append(node.paths, root)
+			return node, nil
+		}
+		if stat, err = os.Stat(root); err != nil {
+			return node, fmt.Errorf("lookup path failed: %v", err)
+		}
+	}
 	node.stat = stat
 	switch mode := stat.Mode(); {
 	case mode.IsRegular():
+		if err := newSizeLimit(o).add(filepath.Base(root), stat.Size()); err != nil {
+			return node, err
+		}
 		node.files = append(node.files, stat)
 		node.paths = append(node.paths, root)
 	case mode.IsDir():
-		err := filepath.Walk(root, func(path string, fi os.FileInfo, err error) error {
-			if !fi.IsDir() {
-				path = strings.TrimPrefix(path, root)
-				path = strings.TrimPrefix(path, "/")
-				node.paths = append(node.paths, path)
-				node.files = append(node.files, fi)
-			}
-			return nil
-		})
+		filter, err := newFilter(func(name string) ([]byte, error) {
+			return os.ReadFile(filepath.Join(root, name))
+		}, o)
 		if err != nil {
-			return node, fmt.Errorf("read directory failed: %v", err)
+			return node, err
+		}
+		w := &walker{
+			node:      node,
+			filter:    filter,
+			policy:    o.symlinks,
+			dirs:      o.emptyDirs || o.mode || o.mtime,
+			emptyDirs: o.emptyDirs,
+			limit:     newSizeLimit(o),
+		}
+		if w.rootReal, err = filepath.EvalSymlinks(root); err != nil {
+			return node, fmt.Errorf("lookup path failed: %v", err)
+		}
+		if err := w.walk(root, "", []string{w.rootReal}); err != nil {
+			return node, fmt.Errorf("read directory failed: %w", err)
 		}
 	default:
 		return node, fmt.Errorf("unrecognized file type for %s: %s", root, mode.String())
@@ -51,6 +96,161 @@ func NewSerialFile(root string) (node *Node, err error) {
 	return
 }
 
+// walker collects the entries of a directory in lexical order. With dirs
+// set, directories are listed too, ahead of their content.
+type walker struct {
+	node      *Node
+	filter    *filter
+	policy    SymlinkPolicy
+	rootReal  string
+	dirs      bool
+	emptyDirs bool
+	limit     *sizeLimit
+}
+
+// walk reads dir, found at rel below the root. parents holds the resolved
+// paths of the directories being walked, to catch symlink cycles.
+func (w *walker) walk(dir, rel string, parents []string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	for _, de := range entries {
+		fp := filepath.Join(dir, de.Name())
+		relPath := filepath.Join(rel, de.Name())
+
+		fi, err := os.Lstat(fp)
+		if err != nil {
+			return err
+		}
+
+		if fi.Mode()&os.ModeSymlink != 0 {
+			switch w.policy {
+			case SymlinkSkip:
+				continue
+			case SymlinkPreserve:
+				if w.filter.skip(filepath.ToSlash(relPath), false) {
+					continue
+				}
+				target, err := os.Readlink(fp)
+				if err != nil {
+					return err
+				}
+				w.node.addLink(relPath, fi, target)
+				continue
+			}
+
+			real, err := filepath.EvalSymlinks(fp)
+			if err != nil {
+				return fmt.Errorf("resolve symlink %s failed: %v", relPath, err)
+			}
+			if w.policy == SymlinkFollowWithinRoot && !within(w.rootReal, real) {
+				return fmt.Errorf("symlink %s points outside of the root: %s", relPath, real)
+			}
+			if fi, err = os.Stat(fp); err != nil {
+				return err
+			}
+			if fi.IsDir() {
+				for _, parent := range parents {
+					if parent == real {
+						return fmt.Errorf("symlink cycle at %s", relPath)
+					}
+				}
+			}
+		}
+
+		if w.filter.skip(filepath.ToSlash(relPath), fi.IsDir()) {
+			continue
+		}
+
+		switch {
+		case fi.IsDir():
+			real, err := filepath.EvalSymlinks(fp)
+			if err != nil {
+				return err
+			}
+			err = w.addDir(relPath, fi, func() error {
+				return w.walk(fp, relPath, append(parents, real))
+			})
+			if err != nil {
+				return err
+			}
+		case fi.Mode().IsRegular():
+			if err := w.addFile(relPath, fi); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("unrecognized file type for %s: %s", relPath, fi.Mode().String())
+		}
+	}
+
+	return nil
+}
+
+// addFile records the regular file at rel.
+func (w *walker) addFile(rel string, fi os.FileInfo) error {
+	if err := w.limit.add(filepath.ToSlash(rel), fi.Size()); err != nil {
+		return err
+	}
+	w.node.paths = append(w.node.paths, rel)
+	w.node.files = append(w.node.files, fi)
+	return nil
+}
+
+// addDir records the directory at rel, if directories are listed, while
+// walk adds its content. An empty one is dropped without EmptyDirs.
+func (w *walker) addDir(rel string, fi os.FileInfo, walk func() error) error {
+	n := len(w.node.paths)
+	if w.dirs {
+		w.node.paths = append(w.node.paths, rel)
+		w.node.files = append(w.node.files, fi)
+	}
+	if err := walk(); err != nil {
+		return err
+	}
+	if w.dirs && !w.emptyDirs && len(w.node.paths) == n+1 {
+		w.node.paths, w.node.files = w.node.paths[:n], w.node.files[:n]
+	}
+	return nil
+}
+
+// sizeLimit enforces MaxFileSize and MaxTotalSize, zero is no limit.
+type sizeLimit struct {
+	file, total int64
+	sum         int64
+}
+
+func newSizeLimit(o *walkOptions) *sizeLimit {
+	return &sizeLimit{file: o.maxFile, total: o.maxTotal}
+}
+
+// add counts the file at rel of size bytes.
+func (l *sizeLimit) add(rel string, size int64) error {
+	if l.file > 0 && size > l.file {
+		return fmt.Errorf("%w: %s is %d bytes, the limit is %d", ErrFileTooLarge, rel, size, l.file)
+	}
+	l.sum += size
+	if l.total > 0 && l.sum > l.total {
+		return fmt.Errorf("%w: %s brings the total to %d bytes, the limit is %d", ErrTotalTooLarge, rel, l.sum, l.total)
+	}
+	return nil
+}
+
+func (n *Node) addLink(rel string, fi os.FileInfo, target string) {
+	if n.targets == nil {
+		n.targets = map[string]string{}
+	}
+	n.targets[filepath.ToSlash(rel)] = target
+	n.paths = append(n.paths, rel)
+	n.files = append(n.files, fi)
+}
+
+// within reports whether p is root or below it.
+func within(root, p string) bool {
+	return p == root || strings.HasPrefix(p, root+string(filepath.Separator))
+}
+
 // MapDirectory sets up a new target directory by given path name.
 func (n *Node) MapDirectory(name string) {
 	if n.stat.IsDir() {
@@ -58,6 +258,98 @@ func (n *Node) MapDirectory(name string) {
 	}
 }
 
+// Walk calls fn for every file of the Node in order. fp is relative to the
+// Node, for a single file it is the file name. Directories are passed too,
+// before their content, when the Node was created with EmptyDirs,
+// PreserveMode or PreserveMtime.
+func (n *Node) Walk(fn func(fp string, fi os.FileInfo) error) error {
+	if n.archive != nil {
+		return n.archive.walk(fn)
+	}
+	for i, fi := range n.files {
+		fp := n.paths[i]
+		if !n.stat.IsDir() {
+			fp = filepath.Base(fp)
+		}
+		if err := fn(filepath.ToSlash(fp), fi); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Open opens the file at fp, a path as passed to Walk.
+func (n *Node) Open(fp string) (fs.File, error) {
+	if n.archive != nil {
+		return n.archive.open(fp)
+	}
+	if n.readers != nil {
+		return n.readers.open(fp)
+	}
+	if n.fsys != nil {
+		if n.stat.IsDir() {
+			return n.fsys.Open(path.Join(n.root, fp))
+		}
+		return n.fsys.Open(n.root)
+	}
+	if n.stat.IsDir() {
+		return os.Open(filepath.Join(n.root, filepath.FromSlash(fp)))
+	}
+	return os.Open(n.root)
+}
+
+// Reopenable reports whether a file of the Node can be opened again, as
+// files on disk or in a fs.FS can. Entries of NewReaderDir, NewReaderFile
+// and NewArchiveNode Nodes are read once.
+func (n *Node) Reopenable() bool {
+	return n.readers == nil && n.archive == nil
+}
+
+// Name returns the directory the Node is mapped to, or else the base name
+// of its root. It is empty for the root of a fs.FS and for NewReaderDir,
+// and the Name of the Archive for NewArchiveNode.
+func (n *Node) Name() string {
+	if n.base != "" {
+		return n.base
+	}
+	if n.archive != nil {
+		return n.archive.archive.Name
+	}
+	if n.readers != nil {
+		if n.stat.IsDir() {
+			return ""
+		}
+		return n.stat.Name()
+	}
+	if n.fsys != nil {
+		if n.root == "." {
+			return ""
+		}
+		return path.Base(n.root)
+	}
+	return filepath.Base(n.root)
+}
+
+// Readlink returns the target of the preserved symlink at fp, a path as
+// passed to Walk.
+func (n *Node) Readlink(fp string) (string, error) {
+	target, ok := n.targets[fp]
+	if !ok {
+		return "", fmt.Errorf("not a symlink: %s", fp)
+	}
+	return target, nil
+}
+
+// Stat returns the os.FileInfo of the Node's root.
+func (n *Node) Stat() os.FileInfo {
+	return n.stat
+}
+
+// IsDir reports whether the Node represents a directory.
+func (n *Node) IsDir() bool {
+	return n.stat.IsDir()
+}
+
 // Mode returns a os.FileMode of Node
 func (n *Node) Mode() os.FileMode {
 	return n.stat.Mode()
@@ -70,25 +362,10 @@ func (n *Node) Size() (du int64, err error) {
 	}
 
 	for _, fi := range n.files {
+		// directories are listed along with their content
 		if fi.Mode().IsRegular() {
 			du += fi.Size()
 		}
-		if fi.Mode().IsDir() {
-			err = filepath.Walk(fi.Name(), func(p string, fi os.FileInfo, err error) error {
-				if err != nil || fi == nil {
-					return err
-				}
-
-				if fi.Mode().IsRegular() {
-					du += fi.Size()
-				}
-
-				return nil
-			})
-			if err != nil {
-				return 0, fmt.Errorf("walk directory failed: %v", err)
-			}
-		}
 	}
 
 	return du, err
@@ -0,0 +1,147 @@
+package file
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSymlinkRoot(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "a.txt"), []byte("hello"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	link := filepath.Join(dir, "link")
+	if err := os.Symlink("a.txt", link); err != nil {
+		t.Skip(err)
+	}
+
+	node, err := NewSerialFile(link)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !node.Mode().IsRegular() {
+		t.Errorf("followed root is %s, want a regular file", node.Mode())
+	}
+
+	node, err = NewSerialFile(link, Symlinks(SymlinkPreserve))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if target, err := node.Readlink("link"); err != nil || target != "a.txt" {
+		t.Errorf("Readlink = %q, %v", target, err)
+	}
+
+	if _, err := NewSerialFile(link, Symlinks(SymlinkSkip)); err == nil {
+		t.Error("skipped root didn't fail")
+	}
+}
+
+func TestMultiFormSymlinks(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "a.txt"), []byte("hello"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("a.txt", filepath.Join(dir, "link")); err != nil {
+		t.Skip(err)
+	}
+	node, err := NewSerialFile(dir, Symlinks(SymlinkPreserve))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := NewMultiForm(node, Form{}); err == nil || !strings.Contains(err.Error(), "link") {
+		t.Errorf("NewMultiForm without Symlinks = %v, want an error naming the link", err)
+	}
+
+	mfr, err := NewMultiForm(node, Form{Symlinks: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := io.ReadAll(mfr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(body), "application/symlink") {
+		t.Error("no symlink part in the body")
+	}
+}
+
+// writeTree creates files, by slash separated path, in a new directory.
+func writeTree(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		fp := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(fp), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(fp, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestSymlinkCycle(t *testing.T) {
+	dir := writeTree(t, map[string]string{"sub/a.txt": "a"})
+	if err := os.Symlink("..", filepath.Join(dir, "sub", "up")); err != nil {
+		t.Skip(err)
+	}
+
+	for _, policy := range []SymlinkPolicy{SymlinkFollow, SymlinkFollowWithinRoot} {
+		_, err := NewSerialFile(dir, Symlinks(policy))
+		if err == nil || !strings.Contains(err.Error(), "symlink cycle at sub/up") {
+			t.Errorf("policy %d: err = %v, want a symlink cycle", policy, err)
+		}
+	}
+}
+
+func TestSymlinkFollowWithinRoot(t *testing.T) {
+	outside := writeTree(t, map[string]string{"secret.txt": "secret"})
+	dir := writeTree(t, map[string]string{"a.txt": "a"})
+	if err := os.Symlink("a.txt", filepath.Join(dir, "inside")); err != nil {
+		t.Skip(err)
+	}
+
+	node, err := NewSerialFile(dir, Symlinks(SymlinkFollowWithinRoot))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := walkPaths(t, node); len(got) != 2 || got[1] != "inside" {
+		t.Errorf("walked %v, want the link inside the root followed", got)
+	}
+
+	if err := os.Symlink(filepath.Join(outside, "secret.txt"), filepath.Join(dir, "outside")); err != nil {
+		t.Fatal(err)
+	}
+	_, err = NewSerialFile(dir, Symlinks(SymlinkFollowWithinRoot))
+	if err == nil || !strings.Contains(err.Error(), "symlink outside points outside of the root") {
+		t.Errorf("err = %v, want the outside link rejected", err)
+	}
+	if _, err := NewSerialFile(dir); err != nil {
+		t.Errorf("SymlinkFollow: %v", err)
+	}
+}
+
+func TestSymlinkSkip(t *testing.T) {
+	dir := writeTree(t, map[string]string{"a.txt": "a", "sub/b.txt": "b"})
+	if err := os.Symlink("../a.txt", filepath.Join(dir, "sub", "link")); err != nil {
+		t.Skip(err)
+	}
+	if err := os.Symlink("sub", filepath.Join(dir, "dirlink")); err != nil {
+		t.Fatal(err)
+	}
+
+	node, err := NewSerialFile(dir, Symlinks(SymlinkSkip))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"a.txt", "sub/b.txt"}
+	if got := walkPaths(t, node); !reflect.DeepEqual(got, want) {
+		t.Errorf("walked %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,51 @@
+package justpin_ipfs
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+
+	"github.com/heilart1n/justpin-ipfs/dag"
+	"github.com/heilart1n/justpin-ipfs/file"
+	"github.com/heilart1n/justpin-ipfs/pinners"
+)
+
+// PinFS pins the file or directory at root in fsys, "." for all of it,
+// with the pinner's walk options. Pinners without PinNode get the DAG
+// built locally as a CAR.
+func PinFS(pinner pinners.Pinner, fsys fs.FS, root string) (pinners.Result, error) {
+	var opts []file.Option
+	if wc, ok := pinner.(pinners.WalkConfigurer); ok {
+		opts = wc.WalkOptions()
+	}
+
+	node, err := file.NewFSFile(fsys, root, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return pinNode(pinner, node)
+}
+
+// PinReaders pins the named readers as one directory, see file.NewReaderDir.
+func PinReaders(pinner pinners.Pinner, entries map[string]io.Reader) (pinners.Result, error) {
+	node, err := file.NewReaderDir(entries)
+	if err != nil {
+		return nil, err
+	}
+	return pinNode(pinner, node)
+}
+
+func pinNode(pinner pinners.Pinner, node *file.Node) (pinners.Result, error) {
+	if np, ok := pinner.(pinners.NodePinner); ok {
+		return np.PinNode(node)
+	}
+
+	ctx := context.Background()
+	b := dag.NewBuilder()
+	nd, err := b.AddNode(ctx, node)
+	if err != nil {
+		return nil, fmt.Errorf("build dag failed: %v", err)
+	}
+	return b.Pin(ctx, pinner, nd.Cid())
+}
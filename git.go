@@ -0,0 +1,46 @@
+package justpin_ipfs
+
+import (
+	"context"
+
+	"github.com/heilart1n/justpin-ipfs/dag"
+	"github.com/heilart1n/justpin-ipfs/file"
+	"github.com/heilart1n/justpin-ipfs/pinners"
+)
+
+// GitResult is the Result of PinGit along with the commit that was pinned.
+type GitResult struct {
+	pinners.Result
+	// Commit is the full hash of the pinned commit.
+	Commit string
+}
+
+// GitOption configures the archive PinGit uploads.
+type GitOption func(*file.Archive)
+
+// GitSkipLinks leaves the symlinks of the tree out instead of failing.
+func GitSkipLinks() GitOption {
+	return func(a *file.Archive) {
+		a.SkipLinks = true
+	}
+}
+
+// PinGit pins the tree of the git repository at repo at revision rev, a
+// branch, tag or commit, as a directory. Paths marked `export-ignore` are
+// left out, see file.GitArchive. It needs git in the PATH, and fails on a
+// tree holding symlinks unless GitSkipLinks is given.
+func PinGit(pinner pinners.Pinner, repo, rev string, opts ...GitOption) (*GitResult, error) {
+	archive, commit, err := file.GitArchive(repo, rev)
+	if err != nil {
+		return nil, err
+	}
+	for _, opt := range opts {
+		opt(archive)
+	}
+
+	result, err := dag.PinArchive(context.Background(), pinner, archive)
+	if err != nil {
+		return nil, err
+	}
+	return &GitResult{Result: result, Commit: commit}, nil
+}
@@ -0,0 +1,54 @@
+package justpin_ipfs
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/heilart1n/justpin-ipfs/pinners/dryrun"
+)
+
+func TestPinGitSkipLinks(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	repo := t.TempDir()
+	if err := os.WriteFile(filepath.Join(repo, "a.txt"), []byte("a"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("a.txt", filepath.Join(repo, "link")); err != nil {
+		t.Skip(err)
+	}
+	for _, args := range [][]string{
+		{"init", "-q"},
+		{"add", "-A"},
+		{"-c", "user.name=test", "-c", "user.email=test@example.com", "commit", "-q", "-m", "init"},
+	} {
+		if out, err := exec.Command("git", append([]string{"-C", repo}, args...)...).CombinedOutput(); err != nil {
+			t.Fatalf("git %s: %v: %s", args[0], err, out)
+		}
+	}
+
+	pinner := dryrun.NewClient(nil)
+	if _, err := PinGit(pinner, repo, "HEAD"); err == nil || !strings.Contains(err.Error(), "link") {
+		t.Errorf("tree with a symlink: err = %v, want an error naming it", err)
+	}
+
+	result, err := PinGit(pinner, repo, "HEAD", GitSkipLinks())
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "a.txt"), []byte("a"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	want, err := pinner.PinDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.GetHash() != want.GetHash() || len(result.Commit) != 40 {
+		t.Errorf("pinned %s at %q, want %s without the link", result.GetHash(), result.Commit, want.GetHash())
+	}
+}
@@ -2,20 +2,33 @@ package http
 
 import (
 	"github.com/ybbus/httpretry"
+	"io"
 	"net/http"
+	"sync"
 	"time"
 )
 
 func NewClient(client *http.Client) *http.Client {
+	return newClient(client, func() bool { return false })
+}
+
+// newClient returns the retrying client of NewClient, which stops retrying
+// once stop returns true. client is copied, not wrapped in place, so that
+// it doesn't stack retries when shared, as http.DefaultClient is.
+func newClient(client *http.Client, stop func() bool) *http.Client {
 	if client == nil {
 		client = http.DefaultClient
 	}
+	c := *client
 	return httpretry.NewCustomClient(
-		client,
+		&c,
 		// retry 5 times
 		httpretry.WithMaxRetryCount(5),
 		// retry on status == 429, if status >= 500, if err != nil, or if response was nil (status == 0)
 		httpretry.WithRetryPolicy(func(statusCode int, err error) bool {
+			if stop() {
+				return false
+			}
 			return err != nil || statusCode == http.StatusTooManyRequests || statusCode >= http.StatusInternalServerError || statusCode == 0
 		}),
 		// every retry should wait one more 10 second
@@ -23,3 +36,64 @@ func NewClient(client *http.Client) *http.Client {
 		httpretry.WithBackoffPolicy(httpretry.ExponentialBackoff(5*time.Second, time.Minute, time.Second)),
 	)
 }
+
+// Do sends req with the retries of NewClient when its body can be produced
+// again, i.e. it has a GetBody func as set by NewRequest. Any other body is
+// a stream read once: it's sent without retries rather than buffered in
+// memory first. An error reading the body, such as a file failing
+// mid-upload, fails the request at once instead of being retried.
+func Do(client *http.Client, req *http.Request) (*http.Response, error) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		return client.Do(req)
+	}
+
+	var failed bodyFailure
+	if getBody := req.GetBody; getBody != nil {
+		req.GetBody = func() (io.ReadCloser, error) {
+			rc, err := getBody()
+			if err != nil {
+				// httpretry drops the error, the body returns it instead
+				rc = io.NopCloser(errReader{err})
+			}
+			return &trackedBody{ReadCloser: rc, failed: &failed}, nil
+		}
+	}
+	return newClient(client, failed.isSet).Do(req)
+}
+
+// bodyFailure records that reading a request body failed.
+type bodyFailure struct {
+	mu  sync.Mutex
+	set bool
+}
+
+func (f *bodyFailure) isSet() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.set
+}
+
+// trackedBody is a request body reporting its read errors to failed.
+type trackedBody struct {
+	io.ReadCloser
+	failed *bodyFailure
+}
+
+func (b *trackedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if err != nil && err != io.EOF {
+		b.failed.mu.Lock()
+		b.failed.set = true
+		b.failed.mu.Unlock()
+	}
+	return n, err
+}
+
+type errReader struct{ err error }
+
+func (r errReader) Read([]byte) (int, error) {
+	return 0, r.err
+}
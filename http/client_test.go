@@ -0,0 +1,108 @@
+package http
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestDoStreamsBody(t *testing.T) {
+	var requests int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		if r.ContentLength != -1 {
+			t.Errorf("content length = %d, want a streamed body", r.ContentLength)
+		}
+		data, _ := io.ReadAll(r.Body)
+		io.WriteString(w, string(data))
+	}))
+	defer srv.Close()
+
+	pr, pw := io.Pipe()
+	go func() {
+		io.WriteString(pw, "streamed body")
+		pw.Close()
+	}()
+	req, err := NewRequest(http.MethodPost, srv.URL, pr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := Do(srv.Client(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(resp.Body)
+	if string(data) != "streamed body" {
+		t.Errorf("server read %q", data)
+	}
+	if n := atomic.LoadInt32(&requests); n != 1 {
+		t.Errorf("%d requests, want 1", n)
+	}
+}
+
+func TestDoFailsOnBodyError(t *testing.T) {
+	var requests int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		io.Copy(io.Discard, r.Body)
+	}))
+	defer srv.Close()
+
+	errBroken := errors.New("file broken")
+	for name, body := range map[string]io.Reader{
+		"stream": io.MultiReader(strings.NewReader("partial"), errReader{errBroken}),
+		"getter": &failingGetter{err: errBroken},
+	} {
+		atomic.StoreInt32(&requests, 0)
+		req, err := NewRequest(http.MethodPost, srv.URL, body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := Do(srv.Client(), req); !errors.Is(err, errBroken) {
+			t.Errorf("%s: err = %v, want %v", name, err, errBroken)
+		}
+		if n := atomic.LoadInt32(&requests); n > 1 {
+			t.Errorf("%s: %d requests, want no retry", name, n)
+		}
+	}
+}
+
+// failingGetter is a replayable body failing after a few bytes.
+type failingGetter struct {
+	err error
+}
+
+func (g *failingGetter) Read(p []byte) (int, error) {
+	return 0, g.err
+}
+
+func (g *failingGetter) GetBody() (io.ReadCloser, error) {
+	return io.NopCloser(io.MultiReader(strings.NewReader("partial"), errReader{g.err})), nil
+}
+
+func TestDoKeepsClient(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	client := srv.Client()
+	transport := client.Transport
+	for i := 0; i < 2; i++ {
+		req, err := http.NewRequest(http.MethodGet, srv.URL, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := Do(client, req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+	if client.Transport != transport {
+		t.Errorf("Do wrapped the transport of the client it was given")
+	}
+}
@@ -0,0 +1,99 @@
+package http
+
+import (
+	"io"
+	"mime/multipart"
+	"sync"
+)
+
+// NewMultipartBody returns a multipart form holding rd as its single file
+// part, and the Content-Type of the form. The form is written through a
+// pipe as it's read, an error reading rd fails it rather than ending it
+// early. It can be produced again for retries when rd is a BodyGetter or a
+// sized io.ReaderAt such as a bytes.Reader.
+func NewMultipartBody(field, filename string, rd io.Reader) (io.Reader, string) {
+	boundary := multipart.NewWriter(nil).Boundary()
+	body := newMultipartBody(field, filename, boundary, rd, nil)
+
+	var getBody func() (io.ReadCloser, error)
+	switch v := rd.(type) {
+	case BodyGetter:
+		getBody = v.GetBody
+	case sizedReaderAt:
+		getBody = func() (io.ReadCloser, error) {
+			return io.NopCloser(io.NewSectionReader(v, 0, v.Size())), nil
+		}
+	}
+	contentType := "multipart/form-data; boundary=" + boundary
+	if getBody == nil {
+		return body, contentType
+	}
+	return &replayableMultipartBody{multipartBody: body, getBody: getBody}, contentType
+}
+
+type sizedReaderAt interface {
+	io.ReaderAt
+	Size() int64
+}
+
+type multipartBody struct {
+	*io.PipeReader
+	pw    *io.PipeWriter
+	start sync.Once
+
+	field, filename, boundary string
+	rd                        io.Reader
+	closer                    io.Closer
+}
+
+func newMultipartBody(field, filename, boundary string, rd io.Reader, closer io.Closer) *multipartBody {
+	pr, pw := io.Pipe()
+	return &multipartBody{
+		PipeReader: pr,
+		pw:         pw,
+		field:      field,
+		filename:   filename,
+		boundary:   boundary,
+		rd:         rd,
+		closer:     closer,
+	}
+}
+
+// Read reads the form, it's written from the first call on.
+func (b *multipartBody) Read(p []byte) (int, error) {
+	b.start.Do(func() { go b.write() })
+	return b.PipeReader.Read(p)
+}
+
+func (b *multipartBody) write() {
+	if b.closer != nil {
+		defer b.closer.Close()
+	}
+	m := multipart.NewWriter(b.pw)
+	err := m.SetBoundary(b.boundary)
+	var part io.Writer
+	if err == nil {
+		part, err = m.CreateFormFile(b.field, b.filename)
+	}
+	if err == nil {
+		_, err = io.Copy(part, b.rd)
+	}
+	if err == nil {
+		err = m.Close()
+	}
+	b.pw.CloseWithError(err)
+}
+
+type replayableMultipartBody struct {
+	*multipartBody
+	getBody func() (io.ReadCloser, error)
+}
+
+// GetBody returns a new reader producing the same form from the start.
+func (b *replayableMultipartBody) GetBody() (io.ReadCloser, error) {
+	rc, err := b.getBody()
+	if err != nil {
+		return nil, err
+	}
+	return newMultipartBody(b.field, b.filename, b.boundary, rc, rc), nil
+}
@@ -0,0 +1,26 @@
+package http
+
+import (
+	"io"
+	"net/http"
+)
+
+// BodyGetter is implemented by request bodies that can be produced again
+// from the start, such as file.MultiFileReader.
+type BodyGetter interface {
+	GetBody() (io.ReadCloser, error)
+}
+
+// NewRequest wraps http.NewRequest. When body is a BodyGetter the request
+// gets a GetBody func, so retries re-create the body instead of buffering
+// all of it in memory first.
+func NewRequest(method, url string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequest(method, url, body)
+	if err != nil {
+		return nil, err
+	}
+	if bg, ok := body.(BodyGetter); ok {
+		req.GetBody = bg.GetBody
+	}
+	return req, nil
+}
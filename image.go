@@ -0,0 +1,15 @@
+package justpin_ipfs
+
+import (
+	"context"
+
+	"github.com/heilart1n/justpin-ipfs/dag"
+	"github.com/heilart1n/justpin-ipfs/pinners"
+)
+
+// PinImage pins the container image at fp, an OCI image layout directory or
+// a `docker save` tarball, as an OCI image layout through a pinner that
+// accepts CARs. See dag.Builder.AddImage.
+func PinImage(pinner pinners.Pinner, fp string) (pinners.Result, error) {
+	return dag.PinImage(context.Background(), pinner, fp)
+}
@@ -0,0 +1,47 @@
+package justpin_ipfs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/heilart1n/justpin-ipfs/dag"
+	"github.com/heilart1n/justpin-ipfs/file"
+	"github.com/heilart1n/justpin-ipfs/pinners"
+)
+
+// ErrManifestRoot is returned when a locally computed manifest doesn't have
+// the root the provider returned, e.g. because the provider wrapped the
+// upload in a directory or chunked the files differently. The file CIDs
+// only match the provider's when it uses the same chunker, raw leaves and
+// CID version as dag.Builder.
+var ErrManifestRoot = errors.New("manifest root differs from pinned root")
+
+// PinDirWithManifest pins the directory at name and returns the result with
+// a manifest of every entry below it. The manifest reported by the provider
+// is used when it has one, otherwise it is computed locally.
+func PinDirWithManifest(pinner pinners.Pinner, name string) (pinners.Result, *pinners.Manifest, error) {
+	result, err := pinner.PinDir(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	if mr, ok := result.(pinners.ManifestResult); ok && mr.Manifest() != nil {
+		return result, mr.Manifest(), nil
+	}
+
+	var opts []file.Option
+	if wc, ok := pinner.(pinners.WalkConfigurer); ok {
+		opts = wc.WalkOptions()
+	}
+
+	manifest, err := dag.Manifest(context.Background(), name, opts...)
+	if err != nil {
+		return result, nil, fmt.Errorf("compute manifest failed: %v", err)
+	}
+	if manifest.Root != result.GetHash() {
+		err = fmt.Errorf("%w: %s != %s", ErrManifestRoot, manifest.Root, result.GetHash())
+		manifest.Root = result.GetHash()
+	}
+
+	return result, manifest, err
+}
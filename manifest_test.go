@@ -0,0 +1,66 @@
+package justpin_ipfs
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/heilart1n/justpin-ipfs/dag"
+	"github.com/heilart1n/justpin-ipfs/pinners"
+)
+
+// dirPinner reports hash for every directory it pins.
+type dirPinner struct {
+	pinners.Pinner
+	hash     string
+	manifest *pinners.Manifest
+}
+
+func (p dirPinner) PinDir(string) (pinners.Result, error) {
+	return dirResult{p.hash, p.manifest}, nil
+}
+
+type dirResult struct {
+	hash     string
+	manifest *pinners.Manifest
+}
+
+func (r dirResult) GetHash() string             { return r.hash }
+func (r dirResult) GetLink() string             { return "" }
+func (r dirResult) Manifest() *pinners.Manifest { return r.manifest }
+
+func TestPinDirWithManifest(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "a.txt"), []byte("a"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	local, err := dag.Manifest(context.Background(), dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, manifest, err := PinDirWithManifest(dirPinner{hash: local.Root}, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e, ok := manifest.Lookup("a.txt"); manifest.Root != local.Root || !ok || e != local.Entries[0] {
+		t.Errorf("manifest %+v, want %+v", manifest, local)
+	}
+
+	// A provider wrapping the upload reports another root.
+	_, manifest, err = PinDirWithManifest(dirPinner{hash: "bafywrapped"}, dir)
+	if !errors.Is(err, ErrManifestRoot) {
+		t.Errorf("err = %v, want ErrManifestRoot", err)
+	}
+	if manifest == nil || manifest.Root != "bafywrapped" {
+		t.Errorf("manifest %+v, want the pinned root", manifest)
+	}
+
+	// The provider's manifest is used as it is.
+	reported := &pinners.Manifest{Root: "bafyreported"}
+	if _, manifest, err = PinDirWithManifest(dirPinner{hash: "bafyreported", manifest: reported}, dir); err != nil || manifest != reported {
+		t.Errorf("manifest %+v (%v), want the reported one", manifest, err)
+	}
+}
@@ -3,7 +3,9 @@ package justpin_ipfs
 import (
 	"fmt"
 	"github.com/heilart1n/justpin-ipfs/config"
+	"github.com/heilart1n/justpin-ipfs/file"
 	"github.com/heilart1n/justpin-ipfs/pinners"
+	"github.com/heilart1n/justpin-ipfs/pinners/dryrun"
 	"github.com/heilart1n/justpin-ipfs/pinners/infura"
 	"github.com/heilart1n/justpin-ipfs/pinners/nftstorage"
 	"github.com/heilart1n/justpin-ipfs/pinners/pinata"
@@ -71,3 +73,49 @@ func (pinners *Pinners) MustGetPinner(client ClientName) pinners.Pinner {
 		return pinners.NFTStorage
 	}
 }
+
+// DryRun returns Pinners computing what each provider would pin, with root
+// and per-file CIDs, DAG size and file count, without making any request.
+// Unset pinners stay unset.
+func (pinners *Pinners) DryRun() *Pinners {
+	return &Pinners{
+		Infura:      dryRun(pinners.Infura),
+		NFTStorage:  dryRun(pinners.NFTStorage),
+		Pinata:      dryRun(pinners.Pinata),
+		Web3Storage: dryRun(pinners.Web3Storage),
+	}
+}
+
+func dryRun(p pinners.Pinner) pinners.Pinner {
+	if p == nil {
+		return nil
+	}
+	return dryrun.NewClient(p)
+}
+
+// SetWalkOptions applies the same walk options, such as ignore rules or
+// skipping hidden files, to PinFile and PinDir of every pinner.
+func (pinners *Pinners) SetWalkOptions(opts ...file.Option) {
+	setWalkOptions(pinners.Infura, opts)
+	setWalkOptions(pinners.NFTStorage, opts)
+	setWalkOptions(pinners.Pinata, opts)
+	setWalkOptions(pinners.Web3Storage, opts)
+}
+
+func setWalkOptions(p pinners.Pinner, opts []file.Option) {
+	if wc, ok := p.(pinners.WalkConfigurer); ok {
+		wc.SetWalkOptions(opts...)
+	}
+}
+
+// All returns the pinners that are set, e.g. to dispatch to every provider.
+// NewPinners sets all of them, configured or not: to dispatch to the
+// configured providers only, set their fields alone.
+func (pinners *Pinners) All() (all []pinners.Pinner) {
+	for _, p := range append(all, pinners.Infura, pinners.NFTStorage, pinners.Pinata, pinners.Web3Storage) {
+		if p != nil {
+			all = append(all, p)
+		}
+	}
+	return all
+}
@@ -0,0 +1,35 @@
+package dryrun
+
+import (
+	"github.com/heilart1n/justpin-ipfs/file"
+	"github.com/heilart1n/justpin-ipfs/pinners"
+)
+
+const (
+	ClientName = "DryRun"
+	IPFSUrl    = "ipfs://%s"
+)
+
+// Client DryRun computes what the wrapped pinner would pin, offline. Every
+// pin operation builds the DAG locally and makes no HTTP request.
+type Client struct {
+	target     pinners.Pinner
+	clientName string
+	file.WalkConfig
+}
+
+func NewClient(target pinners.Pinner) *Client {
+	return &Client{target: target, clientName: ClientName}
+}
+
+// WalkOptions returns the options set on the client, or else those of the
+// wrapped pinner, so that a dry run walks directories as the pin would.
+func (client *Client) WalkOptions() []file.Option {
+	if opts := client.WalkConfig.WalkOptions(); opts != nil {
+		return opts
+	}
+	if wc, ok := client.target.(pinners.WalkConfigurer); ok {
+		return wc.WalkOptions()
+	}
+	return nil
+}
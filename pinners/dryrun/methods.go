@@ -0,0 +1,195 @@
+package dryrun
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/heilart1n/justpin-ipfs/dag"
+	"github.com/heilart1n/justpin-ipfs/file"
+	"github.com/heilart1n/justpin-ipfs/pinners"
+	"github.com/ipfs/go-cid"
+	ipld "github.com/ipfs/go-ipld-format"
+	"github.com/multiformats/go-multihash"
+	"io"
+	"os"
+)
+
+// Name returns the name of the wrapped pinner, or ClientName without one.
+func (client *Client) Name() string {
+	if client.target == nil {
+		return ClientName
+	}
+	return client.target.Name()
+}
+
+// Offline reports that the client makes no request, helpers that would read
+// content from the network refuse it.
+func (client *Client) Offline() bool {
+	return true
+}
+
+// PinFile computes the root CID, manifest and size of the file or directory
+// at fp.
+func (client *Client) PinFile(fp string) (pinners.Result, error) {
+	node, err := file.NewSerialFile(fp, client.WalkOptions()...)
+	if err != nil {
+		return nil, err
+	}
+	return client.PinNode(node)
+}
+
+// PinNode computes the root CID, manifest and size of a file or directory
+// Node.
+func (client *Client) PinNode(node *file.Node) (pinners.Result, error) {
+	ctx := context.Background()
+	b := newBuilder()
+	nd, err := b.AddNode(ctx, node)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := client.newResult(nd, RouteForm)
+	if err != nil {
+		return nil, err
+	}
+	_ = node.Walk(func(_ string, fi os.FileInfo) error {
+		if !fi.IsDir() {
+			result.files++
+		}
+		return nil
+	})
+	if node.IsDir() {
+		if result.manifest, err = b.Manifest(ctx, nd.Cid()); err != nil {
+			return nil, err
+		}
+	}
+
+	return result, nil
+}
+
+// PinURL fails: the content of rawURL would have to be downloaded, and the
+// client makes no request.
+func (client *Client) PinURL(rawURL string, maxSize int64) (pinners.Result, error) {
+	return nil, fmt.Errorf("%s: dry run is offline, can't download %s", client.Name(), rawURL)
+}
+
+// PinWithReader computes the CID of the content of rd, which is consumed.
+func (client *Client) PinWithReader(rd io.Reader) (pinners.Result, error) {
+	nd, err := newBuilder().AddReader(context.Background(), rd)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := client.newResult(nd, RouteForm)
+	if err != nil {
+		return nil, err
+	}
+	result.files = 1
+
+	return result, nil
+}
+
+// PinWithBytes computes the CID of buf.
+func (client *Client) PinWithBytes(buf []byte) (pinners.Result, error) {
+	return client.PinWithReader(bytes.NewReader(buf))
+}
+
+// PinCAR reads the CAR and reports its root and the size of its blocks. It
+// fails like the wrapped pinner when that one doesn't accept CARs.
+func (client *Client) PinCAR(rd io.Reader) (pinners.Result, error) {
+	if _, ok := client.target.(pinners.CARPinner); !ok && client.target != nil {
+		return nil, fmt.Errorf("%s: pinner does not accept CARs", client.Name())
+	}
+
+	var size uint64
+	roots, err := dag.ReadCAR(rd, func(_ cid.Cid, data []byte) error {
+		size += uint64(len(data))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	result := client.NewResult(roots[0].String())
+	result.size = size
+	result.route = RouteCAR
+
+	return result, nil
+}
+
+// PinBlock computes the CID of the block buf. A wrapped pinner that can't
+// store single blocks would get it in a CAR, as dag.Builder.Pin does.
+func (client *Client) PinBlock(codec string, buf []byte) (pinners.Result, error) {
+	route := RouteBlock
+	if _, ok := client.target.(pinners.BlockPinner); !ok && client.target != nil {
+		if _, ok := client.target.(pinners.CARPinner); !ok {
+			return nil, fmt.Errorf("%s: pinner does not accept CARs", client.Name())
+		}
+		route = RouteCAR
+	}
+
+	c, ok := blockCodecs[codec]
+	if !ok {
+		return nil, fmt.Errorf("unsupported codec %q", codec)
+	}
+	sum, err := cid.V1Builder{Codec: c, MhType: multihash.SHA2_256}.Sum(buf)
+	if err != nil {
+		return nil, err
+	}
+
+	result := client.NewResult(sum.String())
+	result.size = uint64(len(buf))
+	result.route = route
+
+	return result, nil
+}
+
+// blockCodecs maps the codec names of PinBlock to their codes.
+var blockCodecs = map[string]uint64{
+	"dag-pb": cid.DagProtobuf,
+	"raw":    cid.Raw,
+}
+
+// PinHash checks that hash is a valid CID.
+func (client *Client) PinHash(hash string) (bool, error) {
+	if _, err := cid.Decode(hash); err != nil {
+		return false, fmt.Errorf("invalid hash: %s", hash)
+	}
+	return true, nil
+}
+
+// PinDir computes the pin of a directory.
+// It alias to PinFile.
+func (client *Client) PinDir(name string) (pinners.Result, error) {
+	return client.PinFile(name)
+}
+
+// PinArchive expands a and pins it as a directory.
+func (client *Client) PinArchive(a *file.Archive) (pinners.Result, error) {
+	return dag.PinArchive(context.Background(), client, a)
+}
+
+func (client *Client) Pin(path interface{}) (pinners.Result, error) {
+	return pinners.Pin(client, path)
+}
+
+func (client *Client) newResult(nd ipld.Node, route string) (*Result, error) {
+	size, err := nd.Size()
+	if err != nil {
+		return nil, err
+	}
+
+	result := client.NewResult(nd.Cid().String())
+	result.size = size
+	result.route = route
+
+	return result, nil
+}
+
+// newBuilder returns a Builder that keeps the directory nodes only, the
+// file data is hashed and dropped.
+func newBuilder() *dag.Builder {
+	b := dag.NewBuilder()
+	b.SetDiscardLeaves(true)
+	return b
+}
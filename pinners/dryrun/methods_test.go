@@ -0,0 +1,180 @@
+package dryrun
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/heilart1n/justpin-ipfs/dag"
+	"github.com/heilart1n/justpin-ipfs/file"
+	"github.com/heilart1n/justpin-ipfs/pinners"
+	"github.com/ipfs/go-cid"
+)
+
+// namedPinner is a Pinner that only has a name.
+type namedPinner struct {
+	pinners.Pinner
+}
+
+func (namedPinner) Name() string {
+	return "named"
+}
+
+// walkPinner is a namedPinner with walk options.
+type walkPinner struct {
+	namedPinner
+	file.WalkConfig
+}
+
+// carPinner is a namedPinner that accepts CARs.
+type carPinner struct {
+	namedPinner
+}
+
+func (carPinner) PinCAR(io.Reader) (pinners.Result, error) {
+	return nil, nil
+}
+
+func TestNilTarget(t *testing.T) {
+	client := NewClient(nil)
+	if client.Name() != ClientName {
+		t.Errorf("name %q, want %q", client.Name(), ClientName)
+	}
+	result, err := client.PinWithBytes([]byte("hello world"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "bafkreifzjut3te2nhyekklss27nh3k72ysco7y32koao5eei66wof36n5e"; result.GetHash() != want {
+		t.Errorf("hash %s, want %s", result.GetHash(), want)
+	}
+	if r := result.(*Result); r.Provider() != "" || r.Route() != RouteForm {
+		t.Errorf("provider %q, route %q", r.Provider(), r.Route())
+	}
+}
+
+func TestRoutes(t *testing.T) {
+	ctx := context.Background()
+	b := dag.NewBuilder()
+	dir, err := b.Directory(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A single block goes to dag/put, or in a CAR if the pinner has none.
+	result, err := b.Pin(ctx, NewClient(carPinner{}), dir.Cid())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r := result.(*Result); r.Route() != RouteCAR || r.Provider() != "named" || r.GetHash() != dir.Cid().String() {
+		t.Errorf("route %q, provider %q, hash %s", r.Route(), r.Provider(), r.GetHash())
+	}
+
+	if _, err := b.Pin(ctx, NewClient(namedPinner{}), dir.Cid()); err == nil {
+		t.Error("CAR to a pinner without CARs: no error")
+	}
+}
+
+func TestOffline(t *testing.T) {
+	root, _ := cid.Decode("bafybeiczsscdsbs7ffqz55asqdf3smv6klcw3gofszvwlyarci47bgf354")
+	_, err := dag.PinPatch(context.Background(), NewClient(carPinner{}), dag.Patch{
+		Root: root,
+		Ops:  []dag.Op{dag.AddEntry("a", root)},
+	})
+	if err == nil {
+		t.Error("patch read the root from the network")
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("dry run downloaded the URL")
+	}))
+	defer srv.Close()
+	if _, err := NewClient(nil).PinURL(srv.URL, 0); err == nil {
+		t.Error("PinURL: no error")
+	}
+}
+
+// writeTree writes files, by slash separated path, under a new directory.
+func writeTree(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		fp := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(fp), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(fp, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestPinFileDirectory(t *testing.T) {
+	dir := writeTree(t, map[string]string{
+		"index.html":   "<p>hello</p>",
+		"css/site.css": "p {}",
+		"big.bin":      string(make([]byte, 1<<20)),
+	})
+	node, err := file.NewSerialFile(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := dag.NewBuilder().AddNode(context.Background(), node)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := NewClient(nil).PinFile(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := result.(*Result)
+	if r.GetHash() != want.Cid().String() || r.Files() != 3 {
+		t.Errorf("pinned %s with %d files, want %s with 3", r.GetHash(), r.Files(), want.Cid())
+	}
+	css, err := NewClient(nil).PinWithBytes([]byte("p {}"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e, ok := r.Manifest().Lookup("css/site.css"); !ok || e.Cid != css.GetHash() {
+		t.Errorf("manifest entry %+v, want %s", e, css.GetHash())
+	}
+}
+
+func TestWalkOptions(t *testing.T) {
+	dir := writeTree(t, map[string]string{
+		"index.html":      "<p>hello</p>",
+		"notes.txt":       "draft",
+		".git/HEAD":       "ref: refs/heads/main",
+		"css/site.css":    "p {}",
+		"css/site.css.gz": "gzip",
+	})
+	opts := []file.Option{file.SkipHidden(), file.IgnorePatterns("*.txt", "*.gz")}
+	want, err := file.NewSerialFile(dir, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantNd, err := dag.NewBuilder().AddNode(context.Background(), want)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// set on the wrapped pinner, or on the dry run itself
+	target := &walkPinner{}
+	target.SetWalkOptions(opts...)
+	own := NewClient(nil)
+	own.SetWalkOptions(opts...)
+	for _, client := range []*Client{NewClient(target), own} {
+		result, err := client.PinFile(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if r := result.(*Result); r.GetHash() != wantNd.Cid().String() || r.Files() != 2 {
+			t.Errorf("%s: pinned %s with %d files, want %s with 2", client.Name(), r.GetHash(), r.Files(), wantNd.Cid())
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package dryrun
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/heilart1n/justpin-ipfs/pinners"
+)
+
+// The routes a pin would take to the wrapped pinner.
+const (
+	// RouteForm is a multipart upload of files.
+	RouteForm = "form"
+	// RouteCAR is a CAR import.
+	RouteCAR = "car"
+	// RouteBlock is a single block put.
+	RouteBlock = "block"
+)
+
+// Result describes a pin that wasn't made.
+type Result struct {
+	hash     string
+	link     string
+	provider string
+	route    string
+	size     uint64
+	files    int
+	manifest *pinners.Manifest
+}
+
+func (client *Client) NewResult(hash string) *Result {
+	result := &Result{hash: hash, link: fmt.Sprintf(IPFSUrl, hash)}
+	if client.target != nil {
+		result.provider = client.target.Name()
+	}
+	return result
+}
+
+func (result *Result) GetHash() string {
+	return result.hash
+}
+
+func (result *Result) GetLink() string {
+	return result.link
+}
+
+// Provider returns the name of the wrapped pinner the content would be sent
+// to, empty without one.
+func (result *Result) Provider() string {
+	return result.provider
+}
+
+// Route returns how the content would be sent to the provider: RouteForm,
+// RouteCAR or RouteBlock.
+func (result *Result) Route() string {
+	return result.route
+}
+
+// Size returns the total DAG size in bytes.
+func (result *Result) Size() uint64 {
+	return result.size
+}
+
+// Files returns the number of files that would be uploaded.
+func (result *Result) Files() int {
+	return result.files
+}
+
+// Manifest returns the CID of every entry, it is nil for single files.
+func (result *Result) Manifest() *pinners.Manifest {
+	return result.manifest
+}
+
+func (result *Result) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Hash     string            `json:"hash"`
+		Provider string            `json:"provider,omitempty"`
+		Route    string            `json:"route"`
+		Size     uint64            `json:"size"`
+		Files    int               `json:"files"`
+		Manifest *pinners.Manifest `json:"manifest,omitempty"`
+	}{result.hash, result.provider, result.route, result.size, result.files, result.manifest})
+}
@@ -2,6 +2,7 @@ package infura
 
 import (
 	"github.com/heilart1n/justpin-ipfs/config"
+	"github.com/heilart1n/justpin-ipfs/file"
 	"net/http"
 )
 
@@ -17,6 +18,7 @@ type Client struct {
 	*http.Client
 	cfg        config.Config
 	clientName string
+	file.WalkConfig
 }
 
 func NewClient(cfg config.Config, httpClient *http.Client) *Client {
@@ -1,16 +1,20 @@
 package infura
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"github.com/heilart1n/justpin-ipfs/dag"
 	"github.com/heilart1n/justpin-ipfs/file"
 	httpretry "github.com/heilart1n/justpin-ipfs/http"
 	"github.com/heilart1n/justpin-ipfs/pinners"
 	"io"
-	"mime/multipart"
 	"net/http"
-	"os"
+	"net/url"
+	"strconv"
+	"strings"
 )
 
 func (client *Client) Name() string {
@@ -20,7 +24,23 @@ func (client *Client) Name() string {
 // PinFile pins content to Infura by providing a file path, it returns an IPFS
 // hash and an error.
 func (client *Client) PinFile(fp string) (pinners.Result, error) {
-	mfr, err := file.NewMultiFileReader(fp, false, false)
+	f, err := file.NewSerialFile(fp, client.WalkOptions()...)
+	if err != nil {
+		return nil, err
+	}
+	return client.PinNode(f)
+}
+
+// PinNode pins a file or directory Node to Infura, it returns an IPFS hash
+// and an error.
+func (client *Client) PinNode(f *file.Node) (pinners.Result, error) {
+	name := f.Name()
+	if name == "" {
+		name = file.RandString(6, "lower")
+	}
+	f.MapDirectory(name)
+
+	mfr, err := file.NewMultiForm(f, form)
 	if err != nil {
 		return nil, fmt.Errorf("unexpected creates multipart file: %v", err)
 	}
@@ -29,57 +49,39 @@ func (client *Client) PinFile(fp string) (pinners.Result, error) {
 	return client.pinFile(mfr, boundary)
 }
 
+// PinURL pins the content of rawURL to Infura, streamed from the response
+// into the upload. The file keeps its upstream name and Content-Type. A
+// maxSize of zero or less is no limit.
+func (client *Client) PinURL(rawURL string, maxSize int64) (pinners.Result, error) {
+	return pinners.PinURL(client, httpretry.NewClient(client.Client), rawURL, maxSize)
+}
+
 // PinWithReader pins content to Infura by given io.Reader, it returns an IPFS hash and an error.
 func (client *Client) PinWithReader(rd io.Reader) (pinners.Result, error) {
-	r, w := io.Pipe()
-	m := multipart.NewWriter(w)
-	fn := file.RandString(6, "lower")
-
-	go func() {
-		defer w.Close()
-		defer m.Close()
-
-		part, err := m.CreateFormFile("file", fn)
-		if err != nil {
-			return
-		}
-
-		if _, err = io.Copy(part, rd); err != nil {
-			return
-		}
-	}()
-
-	return client.pinFile(r, m.FormDataContentType())
+	body, contentType := httpretry.NewMultipartBody("file", file.RandString(6, "lower"), rd)
+	return client.pinFile(body, contentType)
 }
 
 // PinWithBytes pins content to Infura by given byte slice, it returns an IPFS hash and an error.
 func (client *Client) PinWithBytes(buf []byte) (pinners.Result, error) {
-	r, w := io.Pipe()
-	m := multipart.NewWriter(w)
-	fn := file.RandString(6, "lower")
-
-	go func() {
-		defer w.Close()
-		defer m.Close()
-
-		part, err := m.CreateFormFile("file", fn)
-		if err != nil {
-			return
-		}
-
-		if _, err = part.Write(buf); err != nil {
-			return
-		}
-	}()
+	return client.PinWithReader(bytes.NewReader(buf))
+}
 
-	return client.pinFile(r, m.FormDataContentType())
+// form is the multipart layout of Kubo's `/api/v0/add`: a directory part
+// ahead of every directory content, symlink parts and query-escaped file
+// names.
+var form = file.Form{
+	FileField:   "file",
+	Directories: true,
+	Symlinks:    true,
+	Attributes:  true,
+	EncodePath:  url.QueryEscape,
 }
 
 func (client *Client) pinFile(r io.Reader, boundary string) (pinners.Result, error) {
 	endpoint := ApiUrl + "/api/v0/add?cid-version=1&pin=true"
-	httpClient := httpretry.NewClient(client.Client)
 
-	req, err := http.NewRequest(http.MethodPost, endpoint, r)
+	req, err := httpretry.NewRequest(http.MethodPost, endpoint, r)
 	if err != nil {
 		return nil, err
 	}
@@ -87,7 +89,7 @@ func (client *Client) pinFile(r io.Reader, boundary string) (pinners.Result, err
 
 	req.Header.Add("Content-Type", boundary)
 	req.Header.Set("Content-Disposition", `form-data; name="files"`)
-	resp, err := httpClient.Do(req)
+	resp, err := httpretry.Do(client.Client, req)
 	if err != nil {
 		return nil, err
 	}
@@ -99,7 +101,7 @@ func (client *Client) pinFile(r io.Reader, boundary string) (pinners.Result, err
 		return nil, fmt.Errorf(resp.Status)
 	}
 
-	var out addEvent
+	var events []addEvent
 	dec := json.NewDecoder(resp.Body)
 
 loop:
@@ -112,10 +114,111 @@ loop:
 		default:
 			return nil, err
 		}
-		out = evt
+		if evt.Hash != "" {
+			events = append(events, evt)
+		}
+	}
+	if len(events) == 0 {
+		return nil, fmt.Errorf("add to Infura returned no hash")
+	}
+
+	// The root is reported last, every other event is an entry below it.
+	out := events[len(events)-1]
+	result := client.NewResult(out.Hash)
+	result.manifest = newManifest(out, events[:len(events)-1])
+
+	return result, nil
+}
+
+// newManifest builds a manifest from the add events, the names are made
+// relative to the root.
+func newManifest(root addEvent, events []addEvent) *pinners.Manifest {
+	manifest := &pinners.Manifest{Root: root.Hash, Entries: make([]pinners.ManifestEntry, 0, len(events))}
+	for _, evt := range events {
+		name := evt.Name
+		if root.Name != "" {
+			name = strings.TrimPrefix(strings.TrimPrefix(name, root.Name), "/")
+		}
+		size, _ := strconv.ParseUint(evt.Size, 10, 64)
+		manifest.Entries = append(manifest.Entries, pinners.ManifestEntry{Path: name, Cid: evt.Hash, Size: size})
+	}
+	manifest.Sort()
+	return manifest
+}
+
+// PinCAR imports a CAR to Infura and pins its roots, it returns the root CID
+// and an error. Blocks missing from the CAR are expected to be available on
+// the network already.
+func (client *Client) PinCAR(rd io.Reader) (pinners.Result, error) {
+	body, contentType := httpretry.NewMultipartBody("file", "file.car", rd)
+	resp, err := client.post(ApiUrl+"/api/v0/dag/import?pin-roots=true", body, contentType)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var root string
+	dec := json.NewDecoder(resp.Body)
+	for {
+		var evt importEvent
+		if err := dec.Decode(&evt); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		if evt.Root == nil {
+			continue
+		}
+		if evt.Root.PinErrorMsg != "" {
+			return nil, fmt.Errorf("pin root %s failed: %s", evt.Root.Cid.Value, evt.Root.PinErrorMsg)
+		}
+		root = evt.Root.Cid.Value
+	}
+	if root == "" {
+		return nil, fmt.Errorf("import car to Infura returned no root")
+	}
+
+	return client.NewResult(root), nil
+}
+
+// PinBlock stores a single block with `dag/put` and pins it, it returns the
+// block CID and an error.
+func (client *Client) PinBlock(codec string, buf []byte) (pinners.Result, error) {
+	body, contentType := httpretry.NewMultipartBody("file", "block", bytes.NewReader(buf))
+	endpoint := fmt.Sprintf("%s/api/v0/dag/put?store-codec=%s&input-codec=%s&pin=true", ApiUrl, codec, codec)
+	resp, err := client.post(endpoint, body, contentType)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var out putEvent
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return nil, err
+	}
+
+	return client.NewResult(out.Cid.Value), nil
+}
+
+// post sends a request with retries and returns the response when the
+// status is 200.
+func (client *Client) post(endpoint string, r io.Reader, contentType string) (*http.Response, error) {
+	req, err := httpretry.NewRequest(http.MethodPost, endpoint, r)
+	if err != nil {
+		return nil, err
 	}
+	client.setAuth(req)
+	req.Header.Set("Content-Type", contentType)
 
-	return client.NewResult(out.Hash), nil
+	resp, err := httpretry.Do(client.Client, req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf(resp.Status)
+	}
+	return resp, nil
 }
 
 // PinHash pins content to Infura by giving an IPFS hash, it returns the result and an error.
@@ -131,8 +234,7 @@ func (client *Client) PinHash(hash string) (bool, error) {
 	}
 	client.setAuth(req)
 
-	httpClient := httpretry.NewClient(client.Client)
-	resp, err := httpClient.Do(req)
+	resp, err := httpretry.Do(client.Client, req)
 	if err != nil {
 		return false, err
 	}
@@ -165,6 +267,19 @@ func (client *Client) PinHash(hash string) (bool, error) {
 	return false, fmt.Errorf("pin hash to Infura failed")
 }
 
+// Unpin removes the recursive pin of hash from Infura.
+func (client *Client) Unpin(hash string) error {
+	if hash == "" {
+		return fmt.Errorf("invalid hash: %s", hash)
+	}
+
+	resp, err := client.post(fmt.Sprintf("%s/api/v0/pin/rm?arg=%s", ApiUrl, hash), nil, "application/json")
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
 // PinDir pins a directory to the NFT.Storage pinning service.
 // It alias to PinFile.
 func (client *Client) PinDir(name string) (pinners.Result, error) {
@@ -177,22 +292,11 @@ func (client *Client) setAuth(req *http.Request) {
 	}
 }
 
-func (client *Client) Pin(path interface{}) (result pinners.Result, err error) {
-	err = fmt.Errorf("unsupported pinner")
-	switch v := path.(type) {
-	case string:
-		_, err = os.Lstat(v)
-		if err != nil {
-			return
-		}
-		result, err = client.PinFile(v)
-	case io.Reader:
-		result, err = client.PinWithReader(v)
-	case []byte:
-		result, err = client.PinWithBytes(v)
-	}
-	if err != nil {
-		err = fmt.Errorf("%s: %w", client.Name(), err)
-	}
-	return result, err
+// PinArchive expands a and pins it as a directory.
+func (client *Client) PinArchive(a *file.Archive) (pinners.Result, error) {
+	return dag.PinArchive(context.Background(), client, a)
+}
+
+func (client *Client) Pin(path interface{}) (pinners.Result, error) {
+	return pinners.Pin(client, path)
 }
@@ -0,0 +1,154 @@
+package infura
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/heilart1n/justpin-ipfs/config"
+	"github.com/heilart1n/justpin-ipfs/dag"
+	"github.com/heilart1n/justpin-ipfs/pinners"
+	chunker "github.com/ipfs/boxo/chunker"
+	"github.com/ipfs/boxo/ipld/unixfs/importer/balanced"
+	"github.com/ipfs/boxo/ipld/unixfs/importer/helpers"
+)
+
+// redirect sends every request to the test server srv.
+type redirect struct {
+	srv *httptest.Server
+}
+
+func (rt redirect) RoundTrip(req *http.Request) (*http.Response, error) {
+	u, _ := url.Parse(rt.srv.URL)
+	req.URL.Scheme, req.URL.Host = u.Scheme, u.Host
+	return rt.srv.Client().Transport.RoundTrip(req)
+}
+
+func TestPinCARStreams(t *testing.T) {
+	ctx := context.Background()
+	b := dag.NewBuilder()
+	params := helpers.DagBuilderParams{
+		Dagserv:   b.DAGService(),
+		Maxlinks:  helpers.DefaultLinksPerBlock,
+		RawLeaves: true,
+	}
+	db, err := params.New(chunker.NewSizeSplitter(strings.NewReader(strings.Repeat("x", 4<<20)), chunker.DefaultBlockSize))
+	if err != nil {
+		t.Fatal(err)
+	}
+	nd, err := balanced.Layout(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var want bytes.Buffer
+	if err := b.WriteCAR(ctx, &want, nd.Cid()); err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v0/dag/import" {
+			http.NotFound(w, r)
+			return
+		}
+		if r.ContentLength != -1 {
+			t.Errorf("content length = %d, want a streamed body", r.ContentLength)
+		}
+		part, err := r.MultipartReader()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		p, err := part.NextPart()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		car, err := io.ReadAll(p)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if !bytes.Equal(car, want.Bytes()) {
+			t.Errorf("server read a CAR of %d bytes, want %d", len(car), want.Len())
+		}
+		var evt importEvent
+		evt.Root = &struct {
+			Cid         cidLink
+			PinErrorMsg string `json:",omitempty"`
+		}{Cid: cidLink{Value: nd.Cid().String()}}
+		json.NewEncoder(w).Encode(evt)
+	}))
+	defer srv.Close()
+
+	client := NewClient(config.NewConfig("key", "secret"), &http.Client{Transport: redirect{srv}})
+	result, err := b.Pin(ctx, client, nd.Cid())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.GetHash() != nd.Cid().String() {
+		t.Errorf("pinned %s, want %s", result.GetHash(), nd.Cid())
+	}
+}
+
+func TestPinDirManifest(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(dir, "sub"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range map[string]string{"a.txt": "a", "sub/b.txt": "b"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := dag.Manifest(context.Background(), dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Kubo reports every entry below the uploaded directory, the root last.
+	base := filepath.Base(dir)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v0/add" {
+			http.NotFound(w, r)
+			return
+		}
+		io.Copy(io.Discard, r.Body)
+		enc := json.NewEncoder(w)
+		for _, e := range want.Entries {
+			enc.Encode(addEvent{Name: base + "/" + e.Path, Hash: e.Cid, Size: strconv.FormatUint(e.Size, 10)})
+		}
+		enc.Encode(addEvent{Name: base, Hash: want.Root})
+	}))
+	defer srv.Close()
+
+	client := NewClient(config.NewConfig("key", "secret"), &http.Client{Transport: redirect{srv}})
+	result, err := client.PinDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mr, ok := result.(pinners.ManifestResult)
+	if !ok || mr.Manifest() == nil {
+		t.Fatal("no manifest reported")
+	}
+	got := mr.Manifest()
+	if got.Root != want.Root {
+		t.Errorf("root %s, want %s", got.Root, want.Root)
+	}
+	if len(got.Entries) != len(want.Entries) {
+		t.Fatalf("entries %v, want %v", got.Entries, want.Entries)
+	}
+	for i, e := range got.Entries {
+		if e != want.Entries[i] {
+			t.Errorf("entry %v, want %v", e, want.Entries[i])
+		}
+	}
+}
@@ -6,3 +6,18 @@ type addEvent struct {
 	Bytes int64  `json:",omitempty"`
 	Size  string `json:",omitempty"`
 }
+
+type cidLink struct {
+	Value string `json:"/"`
+}
+
+type importEvent struct {
+	Root *struct {
+		Cid         cidLink
+		PinErrorMsg string `json:",omitempty"`
+	} `json:",omitempty"`
+}
+
+type putEvent struct {
+	Cid cidLink
+}
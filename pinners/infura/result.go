@@ -1,10 +1,14 @@
 package infura
 
-import "fmt"
+import (
+	"fmt"
+	"github.com/heilart1n/justpin-ipfs/pinners"
+)
 
 type Result struct {
-	hash string
-	link string
+	hash     string
+	link     string
+	manifest *pinners.Manifest
 }
 
 func (client *Client) NewResult(hash string) *Result {
@@ -18,3 +22,8 @@ func (result *Result) GetHash() string {
 func (result *Result) GetLink() string {
 	return result.link
 }
+
+// Manifest returns the entries reported by `/api/v0/add` while uploading.
+func (result *Result) Manifest() *pinners.Manifest {
+	return result.manifest
+}
@@ -0,0 +1,55 @@
+package pinners
+
+import (
+	"encoding/json"
+	"io"
+	"sort"
+)
+
+// ManifestEntry describes a file or directory inside a pinned tree. Size is
+// the cumulative DAG size, as reported by `ipfs add`.
+type ManifestEntry struct {
+	Path string `json:"path"`
+	Cid  string `json:"cid"`
+	Size uint64 `json:"size"`
+}
+
+// Manifest maps every relative path of a pinned tree to its CID.
+type Manifest struct {
+	Root    string          `json:"root"`
+	Entries []ManifestEntry `json:"entries"`
+}
+
+// ManifestResult is a Result that carries the Manifest captured while
+// uploading. Manifest returns nil if the provider reported the root only.
+type ManifestResult interface {
+	Result
+	Manifest() *Manifest
+}
+
+// Sort orders the entries by path.
+func (m *Manifest) Sort() {
+	sort.Slice(m.Entries, func(i, j int) bool { return m.Entries[i].Path < m.Entries[j].Path })
+}
+
+// Lookup returns the entry for the relative path p.
+func (m *Manifest) Lookup(p string) (ManifestEntry, bool) {
+	for _, e := range m.Entries {
+		if e.Path == p {
+			return e, true
+		}
+	}
+	return ManifestEntry{}, false
+}
+
+// JSON returns the indented JSON encoding of the manifest.
+func (m *Manifest) JSON() ([]byte, error) {
+	return json.MarshalIndent(m, "", "  ")
+}
+
+// WriteJSON writes the JSON encoding of the manifest to w.
+func (m *Manifest) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(m)
+}
@@ -2,15 +2,16 @@ package nftstorage
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"github.com/heilart1n/justpin-ipfs/dag"
 	"github.com/heilart1n/justpin-ipfs/file"
 	httpretry "github.com/heilart1n/justpin-ipfs/http"
 	"github.com/heilart1n/justpin-ipfs/pinners"
 	"io"
 	"net/http"
-	"os"
 )
 
 func (client *Client) Name() string {
@@ -20,29 +21,39 @@ func (client *Client) Name() string {
 // PinFile pins content to NFTStorage by providing a file path, it returns an IPFS
 // hash and an error.
 func (client *Client) PinFile(fp string) (pinners.Result, error) {
-	fi, err := os.Stat(fp)
+	f, err := file.NewSerialFile(fp, client.WalkOptions()...)
 	if err != nil {
 		return nil, err
 	}
+	return client.PinNode(f)
+}
 
+// PinNode pins a file or directory Node to NFTStorage, it returns an IPFS
+// hash and an error.
+func (client *Client) PinNode(f *file.Node) (pinners.Result, error) {
 	// For regular file
-	if fi.Mode().IsRegular() {
-		f, err := os.Open(fp)
+	if f.Mode().IsRegular() {
+		if err := form.Check(f); err != nil {
+			return nil, err
+		}
+		rd, err := f.Open(f.Name())
 		if err != nil {
 			return nil, err
 		}
-		defer f.Close()
+		defer rd.Close()
 
-		return client.pinFile(f, file.MediaType(f))
+		contentType, r, err := file.DetectContentType(rd, f.Name())
+		if err != nil {
+			return nil, err
+		}
+		if !f.Reopenable() {
+			return client.pinFile(r, contentType)
+		}
+		return client.pinFile(&nodeBody{Reader: r, node: f}, contentType)
 	}
 
 	// For directory, or etc
-	f, err := file.NewSerialFile(fp)
-	if err != nil {
-		return nil, err
-	}
-
-	mfr, err := file.CreateMultiForm(f, true)
+	mfr, err := file.NewMultiForm(f, form)
 	if err != nil {
 		return nil, err
 	}
@@ -51,27 +62,60 @@ func (client *Client) PinFile(fp string) (pinners.Result, error) {
 	return client.pinFile(mfr, boundary)
 }
 
+// PinURL pins the content of rawURL to NFTStorage, streamed from the response
+// into the upload. The file keeps its upstream name and Content-Type. A
+// maxSize of zero or less is no limit.
+func (client *Client) PinURL(rawURL string, maxSize int64) (pinners.Result, error) {
+	return pinners.PinURL(client, httpretry.NewClient(client.Client), rawURL, maxSize)
+}
+
+// nodeBody is the content of a single file Node as a request body, a retry
+// opens the file again rather than buffering it. It's only used for Nodes
+// that can be reopened, others are sent once as a stream.
+type nodeBody struct {
+	io.Reader
+	node *file.Node
+}
+
+func (b *nodeBody) GetBody() (io.ReadCloser, error) {
+	return b.node.Open(b.node.Name())
+}
+
 // PinWithReader pins content to NFTStorage by given io.Reader, it returns an IPFS hash and an error.
+// The Content-Type is detected from the content, use file.WithContentType to set it explicitly.
 func (client *Client) PinWithReader(rd io.Reader) (pinners.Result, error) {
-	return client.pinFile(rd, file.MediaType(rd))
+	contentType, rd, err := file.DetectContentType(rd, "")
+	if err != nil {
+		return nil, err
+	}
+	return client.pinFile(rd, contentType)
 }
 
 // PinWithBytes pins content to NFTStorage by given byte slice, it returns an IPFS hash and an error.
 func (client *Client) PinWithBytes(buf []byte) (pinners.Result, error) {
-	return client.pinFile(bytes.NewReader(buf), file.MediaType(buf))
+	return client.PinWithReader(bytes.NewReader(buf))
 }
 
+// PinCAR pins a CAR to NFTStorage, it returns the root CID and an error.
+// Partial DAGs are accepted, the missing blocks are fetched from the network.
+func (client *Client) PinCAR(rd io.Reader) (pinners.Result, error) {
+	return client.pinFile(rd, "application/car")
+}
+
+// form is the multipart layout of `/upload`: one "file" part per file,
+// named by its relative path.
+var form = file.Form{FileField: "file"}
+
 func (client *Client) pinFile(r io.Reader, boundary string) (pinners.Result, error) {
 	endpoint := APIUrl + "/upload"
 
-	req, err := http.NewRequest(http.MethodPost, endpoint, r)
+	req, err := httpretry.NewRequest(http.MethodPost, endpoint, r)
 	if err != nil {
 		return nil, err
 	}
 	req.Header.Add("Content-Type", boundary)
 	req.Header.Add("Authorization", "Bearer "+client.cfg.Apikey)
-	httpClient := httpretry.NewClient(client.Client)
-	resp, err := httpClient.Do(req)
+	resp, err := httpretry.Do(client.Client, req)
 	if err != nil {
 		return nil, err
 	}
@@ -104,28 +148,48 @@ func (client *Client) PinHash(hash string) (bool, error) {
 	return false, fmt.Errorf("not yet supported")
 }
 
+// Unpin stops storing hash on NFTStorage.
+func (client *Client) Unpin(hash string) error {
+	if hash == "" {
+		return fmt.Errorf("invalid hash: %s", hash)
+	}
+
+	req, err := http.NewRequest(http.MethodDelete, APIUrl+"/"+hash, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Add("Authorization", "Bearer "+client.cfg.Apikey)
+
+	resp, err := httpretry.Do(client.Client, req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf(resp.Status)
+	}
+	return nil
+}
+
 // PinDir pins a directory to the NFT.Storage pinning service.
 // It alias to PinFile.
 func (client *Client) PinDir(name string) (pinners.Result, error) {
 	return client.PinFile(name)
 }
 
-func (client *Client) Pin(path interface{}) (result pinners.Result, err error) {
-	err = fmt.Errorf("unsupported pinner")
-	switch v := path.(type) {
-	case string:
-		_, err = os.Lstat(v)
+// PinArchive expands a and pins it as a directory.
+func (client *Client) PinArchive(a *file.Archive) (pinners.Result, error) {
+	return dag.PinArchive(context.Background(), client, a)
+}
+
+func (client *Client) Pin(path interface{}) (pinners.Result, error) {
+	if nft, ok := path.(*NFT); ok {
+		result, err := client.Store(nft)
 		if err != nil {
-			return
+			return nil, fmt.Errorf("%s: %w", client.Name(), err)
 		}
-		result, err = client.PinFile(v)
-	case io.Reader:
-		result, err = client.PinWithReader(v)
-	case []byte:
-		result, err = client.PinWithBytes(v)
-	}
-	if err != nil {
-		err = fmt.Errorf("%s: %w", client.Name(), err)
+		return result, nil
 	}
-	return result, err
+	return pinners.Pin(client, path)
 }
@@ -0,0 +1,127 @@
+package nftstorage
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/heilart1n/justpin-ipfs/config"
+	"github.com/heilart1n/justpin-ipfs/file"
+)
+
+// redirect sends every request to the test server srv.
+type redirect struct {
+	srv *httptest.Server
+}
+
+func (rt redirect) RoundTrip(req *http.Request) (*http.Response, error) {
+	u, _ := url.Parse(rt.srv.URL)
+	req.URL.Scheme, req.URL.Host = u.Scheme, u.Host
+	return rt.srv.Client().Transport.RoundTrip(req)
+}
+
+func TestPinSingleFile(t *testing.T) {
+	content := strings.Repeat("<p>hello</p>", 1<<16)
+	fp := filepath.Join(t.TempDir(), "index.html")
+	if err := os.WriteFile(fp, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ContentLength != -1 {
+			t.Errorf("content length = %d, want a streamed body", r.ContentLength)
+		}
+		if ct := r.Header.Get("Content-Type"); !strings.HasPrefix(ct, "text/html") {
+			t.Errorf("content type = %q", ct)
+		}
+		body, _ := io.ReadAll(r.Body)
+		if string(body) != content {
+			t.Errorf("server read %d bytes, want %d", len(body), len(content))
+		}
+		io.WriteString(w, `{"ok":true,"value":{"cid":"bafkqaaa"}}`)
+	}))
+	defer srv.Close()
+
+	client := NewClient(config.NewConfig("key", ""), &http.Client{Transport: redirect{srv}})
+	result, err := client.PinFile(fp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.GetHash() != "bafkqaaa" {
+		t.Errorf("pinned %s", result.GetHash())
+	}
+}
+
+func TestNodeBodyGetBody(t *testing.T) {
+	fp := filepath.Join(t.TempDir(), "a.txt")
+	if err := os.WriteFile(fp, []byte("hello"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	node, err := file.NewSerialFile(fp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body := &nodeBody{Reader: strings.NewReader(""), node: node}
+	for i := 0; i < 2; i++ {
+		rc, err := body.GetBody()
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, _ := io.ReadAll(rc)
+		rc.Close()
+		if string(data) != "hello" {
+			t.Errorf("attempt %d read %q", i, data)
+		}
+	}
+}
+
+func TestPinURL(t *testing.T) {
+	content := strings.Repeat("remote ", 1<<14)
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		io.WriteString(w, content)
+	}))
+	defer origin.Close()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ContentLength != -1 {
+			t.Errorf("content length = %d, want a streamed body", r.ContentLength)
+		}
+		if ct := r.Header.Get("Content-Type"); !strings.HasPrefix(ct, "text/plain") {
+			t.Errorf("content type = %q", ct)
+		}
+		body, _ := io.ReadAll(r.Body)
+		if string(body) != content {
+			t.Errorf("server read %d bytes, want %d", len(body), len(content))
+		}
+		io.WriteString(w, `{"ok":true,"value":{"cid":"bafkqaaa"}}`)
+	}))
+	defer srv.Close()
+
+	// only the API requests are redirected, the origin is fetched as is
+	client := NewClient(config.NewConfig("key", ""), &http.Client{Transport: apiRedirect{srv}})
+	result, err := client.PinURL(origin.URL+"/file.txt", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.GetHash() != "bafkqaaa" {
+		t.Errorf("pinned %s", result.GetHash())
+	}
+}
+
+// apiRedirect sends the requests to the API to the test server srv.
+type apiRedirect struct {
+	srv *httptest.Server
+}
+
+func (rt apiRedirect) RoundTrip(req *http.Request) (*http.Response, error) {
+	if strings.HasPrefix(req.URL.String(), APIUrl) {
+		return redirect(rt).RoundTrip(req)
+	}
+	return http.DefaultTransport.RoundTrip(req)
+}
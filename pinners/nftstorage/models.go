@@ -16,3 +16,15 @@ type addEvent struct {
 	Value value
 	Error er
 }
+
+type storeValue struct {
+	IPNFT string `json:"ipnft"`
+	URL   string `json:"url"`
+	Data  map[string]interface{}
+}
+
+type storeEvent struct {
+	Ok    bool
+	Value storeValue
+	Error er
+}
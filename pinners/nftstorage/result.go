@@ -1,6 +1,10 @@
 package nftstorage
 
-import "fmt"
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
 
 type Result struct {
 	hash string
@@ -18,3 +22,54 @@ func (result *Result) GetLink() string {
 func newResult(hash string) *Result {
 	return &Result{hash: hash, link: fmt.Sprintf(IPFSUrl, hash)}
 }
+
+// StoreResult is the outcome of Store.
+type StoreResult struct {
+	// IPNFT is the CID of the directory holding metadata.json.
+	IPNFT string
+	// URL is the `ipfs://` URL of metadata.json.
+	URL string
+	// Data is the stored metadata, with `ipfs://` URLs in place of assets.
+	Data map[string]interface{}
+	// Assets are the `ipfs://` URLs of the assets by dotted path, such as
+	// "image" or "properties.video".
+	Assets map[string]string
+}
+
+func (result *StoreResult) GetHash() string {
+	return result.IPNFT
+}
+
+// GetLink returns the gateway URL of metadata.json.
+func (result *StoreResult) GetLink() string {
+	return fmt.Sprintf(IPFSUrl, result.IPNFT) + "metadata.json"
+}
+
+func newStoreResult(v storeValue, assets map[string]*Asset) *StoreResult {
+	result := &StoreResult{IPNFT: v.IPNFT, URL: v.URL, Data: v.Data, Assets: map[string]string{}}
+	for p := range assets {
+		if u, ok := lookup(v.Data, p).(string); ok {
+			result.Assets[p] = u
+		}
+	}
+	return result
+}
+
+// lookup returns the value at the dotted path p of data, or nil.
+func lookup(data interface{}, p string) interface{} {
+	for _, key := range strings.Split(p, ".") {
+		switch v := data.(type) {
+		case map[string]interface{}:
+			data = v[key]
+		case []interface{}:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(v) {
+				return nil
+			}
+			data = v[i]
+		default:
+			return nil
+		}
+	}
+	return data
+}
@@ -0,0 +1,255 @@
+package nftstorage
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"path"
+	"reflect"
+	"strconv"
+	"strings"
+
+	httpretry "github.com/heilart1n/justpin-ipfs/http"
+)
+
+// Asset is a file embedded in NFT metadata. Store uploads it next to the
+// metadata and replaces it with its `ipfs://` URL.
+type Asset struct {
+	// Name is the file name, required.
+	Name string
+	// ContentType is sent as is, it's guessed from the extension of Name
+	// when empty.
+	ContentType string
+	Reader      io.Reader
+}
+
+// NFT is ERC-1155 metadata, a superset of ERC-721 metadata, as taken by
+// `/store`. Values of Properties may be any JSON value, maps and slices of
+// them, or an *Asset at any depth.
+type NFT struct {
+	Name        string
+	Description string
+	// Image is required and must be an image/* file.
+	Image *Asset
+	// Decimals is the number of decimal places of the token amount.
+	Decimals     *int
+	Properties   map[string]interface{}
+	Localization *Localization
+}
+
+// Localization points to translations of the metadata, as in ERC-1155.
+type Localization struct {
+	// URI contains the `{locale}` placeholder.
+	URI     string
+	Default string
+	Locales []string
+}
+
+// Validate checks what `/store` requires of nft: a name, a description and
+// an image/* image. Decimals and Localization must be set as ERC-1155
+// describes them and Properties must only hold JSON values and assets with
+// valid names. Other ERC-721 and ERC-1155 schema rules aren't checked.
+func (nft *NFT) Validate() error {
+	var errs []error
+	if strings.TrimSpace(nft.Name) == "" {
+		errs = append(errs, fmt.Errorf("name is required"))
+	}
+	if strings.TrimSpace(nft.Description) == "" {
+		errs = append(errs, fmt.Errorf("description is required"))
+	}
+	if nft.Image == nil {
+		errs = append(errs, fmt.Errorf("image is required"))
+	} else {
+		if err := nft.Image.validate("image"); err != nil {
+			errs = append(errs, err)
+		} else if !strings.HasPrefix(nft.Image.contentType(), "image/") {
+			errs = append(errs, fmt.Errorf("image must have an image/* type, got %s", nft.Image.contentType()))
+		}
+	}
+	if nft.Decimals != nil && *nft.Decimals < 0 {
+		errs = append(errs, fmt.Errorf("decimals must not be negative"))
+	}
+	if l := nft.Localization; l != nil {
+		if !strings.Contains(l.URI, "{locale}") {
+			errs = append(errs, fmt.Errorf("localization uri must contain {locale}"))
+		}
+		if l.Default == "" {
+			errs = append(errs, fmt.Errorf("localization default is required"))
+		}
+		if len(l.Locales) == 0 {
+			errs = append(errs, fmt.Errorf("localization locales are required"))
+		}
+	}
+	if nft.Properties != nil {
+		errs = append(errs, validateValue("properties", nft.Properties)...)
+	}
+	return errors.Join(errs...)
+}
+
+// quoteEscaper escapes quoted strings of a Content-Disposition, as
+// mime/multipart does.
+var quoteEscaper = strings.NewReplacer("\\", "\\\\", `"`, "\\\"")
+
+func escapeQuotes(s string) string {
+	return quoteEscaper.Replace(s)
+}
+
+func (a *Asset) validate(p string) error {
+	if a.Name == "" || strings.ContainsAny(a.Name, "/\r\n") {
+		return fmt.Errorf("%s: invalid file name %q", p, a.Name)
+	}
+	if a.Reader == nil {
+		return fmt.Errorf("%s: missing reader", p)
+	}
+	return nil
+}
+
+func (a *Asset) contentType() string {
+	if a.ContentType != "" {
+		return a.ContentType
+	}
+	if ct := mime.TypeByExtension(path.Ext(a.Name)); ct != "" {
+		return ct
+	}
+	return "application/octet-stream"
+}
+
+// validateValue checks that v, found at the dotted path p, is made of JSON
+// values and assets only.
+func validateValue(p string, v interface{}) []error {
+	switch v := v.(type) {
+	case nil, string, bool, json.Number,
+		int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64:
+		return nil
+	case *Asset:
+		if err := v.validate(p); err != nil {
+			return []error{err}
+		}
+		return nil
+	case map[string]interface{}:
+		var errs []error
+		for k, e := range v {
+			if k == "" || strings.ContainsAny(k, ".\r\n") {
+				errs = append(errs, fmt.Errorf("%s: invalid key %q", p, k))
+				continue
+			}
+			errs = append(errs, validateValue(p+"."+k, e)...)
+		}
+		return errs
+	case []interface{}:
+		var errs []error
+		for i, e := range v {
+			errs = append(errs, validateValue(p+"."+strconv.Itoa(i), e)...)
+		}
+		return errs
+	}
+	return []error{fmt.Errorf("%s: unsupported value of type %s", p, reflect.TypeOf(v))}
+}
+
+// meta returns the metadata JSON object, with every asset left null and
+// listed by its dotted path, as `/store` expects them in the form.
+func (nft *NFT) meta() (map[string]interface{}, map[string]*Asset) {
+	assets := map[string]*Asset{"image": nft.Image}
+	meta := map[string]interface{}{
+		"name":        nft.Name,
+		"description": nft.Description,
+		"image":       nil,
+	}
+	if nft.Decimals != nil {
+		meta["decimals"] = *nft.Decimals
+	}
+	if l := nft.Localization; l != nil {
+		meta["localization"] = map[string]interface{}{"uri": l.URI, "default": l.Default, "locales": l.Locales}
+	}
+	if nft.Properties != nil {
+		meta["properties"] = stripAssets("properties", nft.Properties, assets)
+	}
+	return meta, assets
+}
+
+func stripAssets(p string, v interface{}, assets map[string]*Asset) interface{} {
+	switch v := v.(type) {
+	case *Asset:
+		assets[p] = v
+		return nil
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(v))
+		for k, e := range v {
+			out[k] = stripAssets(p+"."+k, e, assets)
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, e := range v {
+			out[i] = stripAssets(p+"."+strconv.Itoa(i), e, assets)
+		}
+		return out
+	}
+	return v
+}
+
+// Store validates nft, then uploads it to `/store`: the assets are pinned
+// and the metadata is pinned as `metadata.json` with `ipfs://` URLs to them.
+func (client *Client) Store(nft *NFT) (*StoreResult, error) {
+	if err := nft.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid nft metadata: %w", err)
+	}
+	meta, assets := nft.meta()
+	metaJSON, err := json.Marshal(meta)
+	if err != nil {
+		return nil, err
+	}
+
+	r, w := io.Pipe()
+	m := multipart.NewWriter(w)
+	go func() {
+		err := m.WriteField("meta", string(metaJSON))
+		for p, asset := range assets {
+			if err != nil {
+				break
+			}
+			header := textproto.MIMEHeader{}
+			header.Set("Content-Disposition", fmt.Sprintf(`form-data; name="%s"; filename="%s"`, escapeQuotes(p), escapeQuotes(asset.Name)))
+			header.Set("Content-Type", asset.contentType())
+			var part io.Writer
+			if part, err = m.CreatePart(header); err == nil {
+				_, err = io.Copy(part, asset.Reader)
+			}
+		}
+		if err == nil {
+			err = m.Close()
+		}
+		w.CloseWithError(err)
+	}()
+
+	req, err := httpretry.NewRequest(http.MethodPost, APIUrl+"/store", r)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Add("Content-Type", m.FormDataContentType())
+	req.Header.Add("Authorization", "Bearer "+client.cfg.Apikey)
+
+	resp, err := httpretry.Do(client.Client, req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var out storeEvent
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		if resp.StatusCode != http.StatusOK {
+			return nil, errors.New(resp.Status)
+		}
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK || !out.Ok {
+		return nil, fmt.Errorf("%s: %s", resp.Status, out.Error.Message)
+	}
+
+	return newStoreResult(out.Value, assets), nil
+}
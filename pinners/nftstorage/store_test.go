@@ -0,0 +1,214 @@
+package nftstorage
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/heilart1n/justpin-ipfs/config"
+)
+
+func TestStore(t *testing.T) {
+	files := map[string]string{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/store" {
+			http.NotFound(w, r)
+			return
+		}
+		if r.ContentLength != -1 {
+			t.Errorf("content length = %d, want a streamed body", r.ContentLength)
+		}
+		mr, err := r.MultipartReader()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		for {
+			part, err := mr.NextPart()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			data, _ := io.ReadAll(part)
+			files[part.FormName()+"|"+part.FileName()] = string(data)
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"ok": true,
+			"value": map[string]interface{}{
+				"ipnft": "bafyreia",
+				"url":   "ipfs://bafyreia/metadata.json",
+				"data":  map[string]interface{}{"image": "ipfs://bafybeib/cat.png"},
+			},
+		})
+	}))
+	defer srv.Close()
+
+	client := NewClient(config.NewConfig("key", ""), &http.Client{Transport: redirect{srv}})
+	result, err := client.Store(&NFT{
+		Name:        "cat",
+		Description: "a cat",
+		Image:       &Asset{Name: `my "cat" \ 1.png`, Reader: strings.NewReader("png")},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.IPNFT != "bafyreia" || result.Assets["image"] != "ipfs://bafybeib/cat.png" {
+		t.Errorf("result %+v", result)
+	}
+	if got := files[`image|my "cat" \ 1.png`]; got != "png" {
+		t.Errorf("parts %v, want the image with its name", files)
+	}
+	if !strings.Contains(files["meta|"], `"name":"cat"`) {
+		t.Errorf("meta part %q", files["meta|"])
+	}
+}
+
+func TestStoreInvalidName(t *testing.T) {
+	client := NewClient(config.NewConfig("key", ""), nil)
+	_, err := client.Store(&NFT{
+		Name:        "cat",
+		Description: "a cat",
+		Image:       &Asset{Name: "cat.png\r\nX-Injected: 1", Reader: strings.NewReader("png")},
+	})
+	if err == nil {
+		t.Error("name with a line break accepted")
+	}
+}
+
+func TestStoreNestedAssets(t *testing.T) {
+	var meta map[string]interface{}
+	files := map[string]string{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mr, err := r.MultipartReader()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		for {
+			part, err := mr.NextPart()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			data, _ := io.ReadAll(part)
+			if part.FormName() == "meta" {
+				json.Unmarshal(data, &meta)
+				continue
+			}
+			files[part.FormName()] = part.FileName() + ":" + string(data)
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"ok": true,
+			"value": map[string]interface{}{
+				"ipnft": "bafyreia",
+				"url":   "ipfs://bafyreia/metadata.json",
+				"data": map[string]interface{}{
+					"image": "ipfs://bafybeib/cat.png",
+					"properties": map[string]interface{}{
+						"files": []interface{}{"ipfs://bafybeic/a.txt"},
+						"more":  map[string]interface{}{"video": "ipfs://bafybeid/cat.mp4"},
+					},
+				},
+			},
+		})
+	}))
+	defer srv.Close()
+
+	client := NewClient(config.NewConfig("key", ""), &http.Client{Transport: redirect{srv}})
+	result, err := client.Store(&NFT{
+		Name:        "cat",
+		Description: "a cat",
+		Image:       &Asset{Name: "cat.png", Reader: strings.NewReader("png")},
+		Properties: map[string]interface{}{
+			"files": []interface{}{&Asset{Name: "a.txt", Reader: strings.NewReader("a")}},
+			"more": map[string]interface{}{
+				"video": &Asset{Name: "cat.mp4", Reader: strings.NewReader("mp4")},
+				"legs":  4,
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]string{"image": "cat.png:png", "properties.files.0": "a.txt:a", "properties.more.video": "cat.mp4:mp4"}
+	for name, content := range want {
+		if files[name] != content {
+			t.Errorf("part %s = %q, want %q", name, files[name], content)
+		}
+	}
+	if len(files) != len(want) {
+		t.Errorf("parts %v, want %v", files, want)
+	}
+	props, _ := meta["properties"].(map[string]interface{})
+	more, _ := props["more"].(map[string]interface{})
+	if fs, _ := props["files"].([]interface{}); len(fs) != 1 || fs[0] != nil || more["video"] != nil || more["legs"] != 4.0 {
+		t.Errorf("meta properties %v, want assets left null", props)
+	}
+	if result.Assets["properties.files.0"] != "ipfs://bafybeic/a.txt" || result.Assets["properties.more.video"] != "ipfs://bafybeid/cat.mp4" {
+		t.Errorf("assets %v", result.Assets)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	valid := func() *NFT {
+		return &NFT{
+			Name:        "cat",
+			Description: "a cat",
+			Image:       &Asset{Name: "cat.png", Reader: strings.NewReader("png")},
+		}
+	}
+	decimals := -1
+	for _, tc := range []struct {
+		name   string
+		modify func(*NFT)
+		err    string
+	}{
+		{"name", func(nft *NFT) { nft.Name = " " }, "name is required"},
+		{"description", func(nft *NFT) { nft.Description = "" }, "description is required"},
+		{"image", func(nft *NFT) { nft.Image = nil }, "image is required"},
+		{"image name", func(nft *NFT) { nft.Image.Name = "a/cat.png" }, `image: invalid file name "a/cat.png"`},
+		{"image reader", func(nft *NFT) { nft.Image.Reader = nil }, "image: missing reader"},
+		{"image type", func(nft *NFT) { nft.Image.ContentType = "text/plain" }, "image must have an image/* type, got text/plain"},
+		{"decimals", func(nft *NFT) { nft.Decimals = &decimals }, "decimals must not be negative"},
+		{"localization uri", func(nft *NFT) {
+			nft.Localization = &Localization{URI: "ipfs://a/en.json", Default: "en", Locales: []string{"en"}}
+		}, "localization uri must contain {locale}"},
+		{"localization default", func(nft *NFT) {
+			nft.Localization = &Localization{URI: "ipfs://a/{locale}.json", Locales: []string{"en"}}
+		}, "localization default is required"},
+		{"localization locales", func(nft *NFT) {
+			nft.Localization = &Localization{URI: "ipfs://a/{locale}.json", Default: "en"}
+		}, "localization locales are required"},
+		{"property key", func(nft *NFT) {
+			nft.Properties = map[string]interface{}{"a": map[string]interface{}{"b.c": 1}}
+		}, `properties.a: invalid key "b.c"`},
+		{"property value", func(nft *NFT) {
+			nft.Properties = map[string]interface{}{"a": []interface{}{struct{}{}}}
+		}, "properties.a.0: unsupported value of type struct {}"},
+		{"property asset", func(nft *NFT) {
+			nft.Properties = map[string]interface{}{"a": []interface{}{"x", &Asset{Name: "a.txt"}}}
+		}, "properties.a.1: missing reader"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			nft := valid()
+			if err := nft.Validate(); err != nil {
+				t.Fatalf("valid nft: %v", err)
+			}
+			tc.modify(nft)
+			err := nft.Validate()
+			if err == nil || err.Error() != tc.err {
+				t.Errorf("Validate() = %v, want %s", err, tc.err)
+			}
+		})
+	}
+}
@@ -0,0 +1,109 @@
+package pinners
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+
+	"github.com/heilart1n/justpin-ipfs/file"
+)
+
+// ArchivePinner is a Pinner that can pin the content of a file.Archive as a
+// directory.
+type ArchivePinner interface {
+	Pinner
+	PinArchive(a *file.Archive) (Result, error)
+}
+
+// Pin pins v with p, it backs the Pin method of the pinners:
+//
+//   - a string is a path on disk, pinned with PinFile
+//   - a fs.FS and a map[string]io.Reader are pinned as a directory Node,
+//     the fs.FS walked with the pinner's walk options
+//   - a *url.URL is pinned with PinURL, up to DefaultURLMaxSize
+//   - a *file.Archive is pinned with PinArchive
+//   - an io.Reader and a []byte are pinned as a single file
+//
+// Any other type, or one the pinner doesn't support, is an error. Errors
+// are prefixed with the pinner's name.
+func Pin(p Pinner, v interface{}) (Result, error) {
+	result, err := pin(p, v)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", p.Name(), err)
+	}
+	return result, nil
+}
+
+// DefaultURLMaxSize is the most Pin reads from a *url.URL.
+var DefaultURLMaxSize int64 = 1 << 30
+
+func pin(p Pinner, v interface{}) (Result, error) {
+	switch v := v.(type) {
+	case string:
+		if _, err := os.Lstat(v); err != nil {
+			return nil, err
+		}
+		return p.PinFile(v)
+	case fs.FS:
+		var opts []file.Option
+		if wc, ok := p.(WalkConfigurer); ok {
+			opts = wc.WalkOptions()
+		}
+		node, err := file.NewFSFile(v, ".", opts...)
+		if err != nil {
+			return nil, err
+		}
+		return pinNode(p, node)
+	case map[string]io.Reader:
+		node, err := file.NewReaderDir(v)
+		if err != nil {
+			return nil, err
+		}
+		return pinNode(p, node)
+	case *url.URL:
+		up, ok := p.(URLPinner)
+		if !ok {
+			return nil, fmt.Errorf("pinning URLs is not supported")
+		}
+		return up.PinURL(v.String(), DefaultURLMaxSize)
+	case *file.Archive:
+		ap, ok := p.(ArchivePinner)
+		if !ok {
+			return nil, fmt.Errorf("pinning archives is not supported")
+		}
+		return ap.PinArchive(v)
+	case io.Reader:
+		return p.PinWithReader(v)
+	case []byte:
+		return p.PinWithBytes(v)
+	}
+	return nil, fmt.Errorf("unsupported pinner")
+}
+
+func pinNode(p Pinner, node *file.Node) (Result, error) {
+	np, ok := p.(NodePinner)
+	if !ok {
+		return nil, fmt.Errorf("pinning a file.Node is not supported")
+	}
+	return np.PinNode(node)
+}
+
+// PinURL fetches rawURL with httpClient and pins the response with p as a
+// single file, streamed into the upload. The file keeps its upstream name
+// and Content-Type. A maxSize of zero or less is no limit.
+func PinURL(p NodePinner, httpClient *http.Client, rawURL string, maxSize int64) (Result, error) {
+	rf, err := file.Fetch(httpClient, rawURL, maxSize)
+	if err != nil {
+		return nil, err
+	}
+	defer rf.Close()
+
+	node, err := rf.Node()
+	if err != nil {
+		return nil, err
+	}
+	return p.PinNode(node)
+}
@@ -0,0 +1,83 @@
+package pinners
+
+import (
+	"io"
+	"net/url"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/heilart1n/justpin-ipfs/file"
+)
+
+type result string
+
+func (r result) GetHash() string { return string(r) }
+func (r result) GetLink() string { return "" }
+
+// fakePinner records the method each Pin call ends up in.
+type fakePinner struct {
+	file.WalkConfig
+	called  string
+	maxSize int64
+}
+
+func (p *fakePinner) Name() string { return "fake" }
+func (p *fakePinner) PinFile(fp string) (Result, error) {
+	p.called = "PinFile"
+	return result(fp), nil
+}
+func (p *fakePinner) PinWithReader(rd io.Reader) (Result, error) {
+	p.called = "PinWithReader"
+	return result(""), nil
+}
+func (p *fakePinner) PinWithBytes(buf []byte) (Result, error) {
+	p.called = "PinWithBytes"
+	return result(""), nil
+}
+func (p *fakePinner) PinHash(hash string) (bool, error)  { return true, nil }
+func (p *fakePinner) PinDir(name string) (Result, error) { return p.PinFile(name) }
+func (p *fakePinner) Pin(v interface{}) (Result, error)  { return Pin(p, v) }
+func (p *fakePinner) PinNode(node *file.Node) (Result, error) {
+	p.called = "PinNode"
+	return result(""), nil
+}
+func (p *fakePinner) PinURL(rawURL string, maxSize int64) (Result, error) {
+	p.called, p.maxSize = "PinURL", maxSize
+	return result(rawURL), nil
+}
+
+func TestPin(t *testing.T) {
+	u, _ := url.Parse("https://example.com/a.png")
+	tests := []struct {
+		v    interface{}
+		want string
+	}{
+		{t.TempDir(), "PinFile"},
+		{fstest.MapFS{"a.txt": {Data: []byte("a")}}, "PinNode"},
+		{map[string]io.Reader{"a.txt": strings.NewReader("a")}, "PinNode"},
+		{u, "PinURL"},
+		{strings.NewReader("a"), "PinWithReader"},
+		{[]byte("a"), "PinWithBytes"},
+	}
+	for _, tt := range tests {
+		p := new(fakePinner)
+		if _, err := p.Pin(tt.v); err != nil {
+			t.Fatalf("Pin(%T): %v", tt.v, err)
+		}
+		if p.called != tt.want {
+			t.Errorf("Pin(%T) called %s, want %s", tt.v, p.called, tt.want)
+		}
+	}
+
+	p := new(fakePinner)
+	if p.Pin(u); p.maxSize != DefaultURLMaxSize {
+		t.Errorf("PinURL max size %d, want %d", p.maxSize, DefaultURLMaxSize)
+	}
+	if _, err := p.Pin(file.NewArchive(strings.NewReader(""))); err == nil || !strings.HasPrefix(err.Error(), "fake: ") {
+		t.Errorf("archive without PinArchive = %v", err)
+	}
+	if _, err := p.Pin(42); err == nil {
+		t.Error("unsupported type didn't fail")
+	}
+}
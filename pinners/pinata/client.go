@@ -2,12 +2,14 @@ package pinata
 
 import (
 	"github.com/heilart1n/justpin-ipfs/config"
+	"github.com/heilart1n/justpin-ipfs/file"
 	"net/http"
 )
 
 const (
 	PinFileUrl = "https://api.pinata.cloud/pinning/pinFileToIPFS"
 	PinHashUrl = "https://api.pinata.cloud/pinning/pinByHash"
+	UnpinUrl   = "https://api.pinata.cloud/pinning/unpin/%s"
 	ClientName = "Pinata"
 	IPFSUrl    = "https://gateway.pinata.cloud/ipfs/%s"
 )
@@ -17,6 +19,7 @@ type Client struct {
 	*http.Client
 	cfg        config.Config
 	clientName string
+	file.WalkConfig
 }
 
 func NewClient(cfg config.Config, httpClient *http.Client) *Client {
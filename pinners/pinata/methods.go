@@ -2,18 +2,17 @@ package pinata
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"github.com/heilart1n/justpin-ipfs/dag"
 	"github.com/heilart1n/justpin-ipfs/file"
 	httpretry "github.com/heilart1n/justpin-ipfs/http"
 	"github.com/heilart1n/justpin-ipfs/pinners"
 	"io"
 	"io/ioutil"
-	"mime/multipart"
 	"net/http"
-	"os"
-	"path/filepath"
 )
 
 func (client *Client) Name() string {
@@ -23,13 +22,23 @@ func (client *Client) Name() string {
 // PinFile pins content to Pinata by providing a file path, it returns an IPFS
 // hash and an error.
 func (client *Client) PinFile(fp string) (pinners.Result, error) {
-	f, err := file.NewSerialFile(fp)
+	f, err := file.NewSerialFile(fp, client.WalkOptions()...)
 	if err != nil {
 		return nil, err
 	}
-	f.MapDirectory(filepath.Base(fp))
+	return client.PinNode(f)
+}
+
+// PinNode pins a file or directory Node to Pinata, it returns an IPFS hash
+// and an error.
+func (client *Client) PinNode(f *file.Node) (pinners.Result, error) {
+	name := f.Name()
+	if name == "" {
+		name = file.RandString(6, "lower")
+	}
+	f.MapDirectory(name)
 
-	mfr, err := file.CreateMultiForm(f, true)
+	mfr, err := file.NewMultiForm(f, form(name))
 	if err != nil {
 		return nil, err
 	}
@@ -38,78 +47,46 @@ func (client *Client) PinFile(fp string) (pinners.Result, error) {
 	return client.pinFile(mfr, boundary)
 }
 
+// PinURL pins the content of rawURL to Pinata, streamed from the response
+// into the upload. The file keeps its upstream name and Content-Type. A
+// maxSize of zero or less is no limit.
+func (client *Client) PinURL(rawURL string, maxSize int64) (pinners.Result, error) {
+	return pinners.PinURL(client, httpretry.NewClient(client.Client), rawURL, maxSize)
+}
+
 // PinWithReader pins content to Pinata by given io.Reader, it returns an IPFS hash and an error.
 func (client *Client) PinWithReader(rd io.Reader) (pinners.Result, error) {
-	r, w := io.Pipe()
-	m := multipart.NewWriter(w)
-	fn := file.RandString(6, "lower")
-
-	go func() {
-		defer w.Close()
-		defer m.Close()
-
-		part, err := m.CreateFormFile("file", fn)
-		if err != nil {
-			return
-		}
-
-		if _, err = io.Copy(part, rd); err != nil {
-			return
-		}
-	}()
-
-	return client.pinFile(r, m.FormDataContentType())
+	body, contentType := httpretry.NewMultipartBody("file", file.RandString(6, "lower"), rd)
+	return client.pinFile(body, contentType)
 }
 
 // PinWithBytes pins content to Infura by given byte slice, it returns an IPFS hash and an error.
 func (client *Client) PinWithBytes(buf []byte) (pinners.Result, error) {
-	r, w := io.Pipe()
-	m := multipart.NewWriter(w)
-	fn := file.RandString(6, "lower")
-
-	go func() {
-		defer w.Close()
-		defer m.Close()
-
-		// m.WriteField("pinataOptions", `{cidVersion: 1}`)
-		part, err := m.CreateFormFile("file", fn)
-		if err != nil {
-			return
-		}
-
-		if _, err = part.Write(buf); err != nil {
-			return
-		}
-	}()
+	return client.PinWithReader(bytes.NewReader(buf))
+}
 
-	return client.pinFile(r, m.FormDataContentType())
+// form returns the multipart layout of `pinFileToIPFS`: the metadata and
+// options fields, then every file under the pinned directory name.
+func form(name string) file.Form {
+	metadata, _ := json.Marshal(map[string]string{"name": name})
+	return file.Form{
+		Fields: []file.FormField{
+			{Name: "pinataMetadata", Value: string(metadata)},
+			{Name: "pinataOptions", Value: `{"cidVersion":1,"wrapWithDirectory":false}`},
+		},
+		FileField: "file",
+	}
 }
 
 func (client *Client) pinFile(r io.Reader, boundary string) (pinners.Result, error) {
-	// if fr, ok := r.(*file.MultiFileReader); ok {
-	// 	// Metadata part.
-	// 	metadataHeader := textproto.MIMEHeader{}
-	// 	metadataHeader.Set("Content-Disposition", `form-data; name="pinataMetadata"`)
-	// 	// Metadata content.
-	// 	metadata := fmt.Sprintf(`{"name":"%s"}`, "adsasdfa")
-	// 	fr.Write(metadataHeader, []byte(metadata))
-
-	// 	// options part.
-	// 	optsHeader := textproto.MIMEHeader{}
-	// 	optsHeader.Set("Content-Disposition", `form-data; name="pinataOptions"`)
-	// 	// options content.
-	// 	opts := `{"cidVersion":"1","wrapWithDirectory":false}`
-	// 	fr.Write(optsHeader, []byte(opts))
-	// }
-	req, err := http.NewRequest(http.MethodPost, PinFileUrl, r)
+	req, err := httpretry.NewRequest(http.MethodPost, PinFileUrl, r)
 	if err != nil {
 		return nil, err
 	}
 	client.setAuth(req)
 	req.Header.Add("Content-Type", boundary)
 
-	httpClient := httpretry.NewClient(client.Client)
-	resp, err := httpClient.Do(req)
+	resp, err := httpretry.Do(client.Client, req)
 	if err != nil {
 		return nil, err
 	}
@@ -152,8 +129,7 @@ func (client *Client) PinHash(hash string) (bool, error) {
 
 	req.Header.Set("Content-Type", "application/json")
 
-	httpClient := httpretry.NewClient(client.Client)
-	resp, err := httpClient.Do(req)
+	resp, err := httpretry.Do(client.Client, req)
 	if err != nil {
 		return false, err
 	}
@@ -184,6 +160,30 @@ func (client *Client) PinHash(hash string) (bool, error) {
 	return false, fmt.Errorf("pin hash to Pinata failed")
 }
 
+// Unpin removes the pin of hash from Pinata.
+func (client *Client) Unpin(hash string) error {
+	if hash == "" {
+		return fmt.Errorf("invalid hash: %s", hash)
+	}
+
+	req, err := http.NewRequest(http.MethodDelete, fmt.Sprintf(UnpinUrl, hash), nil)
+	if err != nil {
+		return err
+	}
+	client.setAuth(req)
+
+	resp, err := httpretry.Do(client.Client, req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf(resp.Status)
+	}
+	return nil
+}
+
 // PinDir pins a directory to the Pinata pinning service.
 // It alias to PinFile.
 func (client *Client) PinDir(name string) (pinners.Result, error) {
@@ -199,22 +199,11 @@ func (client *Client) setAuth(req *http.Request) {
 	}
 }
 
-func (client *Client) Pin(path interface{}) (result pinners.Result, err error) {
-	err = fmt.Errorf("unsupported pinner")
-	switch v := path.(type) {
-	case string:
-		_, err = os.Lstat(v)
-		if err != nil {
-			return
-		}
-		result, err = client.PinFile(v)
-	case io.Reader:
-		result, err = client.PinWithReader(v)
-	case []byte:
-		result, err = client.PinWithBytes(v)
-	}
-	if err != nil {
-		err = fmt.Errorf("%s: %w", client.Name(), err)
-	}
-	return result, err
+// PinArchive expands a and pins it as a directory.
+func (client *Client) PinArchive(a *file.Archive) (pinners.Result, error) {
+	return dag.PinArchive(context.Background(), client, a)
+}
+
+func (client *Client) Pin(path interface{}) (pinners.Result, error) {
+	return pinners.Pin(client, path)
 }
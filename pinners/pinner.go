@@ -1,6 +1,9 @@
 package pinners
 
-import "io"
+import (
+	"github.com/heilart1n/justpin-ipfs/file"
+	"io"
+)
 
 type Pinner interface {
 	Name() string
@@ -12,6 +15,55 @@ type Pinner interface {
 	Pin(path interface{}) (Result, error)
 }
 
+// CARPinner is a Pinner that accepts content-addressed archives (CARv1).
+type CARPinner interface {
+	Pinner
+	PinCAR(rd io.Reader) (Result, error)
+}
+
+// BlockPinner is a Pinner that can store and pin a single raw block, the
+// codec is named as in Kubo, e.g. "dag-pb" or "raw".
+type BlockPinner interface {
+	Pinner
+	PinBlock(codec string, buf []byte) (Result, error)
+}
+
+// Unpinner is a Pinner that can remove a pin by its hash.
+type Unpinner interface {
+	Pinner
+	Unpin(hash string) error
+}
+
+// NodePinner is a Pinner that can pin a file.Node, e.g. one read from a
+// fs.FS with file.NewFSFile. The Node is pinned as walked, the pinner's walk
+// options don't apply.
+type NodePinner interface {
+	Pinner
+	PinNode(node *file.Node) (Result, error)
+}
+
+// URLPinner is a Pinner that can pin the content of a URL, streamed from
+// the response into the upload.
+type URLPinner interface {
+	Pinner
+	PinURL(rawURL string, maxSize int64) (Result, error)
+}
+
+// OfflinePinner is a Pinner that must not cause any network request, such
+// as a dry run. Helpers that read existing content from a gateway refuse it
+// unless given a Fetcher of their own.
+type OfflinePinner interface {
+	Pinner
+	Offline() bool
+}
+
+// WalkConfigurer is a Pinner whose PinFile and PinDir walk directories with
+// file options, such as ignore rules.
+type WalkConfigurer interface {
+	SetWalkOptions(opts ...file.Option)
+	WalkOptions() []file.Option
+}
+
 type Result interface {
 	GetHash() string
 	GetLink() string
@@ -1,17 +1,18 @@
 package web3storage
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"github.com/heilart1n/justpin-ipfs/dag"
 	"github.com/heilart1n/justpin-ipfs/file"
 	httpretry "github.com/heilart1n/justpin-ipfs/http"
 	"github.com/heilart1n/justpin-ipfs/pinners"
 	"io"
 	"io/ioutil"
-	"mime/multipart"
 	"net/http"
-	"os"
 )
 
 func (client *Client) Name() string {
@@ -21,13 +22,19 @@ func (client *Client) Name() string {
 // PinFile pins content to Web3Storage by providing a file path, it returns an IPFS
 // hash and an error.
 func (client *Client) PinFile(fp string) (pinners.Result, error) {
-	f, err := file.NewSerialFile(fp)
+	f, err := file.NewSerialFile(fp, client.WalkOptions()...)
 	if err != nil {
 		return nil, err
 	}
+	return client.PinNode(f)
+}
+
+// PinNode pins a file or directory Node to Web3Storage, it returns an IPFS
+// hash and an error.
+func (client *Client) PinNode(f *file.Node) (pinners.Result, error) {
 	f.MapDirectory(file.RandString(32, "lower"))
 
-	mfr, err := file.CreateMultiForm(f, true)
+	mfr, err := file.NewMultiForm(f, form)
 	if err != nil {
 		return nil, err
 	}
@@ -36,64 +43,46 @@ func (client *Client) PinFile(fp string) (pinners.Result, error) {
 	return client.pinFile(mfr, boundary)
 }
 
+// PinURL pins the content of rawURL to Web3Storage, streamed from the response
+// into the upload. The file keeps its upstream name and Content-Type. A
+// maxSize of zero or less is no limit.
+func (client *Client) PinURL(rawURL string, maxSize int64) (pinners.Result, error) {
+	return pinners.PinURL(client, httpretry.NewClient(client.Client), rawURL, maxSize)
+}
+
 // PinWithReader pins content to Web3Storage by given io.Reader, it returns an IPFS hash and an error.
 func (client *Client) PinWithReader(rd io.Reader) (pinners.Result, error) {
-	r, w := io.Pipe()
-	m := multipart.NewWriter(w)
-	fn := file.RandString(6, "lower")
-
-	go func() {
-		defer w.Close()
-		defer m.Close()
-
-		part, err := m.CreateFormFile("file", fn)
-		if err != nil {
-			return
-		}
-
-		if _, err = io.Copy(part, rd); err != nil {
-			return
-		}
-	}()
-
-	return client.pinFile(r, m.FormDataContentType())
+	body, contentType := httpretry.NewMultipartBody("file", file.RandString(6, "lower"), rd)
+	return client.pinFile(body, contentType)
 }
 
 // PinWithBytes pins content to Web3Storage by given byte slice, it returns an IPFS hash and an error.
 func (client *Client) PinWithBytes(buf []byte) (pinners.Result, error) {
-	r, w := io.Pipe()
-	m := multipart.NewWriter(w)
-	fn := file.RandString(6, "lower")
-
-	go func() {
-		defer w.Close()
-		defer m.Close()
-
-		part, err := m.CreateFormFile("file", fn)
-		if err != nil {
-			return
-		}
-
-		if _, err = part.Write(buf); err != nil {
-			return
-		}
-	}()
+	return client.PinWithReader(bytes.NewReader(buf))
+}
 
-	return client.pinFile(r, m.FormDataContentType())
+// PinCAR pins a CAR to Web3Storage, it returns the root CID and an error.
+func (client *Client) PinCAR(rd io.Reader) (pinners.Result, error) {
+	return client.upload(APIUrl+"/car", rd, "application/car")
 }
 
+// form is the multipart layout of `/upload`: one "file" part per file,
+// named by its relative path.
+var form = file.Form{FileField: "file"}
+
 func (client *Client) pinFile(r io.Reader, boundary string) (pinners.Result, error) {
-	endpoint := APIUrl + "/upload"
+	return client.upload(APIUrl+"/upload", r, boundary)
+}
 
-	req, err := http.NewRequest(http.MethodPost, endpoint, r)
+func (client *Client) upload(endpoint string, r io.Reader, boundary string) (pinners.Result, error) {
+	req, err := httpretry.NewRequest(http.MethodPost, endpoint, r)
 	if err != nil {
 		return nil, err
 	}
 	client.setAuth(req)
 
 	req.Header.Add("Content-Type", boundary)
-	httpClient := httpretry.NewClient(client.Client)
-	resp, err := httpClient.Do(req)
+	resp, err := httpretry.Do(client.Client, req)
 	if err != nil {
 		return nil, err
 	}
@@ -136,22 +125,11 @@ func (client *Client) setAuth(req *http.Request) {
 	req.Header.Add("Authorization", "Bearer "+client.cfg.Apikey)
 }
 
-func (client *Client) Pin(path interface{}) (result pinners.Result, err error) {
-	err = fmt.Errorf("unsupported pinner")
-	switch v := path.(type) {
-	case string:
-		_, err = os.Lstat(v)
-		if err != nil {
-			return
-		}
-		result, err = client.PinFile(v)
-	case io.Reader:
-		result, err = client.PinWithReader(v)
-	case []byte:
-		result, err = client.PinWithBytes(v)
-	}
-	if err != nil {
-		err = fmt.Errorf("%s: %w", client.Name(), err)
-	}
-	return result, err
+// PinArchive expands a and pins it as a directory.
+func (client *Client) PinArchive(a *file.Archive) (pinners.Result, error) {
+	return dag.PinArchive(context.Background(), client, a)
+}
+
+func (client *Client) Pin(path interface{}) (pinners.Result, error) {
+	return pinners.Pin(client, path)
 }
@@ -0,0 +1,160 @@
+package psa
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/heilart1n/justpin-ipfs/file"
+)
+
+// Status is the state of a pin request.
+type Status string
+
+const (
+	StatusQueued  Status = "queued"
+	StatusPinning Status = "pinning"
+	StatusPinned  Status = "pinned"
+	StatusFailed  Status = "failed"
+)
+
+// Pin is a CID to pin, as requested by a client.
+type Pin struct {
+	Cid  string `json:"cid"`
+	Name string `json:"name,omitempty"`
+	// Origins are multiaddrs of peers holding the content. They are kept
+	// with the pin only, the pinners aren't told about them.
+	Origins []string          `json:"origins,omitempty"`
+	Meta    map[string]string `json:"meta,omitempty"`
+}
+
+// PinStatus is a pin request and its progress. Info holds the outcome per
+// pinner name, "pinned" or the error.
+type PinStatus struct {
+	RequestID string            `json:"requestid"`
+	Status    Status            `json:"status"`
+	Created   time.Time         `json:"created"`
+	Pin       Pin               `json:"pin"`
+	Delegates []string          `json:"delegates"`
+	Info      map[string]string `json:"info,omitempty"`
+
+	// replaces is the CID of the pin this one replaced, unpinned once this
+	// one is pinned.
+	replaces string
+}
+
+// record is a PinStatus as saved in the state file.
+type record struct {
+	PinStatus
+	Replaces string `json:"replaces,omitempty"`
+}
+
+func loadState(fp string) (map[string]*PinStatus, error) {
+	pins := map[string]*PinStatus{}
+	if fp == "" {
+		return pins, nil
+	}
+	data, err := os.ReadFile(fp)
+	if errors.Is(err, os.ErrNotExist) {
+		return pins, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var records []record
+	if err := json.Unmarshal(data, &records); err != nil {
+		return nil, fmt.Errorf("read state %s failed: %v", fp, err)
+	}
+	for _, r := range records {
+		ps := r.PinStatus
+		ps.replaces = r.Replaces
+		pins[ps.RequestID] = &ps
+	}
+	return pins, nil
+}
+
+// save writes the pins to the state file, the caller holds the lock.
+func (s *Server) save() error {
+	if s.statePath == "" {
+		return nil
+	}
+	records := make([]record, 0, len(s.pins))
+	for _, ps := range s.pins {
+		records = append(records, record{PinStatus: *ps, Replaces: ps.replaces})
+	}
+	data, err := json.Marshal(records)
+	if err != nil {
+		return err
+	}
+	return file.WriteFileAtomic(s.statePath, data)
+}
+
+// filter selects pins in a listing, as given by the query of `GET /pins`.
+type filter struct {
+	cids          map[string]bool
+	name          string
+	match         string
+	status        map[Status]bool
+	before, after time.Time
+	meta          map[string]string
+}
+
+func (f *filter) matches(ps *PinStatus) bool {
+	if len(f.cids) > 0 && !f.cids[ps.Pin.Cid] {
+		return false
+	}
+	if !f.status[ps.Status] {
+		return false
+	}
+	if !f.before.IsZero() && !ps.Created.Before(f.before) {
+		return false
+	}
+	if !f.after.IsZero() && !ps.Created.After(f.after) {
+		return false
+	}
+	for k, v := range f.meta {
+		if ps.Pin.Meta[k] != v {
+			return false
+		}
+	}
+	if f.name == "" {
+		return true
+	}
+	switch f.match {
+	case "iexact":
+		return strings.EqualFold(ps.Pin.Name, f.name)
+	case "partial":
+		return strings.Contains(ps.Pin.Name, f.name)
+	case "ipartial":
+		return strings.Contains(strings.ToLower(ps.Pin.Name), strings.ToLower(f.name))
+	}
+	return ps.Pin.Name == f.name
+}
+
+// list returns the count of pins matching f and the limit most recent ones.
+func (s *Server) list(f *filter, limit int) (int, []PinStatus) {
+	s.mu.Lock()
+	var results []PinStatus
+	for _, ps := range s.pins {
+		if f.matches(ps) {
+			results = append(results, *ps)
+		}
+	}
+	s.mu.Unlock()
+
+	sort.Slice(results, func(i, j int) bool {
+		if !results[i].Created.Equal(results[j].Created) {
+			return results[i].Created.After(results[j].Created)
+		}
+		return results[i].RequestID < results[j].RequestID
+	})
+	count := len(results)
+	if len(results) > limit {
+		results = results[:limit]
+	}
+	return count, results
+}
@@ -0,0 +1,406 @@
+// Package psa serves the IPFS Pinning Service API in front of pinners, so
+// `ipfs pin remote` and other clients of the API can pin to several
+// providers as a single remote service.
+package psa
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/heilart1n/justpin-ipfs/dag"
+	"github.com/heilart1n/justpin-ipfs/pinners"
+	"github.com/ipfs/go-cid"
+)
+
+const (
+	// DefaultWorkers is how many pin requests are processed at once by
+	// default.
+	DefaultWorkers = 4
+
+	defaultLimit = 10
+	maxLimit     = 1000
+	maxCids      = 10
+	maxNameLen   = 255
+	maxOrigins   = 20
+	maxDelegates = 20
+	maxBodySize  = 1 << 20
+)
+
+// Option configures a Server.
+type Option func(*Server)
+
+// AccessToken makes the Server require `Authorization: Bearer <token>`.
+// Without it, any request is served.
+func AccessToken(token string) Option {
+	return func(s *Server) {
+		s.token = token
+	}
+}
+
+// Delegates sets the multiaddrs returned to clients as the peers that will
+// fetch the content, such as the providers' nodes.
+func Delegates(addrs ...string) Option {
+	return func(s *Server) {
+		s.delegates = append(s.delegates, addrs...)
+	}
+}
+
+// Gateway sets the trustless gateway the CAR of a pin is fetched from for
+// pinners that can't pin a CID themselves, dag.DefaultGateway if empty.
+func Gateway(gateway string) Option {
+	return func(s *Server) {
+		s.gateway = gateway
+	}
+}
+
+// HTTPClient sets the client used to fetch CARs from the gateway.
+func HTTPClient(client *http.Client) Option {
+	return func(s *Server) {
+		s.client = client
+	}
+}
+
+// StateFile keeps the pin requests in the JSON file at fp, so they survive
+// restarts. Requests that were queued or pinning are resumed.
+func StateFile(fp string) Option {
+	return func(s *Server) {
+		s.statePath = fp
+	}
+}
+
+// ErrorLog sets the logger of the errors met while processing pin requests
+// in the background, such as failing to save the state file. The log
+// package's standard logger is used if nil.
+func ErrorLog(l *log.Logger) Option {
+	return func(s *Server) {
+		s.errorLog = l
+	}
+}
+
+// Workers sets how many pin requests are processed at once.
+func Workers(n int) Option {
+	return func(s *Server) {
+		s.workers = n
+	}
+}
+
+// Server is an http.Handler implementing the Pinning Service API: `/pins`
+// to list and add pins, `/pins/{requestid}` to get, replace and remove one.
+// Every pin request is dispatched to all the pinners at once. It's pinned
+// once all of them pinned it, or failed once all of them are done and any
+// of them failed, the Info of the pin giving the outcome by pinner.
+// Removing a pin unpins the CID from the pinners that support it, unless
+// another request holds it.
+//
+// Example:
+//
+// > ps := &justpin.Pinners{Web3Storage: justpin.MustNewPinner(cfg, justpin.ClientNameWeb3Storage)}
+// > srv, err := psa.NewServer(ps.All(), psa.AccessToken("secret"), psa.StateFile("pins.json"))
+// >
+// > err = http.ListenAndServe(":8080", srv)
+//
+// > ipfs pin remote service add justpin http://localhost:8080 secret
+type Server struct {
+	targets   []pinners.Pinner
+	token     string
+	delegates []string
+	gateway   string
+	client    *http.Client
+	statePath string
+	workers   int
+	errorLog  *log.Logger
+
+	sem chan struct{}
+
+	mu   sync.Mutex
+	pins map[string]*PinStatus
+}
+
+// NewServer returns a Server pinning to targets. It fails when the state
+// file can't be read.
+func NewServer(targets []pinners.Pinner, opts ...Option) (*Server, error) {
+	if len(targets) == 0 {
+		return nil, fmt.Errorf("no pinners to pin to")
+	}
+	s := &Server{targets: targets}
+	for _, opt := range opts {
+		opt(s)
+	}
+	if len(s.delegates) > maxDelegates {
+		return nil, fmt.Errorf("at most %d delegates", maxDelegates)
+	}
+	if s.delegates == nil {
+		s.delegates = []string{}
+	}
+	if s.gateway == "" {
+		s.gateway = dag.DefaultGateway
+	}
+	s.gateway = strings.TrimSuffix(s.gateway, "/")
+	if s.client == nil {
+		s.client = http.DefaultClient
+	}
+	if s.workers <= 0 {
+		s.workers = DefaultWorkers
+	}
+	s.sem = make(chan struct{}, s.workers)
+
+	var err error
+	if s.pins, err = loadState(s.statePath); err != nil {
+		return nil, err
+	}
+	var resumed []string
+	for id, ps := range s.pins {
+		if ps.Status == StatusQueued || ps.Status == StatusPinning {
+			ps.Status = StatusQueued
+			resumed = append(resumed, id)
+		}
+	}
+	for _, id := range resumed {
+		go s.process(id)
+	}
+	return s, nil
+}
+
+func (s *Server) logf(format string, a ...interface{}) {
+	if s.errorLog != nil {
+		s.errorLog.Printf(format, a...)
+		return
+	}
+	log.Printf(format, a...)
+}
+
+// apiError is an error answered as a Failure of the API.
+type apiError struct {
+	status  int
+	reason  string
+	details string
+}
+
+func (e *apiError) Error() string {
+	return e.details
+}
+
+func newError(status int, reason, format string, a ...interface{}) *apiError {
+	return &apiError{status: status, reason: reason, details: fmt.Sprintf(format, a...)}
+}
+
+var errNotFound = newError(http.StatusNotFound, "NOT_FOUND", "The specified resource was not found")
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	status, v, err := s.serve(r)
+	if err != nil {
+		ae, ok := err.(*apiError)
+		if !ok {
+			ae = newError(http.StatusInternalServerError, "INTERNAL_SERVER_ERROR", "%v", err)
+		}
+		status = ae.status
+		v = map[string]interface{}{"error": map[string]string{"reason": ae.reason, "details": ae.details}}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if v != nil {
+		_ = json.NewEncoder(w).Encode(v)
+	}
+}
+
+func (s *Server) serve(r *http.Request) (int, interface{}, error) {
+	if s.token != "" {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) != 1 {
+			return 0, nil, newError(http.StatusUnauthorized, "UNAUTHORIZED", "Access token is missing or invalid")
+		}
+	}
+
+	rest, ok := strings.CutPrefix(strings.TrimSuffix(r.URL.Path, "/"), "/pins")
+	if !ok {
+		return 0, nil, errNotFound
+	}
+	if rest == "" {
+		switch r.Method {
+		case http.MethodGet:
+			return s.listPins(r)
+		case http.MethodPost:
+			return s.addPin(r, "")
+		}
+		return 0, nil, errMethod(r)
+	}
+
+	id, ok := strings.CutPrefix(rest, "/")
+	if !ok || id == "" || strings.Contains(id, "/") {
+		return 0, nil, errNotFound
+	}
+	switch r.Method {
+	case http.MethodGet:
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		ps := s.pins[id]
+		if ps == nil {
+			return 0, nil, errNotFound
+		}
+		return http.StatusOK, *ps, nil
+	case http.MethodPost:
+		return s.addPin(r, id)
+	case http.MethodDelete:
+		if err := s.removePin(id); err != nil {
+			return 0, nil, err
+		}
+		return http.StatusAccepted, nil, nil
+	}
+	return 0, nil, errMethod(r)
+}
+
+func errMethod(r *http.Request) error {
+	return newError(http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "Method %s is not allowed", r.Method)
+}
+
+func badRequest(format string, a ...interface{}) error {
+	return newError(http.StatusBadRequest, "BAD_REQUEST", format, a...)
+}
+
+func (s *Server) listPins(r *http.Request) (int, interface{}, error) {
+	query := r.URL.Query()
+	f := &filter{name: query.Get("name"), match: query.Get("match"), status: map[Status]bool{}}
+
+	if v := query.Get("cid"); v != "" {
+		f.cids = map[string]bool{}
+		for _, v := range strings.Split(v, ",") {
+			c, err := cid.Decode(v)
+			if err != nil {
+				return 0, nil, badRequest("Invalid cid %q", v)
+			}
+			f.cids[c.String()] = true
+		}
+		if len(f.cids) > maxCids {
+			return 0, nil, badRequest("At most %d CIDs can be given", maxCids)
+		}
+	}
+	switch f.match {
+	case "", "exact", "iexact", "partial", "ipartial":
+	default:
+		return 0, nil, badRequest("Invalid match %q", f.match)
+	}
+	statuses := query.Get("status")
+	if statuses == "" {
+		statuses = string(StatusPinned)
+	}
+	for _, st := range strings.Split(statuses, ",") {
+		switch Status(st) {
+		case StatusQueued, StatusPinning, StatusPinned, StatusFailed:
+			f.status[Status(st)] = true
+		default:
+			return 0, nil, badRequest("Invalid status %q", st)
+		}
+	}
+	for name, t := range map[string]*time.Time{"before": &f.before, "after": &f.after} {
+		if v := query.Get(name); v != "" {
+			var err error
+			if *t, err = time.Parse(time.RFC3339Nano, v); err != nil {
+				return 0, nil, badRequest("Invalid %s timestamp %q", name, v)
+			}
+		}
+	}
+	limit := defaultLimit
+	if v := query.Get("limit"); v != "" {
+		var err error
+		if limit, err = strconv.Atoi(v); err != nil || limit < 1 || limit > maxLimit {
+			return 0, nil, badRequest("Limit must be between 1 and %d", maxLimit)
+		}
+	}
+	if v := query.Get("meta"); v != "" {
+		if err := json.Unmarshal([]byte(v), &f.meta); err != nil {
+			return 0, nil, badRequest("Invalid meta: %v", err)
+		}
+	}
+
+	count, results := s.list(f, limit)
+	if results == nil {
+		results = []PinStatus{}
+	}
+	return http.StatusOK, map[string]interface{}{"count": count, "results": results}, nil
+}
+
+// addPin queues the pin in the body of r, replacing the pin replaced when
+// it's set.
+func (s *Server) addPin(r *http.Request, replaced string) (int, interface{}, error) {
+	var pin Pin
+	dec := json.NewDecoder(io.LimitReader(r.Body, maxBodySize))
+	if err := dec.Decode(&pin); err != nil {
+		return 0, nil, badRequest("Invalid pin: %v", err)
+	}
+	c, err := cid.Decode(pin.Cid)
+	if err != nil {
+		return 0, nil, badRequest("Invalid cid %q", pin.Cid)
+	}
+	if len(pin.Name) > maxNameLen {
+		return 0, nil, badRequest("Name is longer than %d characters", maxNameLen)
+	}
+	if len(pin.Origins) > maxOrigins {
+		return 0, nil, badRequest("At most %d origins can be given", maxOrigins)
+	}
+
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return 0, nil, err
+	}
+	ps := &PinStatus{
+		RequestID: hex.EncodeToString(buf),
+		Status:    StatusQueued,
+		Created:   time.Now().UTC(),
+		Pin:       pin,
+		Delegates: s.delegates,
+	}
+	ps.Pin.Cid = c.String()
+
+	s.mu.Lock()
+	if replaced != "" {
+		old := s.pins[replaced]
+		if old == nil {
+			s.mu.Unlock()
+			return 0, nil, errNotFound
+		}
+		delete(s.pins, replaced)
+		if old.Pin.Cid != ps.Pin.Cid {
+			ps.replaces = old.Pin.Cid
+		}
+	}
+	s.pins[ps.RequestID] = ps
+	err = s.save()
+	resp := *ps
+	s.mu.Unlock()
+	if err != nil {
+		return 0, nil, err
+	}
+
+	go s.process(ps.RequestID)
+	return http.StatusAccepted, resp, nil
+}
+
+func (s *Server) removePin(id string) error {
+	s.mu.Lock()
+	ps := s.pins[id]
+	if ps == nil {
+		s.mu.Unlock()
+		return errNotFound
+	}
+	delete(s.pins, id)
+	done := ps.Status == StatusPinned || ps.Status == StatusFailed
+	err := s.save()
+	s.mu.Unlock()
+
+	// A request still in progress unpins once done.
+	if done {
+		go s.unpin(ps.Pin.Cid)
+	}
+	return err
+}
@@ -0,0 +1,209 @@
+package psa
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/heilart1n/justpin-ipfs/dag"
+	"github.com/heilart1n/justpin-ipfs/pinners"
+	"github.com/ipfs/go-cid"
+)
+
+type result string
+
+func (r result) GetHash() string { return string(r) }
+func (r result) GetLink() string { return "" }
+
+// fakePinner answers PinHash with pinned or err, once release is closed
+// when set.
+type fakePinner struct {
+	name    string
+	pinned  bool
+	err     error
+	release chan struct{}
+}
+
+func (p *fakePinner) Name() string { return p.name }
+func (p *fakePinner) PinHash(hash string) (bool, error) {
+	if p.release != nil {
+		<-p.release
+	}
+	return p.pinned, p.err
+}
+func (p *fakePinner) PinFile(fp string) (pinners.Result, error)       { return nil, fmt.Errorf("no") }
+func (p *fakePinner) PinWithReader(io.Reader) (pinners.Result, error) { return nil, fmt.Errorf("no") }
+func (p *fakePinner) PinWithBytes([]byte) (pinners.Result, error)     { return nil, fmt.Errorf("no") }
+func (p *fakePinner) PinDir(name string) (pinners.Result, error)      { return nil, fmt.Errorf("no") }
+func (p *fakePinner) Pin(path interface{}) (pinners.Result, error)    { return nil, fmt.Errorf("no") }
+
+// carPinner takes the CARs fakePinner can't pin by CID.
+type carPinner struct {
+	fakePinner
+	blocks int
+}
+
+func (p *carPinner) PinCAR(rd io.Reader) (pinners.Result, error) {
+	roots, err := dag.ReadCAR(rd, func(cid.Cid, []byte) error {
+		p.blocks++
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result(roots[0].String()), nil
+}
+
+func addPin(t *testing.T, url, c string) string {
+	t.Helper()
+	resp, err := http.Post(url+"/pins", "application/json", strings.NewReader(`{"cid":"`+c+`"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var ps PinStatus
+	if err := json.NewDecoder(resp.Body).Decode(&ps); err != nil || resp.StatusCode != http.StatusAccepted {
+		t.Fatalf("add pin: %s, %v", resp.Status, err)
+	}
+	return ps.RequestID
+}
+
+func getPin(t *testing.T, url, id string) *PinStatus {
+	t.Helper()
+	resp, err := http.Get(url + "/pins/" + id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var ps PinStatus
+	if err := json.NewDecoder(resp.Body).Decode(&ps); err != nil {
+		t.Fatal(err)
+	}
+	return &ps
+}
+
+// waitPin returns the pin id once done.
+func waitPin(t *testing.T, url, id string) *PinStatus {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if ps := getPin(t, url, id); ps.Status == StatusPinned || ps.Status == StatusFailed {
+			return ps
+		}
+	}
+	t.Fatalf("pin %s not done", id)
+	return nil
+}
+
+func newTestServer(t *testing.T, targets []pinners.Pinner, opts ...Option) *httptest.Server {
+	t.Helper()
+	s, err := NewServer(targets, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(s)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+const testCid = "bafkreifzjut3te2nhyekklss27nh3k72ysco7y32koao5eei66wof36n5e"
+
+func TestPinWaitsForAllPinners(t *testing.T) {
+	slow := &fakePinner{name: "slow", pinned: true, release: make(chan struct{})}
+	failing := &fakePinner{name: "failing", err: fmt.Errorf("quota exceeded")}
+	srv := newTestServer(t, []pinners.Pinner{slow, failing})
+
+	id := addPin(t, srv.URL, testCid)
+	time.Sleep(50 * time.Millisecond)
+	if ps := getPin(t, srv.URL, id); ps.Status != StatusPinning {
+		t.Errorf("status %s while a pinner is busy, want %s", ps.Status, StatusPinning)
+	}
+	close(slow.release)
+
+	ps := waitPin(t, srv.URL, id)
+	if ps.Status != StatusFailed || ps.Info["slow"] != string(StatusPinned) || !strings.Contains(ps.Info["failing"], "quota exceeded") {
+		t.Errorf("pin %s, info %v", ps.Status, ps.Info)
+	}
+}
+
+func TestPinCARFromGateway(t *testing.T) {
+	ctx := context.Background()
+	b := dag.NewBuilder()
+	nd, err := b.AddReader(ctx, strings.NewReader(strings.Repeat("car", 100000)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	gw := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, err := cid.Decode(strings.TrimPrefix(r.URL.Path, "/ipfs/"))
+		if err != nil || c.Hash().HexString() != nd.Cid().Hash().HexString() || r.URL.Query().Get("format") != "car" {
+			http.NotFound(w, r)
+			return
+		}
+		b.WriteCAR(r.Context(), w, nd.Cid())
+	}))
+	defer gw.Close()
+
+	// Kubo asks for CIDv0, the CAR's root is a CIDv1 of the same node.
+	if nd.Cid().Version() != 1 {
+		t.Fatalf("built %s, want a CIDv1", nd.Cid())
+	}
+	for _, c := range []cid.Cid{nd.Cid(), cid.NewCidV0(nd.Cid().Hash())} {
+		p := &carPinner{fakePinner: fakePinner{name: "car"}}
+		srv := newTestServer(t, []pinners.Pinner{p}, Gateway(gw.URL))
+		ps := waitPin(t, srv.URL, addPin(t, srv.URL, c.String()))
+		if ps.Status != StatusPinned || p.blocks < 2 {
+			t.Errorf("pin %s: %s with %d blocks, info %v", c, ps.Status, p.blocks, ps.Info)
+		}
+	}
+}
+
+// syncBuffer is a log output written to by the workers.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestSaveErrorLogged(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "state")
+	if err := os.Mkdir(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	p := &fakePinner{name: "fake", pinned: true, release: make(chan struct{})}
+	var logs syncBuffer
+	srv := newTestServer(t, []pinners.Pinner{p}, StateFile(filepath.Join(dir, "pins.json")), ErrorLog(log.New(&logs, "", 0)))
+
+	id := addPin(t, srv.URL, testCid)
+	if err := os.RemoveAll(dir); err != nil {
+		t.Fatal(err)
+	}
+	close(p.release)
+	waitPin(t, srv.URL, id)
+	for deadline := time.Now().Add(5 * time.Second); logs.String() == "" && time.Now().Before(deadline); {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got := logs.String(); !strings.Contains(got, "save state of pin "+id) {
+		t.Errorf("log %q, want the save error", got)
+	}
+}
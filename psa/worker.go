@@ -0,0 +1,141 @@
+package psa
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/heilart1n/justpin-ipfs/dag"
+	httpretry "github.com/heilart1n/justpin-ipfs/http"
+	"github.com/heilart1n/justpin-ipfs/pinners"
+)
+
+// process pins the request id to every pinner and records the outcome.
+func (s *Server) process(id string) {
+	s.sem <- struct{}{}
+	defer func() { <-s.sem }()
+
+	s.mu.Lock()
+	ps := s.pins[id]
+	if ps == nil {
+		s.mu.Unlock()
+		return
+	}
+	ps.Status = StatusPinning
+	c := ps.Pin.Cid
+	s.mu.Unlock()
+
+	info := make(map[string]string, len(s.targets))
+	status := StatusPinned
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, p := range s.targets {
+		wg.Add(1)
+		go func(p pinners.Pinner) {
+			defer wg.Done()
+			err := s.pinTo(p, c)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				info[p.Name()] = err.Error()
+				status = StatusFailed
+				return
+			}
+			info[p.Name()] = string(StatusPinned)
+		}(p)
+	}
+	wg.Wait()
+
+	s.mu.Lock()
+	if s.pins[id] != ps {
+		// Removed while pinning.
+		s.mu.Unlock()
+		s.unpin(c)
+		return
+	}
+	// Info is replaced, not updated, as copies of ps share it.
+	ps.Status, ps.Info = status, info
+	replaces := ps.replaces
+	ps.replaces = ""
+	err := s.save()
+	s.mu.Unlock()
+	if err != nil {
+		s.logf("psa: save state of pin %s failed: %v", id, err)
+	}
+
+	if status == StatusPinned && replaces != "" {
+		s.unpin(replaces)
+	}
+}
+
+// pinTo pins c to p by its CID. When p can't, or fails to, and takes CARs,
+// the DAG is streamed to it from the gateway instead.
+func (s *Server) pinTo(p pinners.Pinner, c string) error {
+	ok, err := p.PinHash(c)
+	if err == nil && ok {
+		return nil
+	}
+	if err == nil {
+		err = fmt.Errorf("not pinned")
+	}
+	cp, isCAR := p.(pinners.CARPinner)
+	if !isCAR {
+		return err
+	}
+
+	if carErr := s.pinCAR(cp, c); carErr != nil {
+		return errors.Join(err, carErr)
+	}
+	return nil
+}
+
+// pinCAR streams the CAR of c from the trustless gateway into p. The CAR
+// isn't buffered: the pinners send a body they can't produce again with
+// httpretry.Do, once and without retries, so a failed upload fails the pin.
+func (s *Server) pinCAR(p pinners.CARPinner, c string) error {
+	req, err := http.NewRequest(http.MethodGet, s.gateway+"/ipfs/"+c+"?format=car", nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/vnd.ipld.car")
+
+	httpClient := httpretry.NewClient(s.client)
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("fetch car of %s failed: %s", c, resp.Status)
+	}
+
+	result, err := p.PinCAR(resp.Body)
+	if err != nil {
+		return err
+	}
+	if !dag.SameCid(result.GetHash(), c) {
+		return fmt.Errorf("pinned %s instead of %s", result.GetHash(), c)
+	}
+	return nil
+}
+
+// unpin removes c from the pinners that support it, unless a request still
+// holds it. It's best effort, errors are dropped.
+func (s *Server) unpin(c string) {
+	s.mu.Lock()
+	for _, ps := range s.pins {
+		if ps.Pin.Cid == c {
+			s.mu.Unlock()
+			return
+		}
+	}
+	s.mu.Unlock()
+
+	for _, p := range s.targets {
+		if up, ok := p.(pinners.Unpinner); ok {
+			_ = up.Unpin(c)
+		}
+	}
+}
@@ -0,0 +1,347 @@
+package s3
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	signAlgorithm   = "AWS4-HMAC-SHA256"
+	unsignedPayload = "UNSIGNED-PAYLOAD"
+	amzDateFormat   = "20060102T150405Z"
+
+	// maxClockSkew is how far the date of a signed request may be from now.
+	maxClockSkew = 15 * time.Minute
+	// maxPresignExpiry is the longest validity of a presigned URL.
+	maxPresignExpiry = 7 * 24 * time.Hour
+)
+
+var (
+	errSignature   = newError(http.StatusForbidden, "SignatureDoesNotMatch", "The request signature we calculated does not match the signature you provided")
+	errAccessKey   = newError(http.StatusForbidden, "InvalidAccessKeyId", "The AWS Access Key Id you provided does not exist in our records")
+	errBadDigest   = newError(http.StatusBadRequest, "BadDigest", "The Content-MD5 or checksum you specified did not match what was received")
+	errContentHash = newError(http.StatusBadRequest, "XAmzContentSHA256Mismatch", "The provided 'x-amz-content-sha256' header does not match what was computed")
+)
+
+// signature is the parsed authorization of a request signed with AWS
+// Signature Version 4, from its headers or presigned query.
+type signature struct {
+	accessKey     string
+	scope         string // date/region/service/aws4_request
+	date          string
+	signedHeaders []string
+	signature     string
+	payloadHash   string
+	presigned     bool
+}
+
+// authenticate checks the signature of r when the Server has credentials.
+func (s *Server) authenticate(r *http.Request) error {
+	if s.accessKey == "" {
+		return nil
+	}
+
+	sig, err := parseSignature(r)
+	if err != nil {
+		return err
+	}
+	if sig.accessKey != s.accessKey {
+		return errAccessKey
+	}
+	scope := strings.Split(sig.scope, "/")
+	if len(scope) != 4 || scope[2] != "s3" || scope[3] != "aws4_request" || !strings.HasPrefix(sig.date, scope[0]) {
+		return newError(http.StatusBadRequest, "AuthorizationHeaderMalformed", "Invalid credential scope %q", sig.scope)
+	}
+
+	date, err := time.Parse(amzDateFormat, sig.date)
+	if err != nil {
+		return newError(http.StatusBadRequest, "AuthorizationHeaderMalformed", "Invalid date %q", sig.date)
+	}
+	now := time.Now()
+	if sig.presigned {
+		expires, err := strconv.Atoi(r.URL.Query().Get("X-Amz-Expires"))
+		if err != nil || expires < 0 || time.Duration(expires)*time.Second > maxPresignExpiry {
+			return newError(http.StatusBadRequest, "AuthorizationQueryParametersError", "Invalid X-Amz-Expires")
+		}
+		if now.Before(date.Add(-maxClockSkew)) || now.After(date.Add(time.Duration(expires)*time.Second)) {
+			return newError(http.StatusForbidden, "AccessDenied", "Request has expired")
+		}
+	} else if now.Sub(date) > maxClockSkew || date.Sub(now) > maxClockSkew {
+		return newError(http.StatusForbidden, "RequestTimeTooSkewed", "The difference between the request time and the server's time is too large")
+	}
+
+	want := sign(s.secretKey, r, sig)
+	if subtle.ConstantTimeCompare([]byte(want), []byte(sig.signature)) != 1 {
+		return errSignature
+	}
+	return nil
+}
+
+// sign returns the signature of r, as parsed in sig, with secretKey.
+func sign(secretKey string, r *http.Request, sig *signature) string {
+	key := []byte("AWS4" + secretKey)
+	for _, part := range strings.Split(sig.scope, "/") {
+		key = hmacSHA256(key, part)
+	}
+	stringToSign := strings.Join([]string{signAlgorithm, sig.date, sig.scope, hexSHA256(canonicalRequest(r, sig))}, "\n")
+	return hex.EncodeToString(hmacSHA256(key, stringToSign))
+}
+
+func parseSignature(r *http.Request) (*signature, error) {
+	query := r.URL.Query()
+	if query.Get("X-Amz-Algorithm") != "" {
+		if query.Get("X-Amz-Algorithm") != signAlgorithm {
+			return nil, newError(http.StatusBadRequest, "AuthorizationQueryParametersError", "Unsupported algorithm")
+		}
+		sig := &signature{
+			date:          query.Get("X-Amz-Date"),
+			signedHeaders: strings.Split(query.Get("X-Amz-SignedHeaders"), ";"),
+			signature:     query.Get("X-Amz-Signature"),
+			payloadHash:   unsignedPayload,
+			presigned:     true,
+		}
+		sig.accessKey, sig.scope, _ = strings.Cut(query.Get("X-Amz-Credential"), "/")
+		return sig, nil
+	}
+
+	auth := r.Header.Get("Authorization")
+	if auth == "" {
+		return nil, errAccessDenied
+	}
+	params, ok := strings.CutPrefix(auth, signAlgorithm+" ")
+	if !ok {
+		return nil, newError(http.StatusBadRequest, "AuthorizationHeaderMalformed", "Only %s is supported", signAlgorithm)
+	}
+	sig := &signature{date: r.Header.Get("X-Amz-Date"), payloadHash: r.Header.Get("X-Amz-Content-Sha256")}
+	if sig.date == "" {
+		if t, err := http.ParseTime(r.Header.Get("Date")); err == nil {
+			sig.date = t.UTC().Format(amzDateFormat)
+		}
+	}
+	for _, param := range strings.Split(params, ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(param), "=")
+		switch name {
+		case "Credential":
+			sig.accessKey, sig.scope, _ = strings.Cut(value, "/")
+		case "SignedHeaders":
+			sig.signedHeaders = strings.Split(value, ";")
+		case "Signature":
+			sig.signature = value
+		}
+	}
+	if sig.payloadHash == "" {
+		return nil, newError(http.StatusBadRequest, "InvalidRequest", "Missing required header for this request: x-amz-content-sha256")
+	}
+	return sig, nil
+}
+
+// canonicalRequest returns the canonical form of r that gets signed.
+func canonicalRequest(r *http.Request, sig *signature) string {
+	var query []string
+	for name, values := range r.URL.Query() {
+		if sig.presigned && name == "X-Amz-Signature" {
+			continue
+		}
+		for _, value := range values {
+			query = append(query, uriEncode(name, true)+"="+uriEncode(value, true))
+		}
+	}
+	sort.Strings(query)
+
+	var headers strings.Builder
+	for _, name := range sig.signedHeaders {
+		var value string
+		switch values := r.Header.Values(name); {
+		case name == "host":
+			value = r.Host
+		case name == "content-length" && len(values) == 0:
+			value = strconv.FormatInt(r.ContentLength, 10)
+		default:
+			trimmed := make([]string, len(values))
+			for i, v := range values {
+				trimmed[i] = strings.Join(strings.Fields(v), " ")
+			}
+			value = strings.Join(trimmed, ",")
+		}
+		headers.WriteString(name + ":" + value + "\n")
+	}
+
+	return strings.Join([]string{
+		r.Method,
+		uriEncode(r.URL.Path, false),
+		strings.Join(query, "&"),
+		headers.String(),
+		strings.Join(sig.signedHeaders, ";"),
+		sig.payloadHash,
+	}, "\n")
+}
+
+// uriEncode escapes s as AWS does: everything but unreserved characters,
+// and slashes unless encodeSlash is set.
+func uriEncode(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z' || c >= '0' && c <= '9' ||
+			c == '-' || c == '_' || c == '.' || c == '~' || c == '/' && !encodeSlash {
+			b.WriteByte(c)
+			continue
+		}
+		fmt.Fprintf(&b, "%%%02X", c)
+	}
+	return b.String()
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+func hexSHA256(data string) string {
+	sum := sha256.Sum256([]byte(data))
+	return hex.EncodeToString(sum[:])
+}
+
+// body returns the content of an upload, decoded from `aws-chunked` when
+// streamed that way. The x-amz-content-sha256 and Content-MD5 headers are
+// checked when the content ends, failing the read, and so the pin, when
+// they don't match. The signatures of the chunks aren't checked.
+func (s *Server) body(r *http.Request) (io.Reader, error) {
+	var rd io.Reader = r.Body
+	payloadHash := r.Header.Get("X-Amz-Content-Sha256")
+	if strings.HasPrefix(payloadHash, "STREAMING-") {
+		rd = &chunkedReader{r: bufio.NewReader(r.Body)}
+	}
+
+	cr := &checkedReader{r: rd}
+	if sum, err := hex.DecodeString(payloadHash); err == nil && len(sum) == sha256.Size {
+		cr.checks = append(cr.checks, check{hash: sha256.New(), sum: sum, err: errContentHash})
+	}
+	if v := r.Header.Get("Content-MD5"); v != "" {
+		sum, err := base64.StdEncoding.DecodeString(v)
+		if err != nil || len(sum) != md5.Size {
+			return nil, newError(http.StatusBadRequest, "InvalidDigest", "The Content-MD5 you specified was invalid")
+		}
+		cr.checks = append(cr.checks, check{hash: md5.New(), sum: sum, err: errBadDigest})
+	}
+	return cr, nil
+}
+
+type check struct {
+	hash hash.Hash
+	sum  []byte
+	err  error
+}
+
+// checkedReader hashes what it reads and fails at EOF when a hash differs
+// from the expected one.
+type checkedReader struct {
+	r      io.Reader
+	checks []check
+}
+
+func (cr *checkedReader) Read(p []byte) (int, error) {
+	n, err := cr.r.Read(p)
+	for _, c := range cr.checks {
+		c.hash.Write(p[:n])
+	}
+	if err == io.EOF {
+		for _, c := range cr.checks {
+			if !bytes.Equal(c.hash.Sum(nil), c.sum) {
+				return n, c.err
+			}
+		}
+	}
+	return n, err
+}
+
+// chunkedReader decodes the `aws-chunked` content encoding: chunks of
+// `size[;chunk-signature=...]\r\n data \r\n` ended by an empty chunk and
+// optional trailers.
+type chunkedReader struct {
+	r    *bufio.Reader
+	left int64
+	done bool
+}
+
+func (cr *chunkedReader) Read(p []byte) (int, error) {
+	for cr.left == 0 {
+		if cr.done {
+			return 0, io.EOF
+		}
+		if err := cr.next(); err != nil {
+			return 0, err
+		}
+	}
+	if int64(len(p)) > cr.left {
+		p = p[:cr.left]
+	}
+	n, err := cr.r.Read(p)
+	cr.left -= int64(n)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	if cr.left == 0 && err == nil {
+		err = cr.crlf()
+	}
+	return n, err
+}
+
+// next reads the header of the next chunk, and the trailers after the last.
+func (cr *chunkedReader) next() error {
+	line, err := cr.line()
+	if err != nil {
+		return err
+	}
+	sizeHex, _, _ := strings.Cut(line, ";")
+	size, err := strconv.ParseInt(strings.TrimSpace(sizeHex), 16, 64)
+	if err != nil || size < 0 {
+		return newError(http.StatusBadRequest, "IncompleteBody", "Invalid chunk size %q", sizeHex)
+	}
+	if size > 0 {
+		cr.left = size
+		return nil
+	}
+
+	cr.done = true
+	for {
+		line, err := cr.line()
+		if err == io.EOF || err == nil && line == "" {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (cr *chunkedReader) line() (string, error) {
+	line, err := cr.r.ReadString('\n')
+	if err == io.EOF && line != "" {
+		err = io.ErrUnexpectedEOF
+	}
+	return strings.TrimRight(line, "\r\n"), err
+}
+
+func (cr *chunkedReader) crlf() error {
+	line, err := cr.line()
+	if err == nil && line != "" {
+		err = newError(http.StatusBadRequest, "IncompleteBody", "Chunk is longer than its size")
+	}
+	return err
+}
@@ -0,0 +1,156 @@
+package s3
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/heilart1n/justpin-ipfs/pinners/dryrun"
+)
+
+const emptySHA256 = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+// TestSign checks the GET Object example of the AWS Signature Version 4
+// documentation.
+func TestSign(t *testing.T) {
+	r, err := http.NewRequest(http.MethodGet, "https://examplebucket.s3.amazonaws.com/test.txt", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Header.Set("Range", "bytes=0-9")
+	r.Header.Set("X-Amz-Content-Sha256", emptySHA256)
+	r.Header.Set("X-Amz-Date", "20130524T000000Z")
+	sig := &signature{
+		scope:         "20130524/us-east-1/s3/aws4_request",
+		date:          "20130524T000000Z",
+		signedHeaders: []string{"host", "range", "x-amz-content-sha256", "x-amz-date"},
+		payloadHash:   emptySHA256,
+	}
+
+	got := sign("wJalrXUtnFEMI/K7MDENG/bPxRfiCYEXAMPLEKEY", r, sig)
+	if want := "f0e8bdb87c964420e857bd35b5d6ed310bd44f0170aba48dd91039c6036bdb41"; got != want {
+		t.Errorf("signature = %s, want %s", got, want)
+	}
+}
+
+// signRequest signs r with the key pair as made at date.
+func signRequest(r *http.Request, accessKey, secretKey string, date time.Time, payloadHash string) {
+	sig := &signature{
+		scope:         date.Format("20060102") + "/us-east-1/s3/aws4_request",
+		date:          date.Format(amzDateFormat),
+		signedHeaders: []string{"host", "x-amz-content-sha256", "x-amz-date"},
+		payloadHash:   payloadHash,
+	}
+	r.Header.Set("X-Amz-Date", sig.date)
+	r.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	r.Header.Set("Authorization", signAlgorithm+" Credential="+accessKey+"/"+sig.scope+
+		", SignedHeaders="+strings.Join(sig.signedHeaders, ";")+", Signature="+sign(secretKey, r, sig))
+}
+
+func TestAuthenticate(t *testing.T) {
+	srv := newTestServer(t, dryrun.NewClient(nil), Credentials("key", "secret"))
+	now := time.Now().UTC()
+	helloSHA256 := "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"
+
+	tests := []struct {
+		name        string
+		method      string
+		path        string
+		body        string
+		secretKey   string
+		date        time.Time
+		payloadHash string
+		status      int
+	}{
+		{"signed", http.MethodPut, "/bucket", "", "secret", now, emptySHA256, http.StatusOK},
+		{"unsigned", http.MethodGet, "/", "", "", now, "", http.StatusForbidden},
+		{"wrong secret", http.MethodGet, "/", "", "other", now, emptySHA256, http.StatusForbidden},
+		{"skewed date", http.MethodGet, "/", "", "secret", now.Add(-time.Hour), emptySHA256, http.StatusForbidden},
+		{"signed payload", http.MethodPut, "/bucket/hello", "hello", "secret", now, helloSHA256, http.StatusOK},
+		{"unsigned payload", http.MethodPut, "/bucket/hello", "hello", "secret", now, unsignedPayload, http.StatusOK},
+		{"payload mismatch", http.MethodPut, "/bucket/hello", "hello!", "secret", now, helloSHA256, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		r, err := http.NewRequest(tt.method, srv.URL+tt.path, strings.NewReader(tt.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tt.secretKey != "" {
+			signRequest(r, "key", tt.secretKey, tt.date, tt.payloadHash)
+		}
+		resp, err := http.DefaultClient.Do(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != tt.status {
+			t.Errorf("%s: %s, want %d", tt.name, resp.Status, tt.status)
+		}
+	}
+}
+
+func TestChunkedUpload(t *testing.T) {
+	srv := newTestServer(t, dryrun.NewClient(nil))
+	do(t, http.MethodPut, srv.URL+"/bucket", "")
+	hello, err := dryrun.NewClient(nil).PinWithBytes([]byte("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		body   string
+		status int
+	}{
+		{"chunks", "3;chunk-signature=aa\r\nhel\r\n2;chunk-signature=bb\r\nlo\r\n0;chunk-signature=cc\r\n\r\n", http.StatusOK},
+		{"trailers", "5\r\nhello\r\n0\r\nx-amz-checksum-crc32:NhCmhg==\r\n\r\n", http.StatusOK},
+		{"invalid size", "zz;chunk-signature=aa\r\nhello\r\n0\r\n\r\n", http.StatusBadRequest},
+		{"long chunk", "3\r\nhello\r\n0\r\n\r\n", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		r, err := http.NewRequest(http.MethodPut, srv.URL+"/bucket/hello", strings.NewReader(tt.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		r.Header.Set("X-Amz-Content-Sha256", "STREAMING-AWS4-HMAC-SHA256-PAYLOAD")
+		r.Header.Set("Content-Encoding", "aws-chunked")
+		resp, err := http.DefaultClient.Do(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != tt.status {
+			t.Errorf("%s: %s, want %d", tt.name, resp.Status, tt.status)
+			continue
+		}
+		if got := resp.Header.Get(CidHeader); tt.status == http.StatusOK && got != hello.GetHash() {
+			t.Errorf("%s: pinned as %s, want %s", tt.name, got, hello.GetHash())
+		}
+	}
+}
+
+func TestContentMD5(t *testing.T) {
+	srv := newTestServer(t, dryrun.NewClient(nil))
+	do(t, http.MethodPut, srv.URL+"/bucket", "")
+
+	for md5, status := range map[string]int{
+		"XUFAKrxLKna5cZ2REBfFkg==": http.StatusOK, // MD5 of "hello"
+		"1B2M2Y8AsgTpgAmY7PhCfg==": http.StatusBadRequest,
+		"invalid":                  http.StatusBadRequest,
+	} {
+		r, err := http.NewRequest(http.MethodPut, srv.URL+"/bucket/hello", strings.NewReader("hello"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		r.Header.Set("Content-MD5", md5)
+		resp, err := http.DefaultClient.Do(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != status {
+			t.Errorf("Content-MD5 %s: %s, want %d", md5, resp.Status, status)
+		}
+	}
+}
@@ -0,0 +1,321 @@
+package s3
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/heilart1n/justpin-ipfs/file"
+)
+
+// Object is a pinned object as listed by the Server.
+type Object struct {
+	Key          string
+	Cid          string
+	Link         string
+	Size         int64
+	ETag         string
+	ContentType  string
+	LastModified time.Time
+	// Metadata are the `x-amz-meta-*` headers of the upload, by lowercase
+	// name without the prefix.
+	Metadata map[string]string `json:",omitempty"`
+}
+
+type bucket struct {
+	Created time.Time
+	Objects map[string]*Object
+}
+
+// index maps buckets and keys to objects. When path is set, it's kept in a
+// log of JSON lines: a snapshot of the buckets followed by the changes made
+// since, one line each. The log is compacted into a new snapshot when it's
+// loaded and once it holds compactRecords changes.
+type index struct {
+	mu      sync.RWMutex
+	path    string
+	records int
+	Buckets map[string]*bucket
+}
+
+// compactRecords is the number of changes after which the log is compacted.
+const compactRecords = 10000
+
+// change is a line of the log after the snapshot.
+type change struct {
+	Op      string
+	Bucket  string
+	Key     string     `json:",omitempty"`
+	Object  *Object    `json:",omitempty"`
+	Created *time.Time `json:",omitempty"`
+}
+
+const (
+	opCreateBucket = "createBucket"
+	opDeleteBucket = "deleteBucket"
+	opPut          = "put"
+	opDelete       = "delete"
+)
+
+func loadIndex(fp string) (*index, error) {
+	idx := &index{path: fp, Buckets: map[string]*bucket{}}
+	if fp == "" {
+		return idx, nil
+	}
+	f, err := os.Open(fp)
+	if errors.Is(err, os.ErrNotExist) {
+		return idx, idx.compact()
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	// A last change without a newline is a write cut short by a crash, it's
+	// dropped when it doesn't parse. The snapshot is always written whole.
+	// An index saved as a single JSON document reads as a snapshot.
+	rd := bufio.NewReader(f)
+	for n := 1; ; n++ {
+		line, err := rd.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		last := err == io.EOF
+		if len(bytes.TrimSpace(line)) > 0 {
+			var perr error
+			if n == 1 {
+				perr = json.Unmarshal(line, idx)
+			} else {
+				var c change
+				if perr = json.Unmarshal(line, &c); perr == nil {
+					idx.apply(&c)
+				}
+			}
+			if perr != nil && (n == 1 || !last) {
+				return nil, fmt.Errorf("read index %s failed: line %d: %v", fp, n, perr)
+			}
+		}
+		if last {
+			break
+		}
+	}
+	for _, b := range idx.Buckets {
+		if b.Objects == nil {
+			b.Objects = map[string]*Object{}
+		}
+	}
+	return idx, idx.compact()
+}
+
+// apply makes the change c to the index.
+func (idx *index) apply(c *change) {
+	switch c.Op {
+	case opCreateBucket:
+		b := &bucket{Objects: map[string]*Object{}}
+		if c.Created != nil {
+			b.Created = *c.Created
+		}
+		idx.Buckets[c.Bucket] = b
+	case opDeleteBucket:
+		delete(idx.Buckets, c.Bucket)
+	case opPut:
+		if b := idx.Buckets[c.Bucket]; b != nil && c.Object != nil {
+			b.Objects[c.Object.Key] = c.Object
+		}
+	case opDelete:
+		if b := idx.Buckets[c.Bucket]; b != nil {
+			delete(b.Objects, c.Key)
+		}
+	}
+}
+
+// compact replaces the log with a snapshot of the index.
+func (idx *index) compact() error {
+	if idx.path == "" {
+		return nil
+	}
+	data, err := json.Marshal(idx)
+	if err != nil {
+		return err
+	}
+	if err := file.WriteFileAtomic(idx.path, append(data, '\n')); err != nil {
+		return err
+	}
+	idx.records = 0
+	return nil
+}
+
+// save applies c and appends it to the log, the caller holds the write
+// lock.
+func (idx *index) save(c *change) error {
+	idx.apply(c)
+	if idx.path == "" {
+		return nil
+	}
+	if idx.records >= compactRecords {
+		return idx.compact()
+	}
+	data, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(idx.path, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	idx.records++
+	return nil
+}
+
+func (idx *index) buckets() map[string]time.Time {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	out := make(map[string]time.Time, len(idx.Buckets))
+	for name, b := range idx.Buckets {
+		out[name] = b.Created
+	}
+	return out
+}
+
+func (idx *index) hasBucket(name string) bool {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	return idx.Buckets[name] != nil
+}
+
+func (idx *index) createBucket(name string) error {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	if idx.Buckets[name] != nil {
+		return errBucketExists
+	}
+	now := time.Now().UTC()
+	return idx.save(&change{Op: opCreateBucket, Bucket: name, Created: &now})
+}
+
+func (idx *index) deleteBucket(name string) error {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	b := idx.Buckets[name]
+	if b == nil {
+		return errNoSuchBucket
+	}
+	if len(b.Objects) > 0 {
+		return errBucketNotEmpty
+	}
+	return idx.save(&change{Op: opDeleteBucket, Bucket: name})
+}
+
+func (idx *index) get(bucket, key string) (*Object, error) {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	b := idx.Buckets[bucket]
+	if b == nil {
+		return nil, errNoSuchBucket
+	}
+	obj := b.Objects[key]
+	if obj == nil {
+		return nil, errNoSuchKey
+	}
+	return obj, nil
+}
+
+func (idx *index) put(bucket string, obj *Object) error {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	b := idx.Buckets[bucket]
+	if b == nil {
+		return errNoSuchBucket
+	}
+	return idx.save(&change{Op: opPut, Bucket: bucket, Object: obj})
+}
+
+func (idx *index) delete(bucket, key string) error {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	b := idx.Buckets[bucket]
+	if b == nil {
+		return errNoSuchBucket
+	}
+	if b.Objects[key] == nil {
+		return nil
+	}
+	return idx.save(&change{Op: opDelete, Bucket: bucket, Key: key})
+}
+
+// listing is a page of objects and common prefixes.
+type listing struct {
+	objects   []*Object
+	prefixes  []string
+	truncated bool
+	// next is the last key or prefix of the page.
+	next string
+}
+
+// list returns up to max keys after `after` starting with prefix, keys
+// holding delimiter past the prefix rolled up into common prefixes.
+func (idx *index) list(bucket, prefix, delimiter, after string, max int) (*listing, error) {
+	idx.mu.RLock()
+	b := idx.Buckets[bucket]
+	if b == nil {
+		idx.mu.RUnlock()
+		return nil, errNoSuchBucket
+	}
+	keys := make([]string, 0, len(b.Objects))
+	for key := range b.Objects {
+		if strings.HasPrefix(key, prefix) && key > after {
+			keys = append(keys, key)
+		}
+	}
+	objects := make(map[string]*Object, len(keys))
+	for _, key := range keys {
+		objects[key] = b.Objects[key]
+	}
+	idx.mu.RUnlock()
+	sort.Strings(keys)
+
+	l := &listing{}
+	seen := map[string]bool{}
+	for _, key := range keys {
+		var common string
+		if delimiter != "" {
+			if i := strings.Index(key[len(prefix):], delimiter); i >= 0 {
+				common = key[:len(prefix)+i+len(delimiter)]
+			}
+		}
+		if common != "" && seen[common] {
+			continue
+		}
+		if common != "" && common <= after {
+			continue // the prefix was listed by a previous page
+		}
+		if len(l.objects)+len(l.prefixes) >= max {
+			l.truncated = true
+			break
+		}
+		if common != "" {
+			seen[common] = true
+			l.prefixes = append(l.prefixes, common)
+			l.next = common
+			continue
+		}
+		l.objects = append(l.objects, objects[key])
+		l.next = key
+	}
+	return l, nil
+}
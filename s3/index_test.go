@@ -0,0 +1,90 @@
+package s3
+
+import (
+	"bytes"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/heilart1n/justpin-ipfs/pinners/dryrun"
+)
+
+func TestIndexFile(t *testing.T) {
+	fp := filepath.Join(t.TempDir(), "index.json")
+	srv := newTestServer(t, dryrun.NewClient(nil), IndexFile(fp))
+	do(t, http.MethodPut, srv.URL+"/bucket", "")
+	do(t, http.MethodPut, srv.URL+"/empty", "")
+	for _, key := range []string{"a", "b", "c"} {
+		do(t, http.MethodPut, srv.URL+"/bucket/"+key, key)
+	}
+	do(t, http.MethodDelete, srv.URL+"/bucket/b", "")
+	do(t, http.MethodDelete, srv.URL+"/empty", "")
+
+	// a snapshot, then a line per change
+	data, err := os.ReadFile(fp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := bytes.Count(data, []byte("\n")); n != 8 {
+		t.Errorf("index has %d lines, want 8", n)
+	}
+
+	// a change cut short is dropped, the log is compacted
+	data = append(data, `{"Op":"put","Bucket":"bucket","Object":{"Key":"d"`...)
+	if err := os.WriteFile(fp, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	s, err := NewServer(dryrun.NewClient(nil), IndexFile(fp))
+	if err != nil {
+		t.Fatal(err)
+	}
+	l, err := s.index.list("bucket", "", "", "", maxKeys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var keys []string
+	for _, obj := range l.objects {
+		keys = append(keys, obj.Key)
+	}
+	if want := []string{"a", "c"}; !reflect.DeepEqual(keys, want) {
+		t.Errorf("reloaded keys %v, want %v", keys, want)
+	}
+	if s.index.hasBucket("empty") {
+		t.Errorf("deleted bucket reloaded")
+	}
+	if data, _ := os.ReadFile(fp); bytes.Count(data, []byte("\n")) != 1 {
+		t.Errorf("index not compacted: %s", data)
+	}
+
+	// a broken line before the last one is an error
+	data, _ = os.ReadFile(fp)
+	data = append(data, "{\n{}\n"...)
+	if err := os.WriteFile(fp, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewServer(dryrun.NewClient(nil), IndexFile(fp)); err == nil {
+		t.Errorf("loaded a broken index")
+	}
+}
+
+func TestIndexFileCompacts(t *testing.T) {
+	fp := filepath.Join(t.TempDir(), "index.json")
+	idx, err := loadIndex(fp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := idx.createBucket("bucket"); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < compactRecords; i++ {
+		if err := idx.put("bucket", &Object{Key: "key"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	data, _ := os.ReadFile(fp)
+	if n := bytes.Count(data, []byte("\n")); n != 1 {
+		t.Errorf("index has %d lines after %d changes, want a snapshot", n, compactRecords+1)
+	}
+}
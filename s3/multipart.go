@@ -0,0 +1,314 @@
+package s3
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/heilart1n/justpin-ipfs/dag"
+	"github.com/heilart1n/justpin-ipfs/file"
+	"github.com/heilart1n/justpin-ipfs/pinners"
+	"github.com/ipfs/go-cid"
+	ipld "github.com/ipfs/go-ipld-format"
+)
+
+// maxParts is the most parts of a multipart upload, as on S3.
+const maxParts = 10000
+
+// upload is a multipart upload in progress. Its parts are pinned one by
+// one as they arrive, completing it pins a file linking them in order.
+type upload struct {
+	bucket      string
+	key         string
+	contentType string
+	metadata    map[string]string
+	parts       map[int]*part
+}
+
+type part struct {
+	cid          cid.Cid
+	link         string
+	size         int64
+	md5          []byte
+	root         []byte
+	lastModified time.Time
+}
+
+func (s *Server) createUpload(w http.ResponseWriter, r *http.Request, bucket, key string) error {
+	if !s.index.hasBucket(bucket) {
+		return errNoSuchBucket
+	}
+	// the parts are joined by a new root block, which only pinners taking
+	// CARs or blocks can add
+	switch s.pinner.(type) {
+	case pinners.CARPinner, pinners.BlockPinner:
+	default:
+		return newError(http.StatusNotImplemented, "NotImplemented", "Multipart uploads are not supported by %s", s.pinner.Name())
+	}
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return err
+	}
+	id := hex.EncodeToString(buf)
+
+	s.mu.Lock()
+	s.uploads[id] = &upload{
+		bucket:      bucket,
+		key:         key,
+		contentType: r.Header.Get("Content-Type"),
+		metadata:    userMetadata(r.Header),
+		parts:       map[int]*part{},
+	}
+	s.mu.Unlock()
+
+	return writeXML(w, http.StatusOK, struct {
+		XMLName  xml.Name `xml:"InitiateMultipartUploadResult"`
+		Xmlns    string   `xml:"xmlns,attr"`
+		Bucket   string
+		Key      string
+		UploadId string
+	}{Xmlns: xmlns, Bucket: bucket, Key: key, UploadId: id})
+}
+
+// upload returns the upload id of bucket and key.
+func (s *Server) upload(bucket, key, id string) (*upload, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u := s.uploads[id]
+	if u == nil || u.bucket != bucket || u.key != key {
+		return nil, errNoSuchUpload
+	}
+	return u, nil
+}
+
+func (s *Server) uploadPart(w http.ResponseWriter, r *http.Request, bucket, key, id string) error {
+	number, err := strconv.Atoi(r.URL.Query().Get("partNumber"))
+	if err != nil || number < 1 || number > maxParts {
+		return newError(http.StatusBadRequest, "InvalidArgument", "Part number must be an integer between 1 and %d", maxParts)
+	}
+	u, err := s.upload(bucket, key, id)
+	if err != nil {
+		return err
+	}
+
+	result, size, sum, root, err := s.pinPart(r)
+	if err != nil {
+		return err
+	}
+	c := root.Cid()
+
+	s.mu.Lock()
+	if s.uploads[id] != u {
+		s.mu.Unlock()
+		return errNoSuchUpload
+	}
+	u.parts[number] = &part{cid: c, link: result.GetLink(), size: size, md5: sum, root: root.RawData(), lastModified: time.Now().UTC()}
+	s.mu.Unlock()
+
+	w.Header().Set("ETag", strconv.Quote(hex.EncodeToString(sum)))
+	w.Header().Set(CidHeader, c.String())
+	w.WriteHeader(http.StatusOK)
+	return nil
+}
+
+func (s *Server) completeUpload(w http.ResponseWriter, r *http.Request, bucket, key, id string) error {
+	var req struct {
+		Parts []struct {
+			PartNumber int
+			ETag       string
+		} `xml:"Part"`
+	}
+	if err := xml.NewDecoder(io.LimitReader(r.Body, 1<<20)).Decode(&req); err != nil {
+		return newError(http.StatusBadRequest, "MalformedXML", "The XML you provided was not well-formed")
+	}
+	if len(req.Parts) == 0 {
+		return newError(http.StatusBadRequest, "MalformedXML", "You must specify at least one part")
+	}
+
+	u, err := s.upload(bucket, key, id)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	parts := make([]*part, len(req.Parts))
+	for i, p := range req.Parts {
+		if i > 0 && p.PartNumber <= req.Parts[i-1].PartNumber {
+			s.mu.Unlock()
+			return newError(http.StatusBadRequest, "InvalidPartOrder", "The list of parts was not in ascending order")
+		}
+		parts[i] = u.parts[p.PartNumber]
+		if parts[i] == nil || strings.Trim(p.ETag, `"`) != hex.EncodeToString(parts[i].md5) {
+			s.mu.Unlock()
+			return newError(http.StatusBadRequest, "InvalidPart", "Part %d could not be found or its ETag does not match", p.PartNumber)
+		}
+	}
+	s.mu.Unlock()
+
+	// The ETag of a multipart object is the MD5 of the MD5s of its parts
+	// followed by their count.
+	h := md5.New()
+	var size int64
+	for _, p := range parts {
+		h.Write(p.md5)
+		size += p.size
+	}
+	etag := fmt.Sprintf("%s-%d", hex.EncodeToString(h.Sum(nil)), len(parts))
+
+	obj := &Object{
+		Key:          key,
+		Size:         size,
+		ETag:         etag,
+		ContentType:  u.contentType,
+		LastModified: time.Now().UTC(),
+		Metadata:     u.metadata,
+	}
+	if len(parts) == 1 {
+		obj.Cid, obj.Link = parts[0].cid.String(), parts[0].link
+	} else {
+		result, err := s.pinConcat(context.Background(), parts)
+		if err != nil {
+			return fmt.Errorf("%s: %v", s.pinner.Name(), err)
+		}
+		obj.Cid, obj.Link = result.GetHash(), result.GetLink()
+	}
+	if err := s.index.put(bucket, obj); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	delete(s.uploads, id)
+	s.mu.Unlock()
+
+	w.Header().Set(CidHeader, obj.Cid)
+	return writeXML(w, http.StatusOK, struct {
+		XMLName  xml.Name `xml:"CompleteMultipartUploadResult"`
+		Xmlns    string   `xml:"xmlns,attr"`
+		Location string
+		Bucket   string
+		Key      string
+		ETag     string
+	}{Xmlns: xmlns, Location: "/" + bucket + "/" + key, Bucket: bucket, Key: key, ETag: strconv.Quote(etag)})
+}
+
+// pinPart pins the body of r as a part and returns the result along with
+// the size and MD5 of the content and the root node of the part. The DAG is
+// built here, in a temporary directory, so the root blocks the parts are
+// joined by are known without reading them back.
+func (s *Server) pinPart(r *http.Request) (pinners.Result, int64, []byte, ipld.Node, error) {
+	body, err := s.body(r)
+	if err != nil {
+		return nil, 0, nil, nil, err
+	}
+	h := md5.New()
+	cr := &file.CountingReader{R: io.TeeReader(body, h)}
+
+	dir, err := os.MkdirTemp("", "justpin-part-")
+	if err != nil {
+		return nil, 0, nil, nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	ctx := r.Context()
+	b := dag.NewDiskBuilder(dir)
+	nd, err := b.AddReader(ctx, cr)
+	if err != nil {
+		var ae *apiError
+		if errors.As(cr.Err, &ae) {
+			return nil, 0, nil, nil, ae
+		}
+		return nil, 0, nil, nil, err
+	}
+	result, err := b.Pin(ctx, s.pinner, nd.Cid())
+	if err != nil {
+		return nil, 0, nil, nil, fmt.Errorf("%s: %v", s.pinner.Name(), err)
+	}
+	return result, cr.N, h.Sum(nil), nd, nil
+}
+
+// pinConcat pins the file of the parts, see dag.PinConcat, with their root
+// blocks kept from pinning them.
+func (s *Server) pinConcat(ctx context.Context, parts []*part) (pinners.Result, error) {
+	dagParts := make([]dag.Part, len(parts))
+	roots := make(partRoots, len(parts))
+	for i, p := range parts {
+		dagParts[i] = dag.Part{Cid: p.cid, Size: uint64(p.size)}
+		roots[p.cid] = p.root
+	}
+	b := dag.NewBuilder()
+	b.SetFetcher(roots)
+	nd, err := b.Concat(ctx, dagParts)
+	if err != nil {
+		return nil, err
+	}
+	return b.Pin(ctx, s.pinner, nd.Cid())
+}
+
+// partRoots is a dag.Fetcher of the root blocks of the parts of an upload.
+type partRoots map[cid.Cid][]byte
+
+func (pr partRoots) Fetch(_ context.Context, c cid.Cid) ([]byte, error) {
+	data, ok := pr[c]
+	if !ok {
+		return nil, fmt.Errorf("block %s is not the root of a part", c)
+	}
+	return data, nil
+}
+
+func (s *Server) abortUpload(w http.ResponseWriter, bucket, key, id string) error {
+	if _, err := s.upload(bucket, key, id); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	delete(s.uploads, id)
+	s.mu.Unlock()
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+func (s *Server) listParts(w http.ResponseWriter, bucket, key, id string) error {
+	u, err := s.upload(bucket, key, id)
+	if err != nil {
+		return err
+	}
+	type partEntry struct {
+		PartNumber   int
+		LastModified string
+		ETag         string
+		Size         int64
+	}
+	result := struct {
+		XMLName     xml.Name `xml:"ListPartsResult"`
+		Xmlns       string   `xml:"xmlns,attr"`
+		Bucket      string
+		Key         string
+		UploadId    string
+		IsTruncated bool
+		Parts       []partEntry `xml:"Part"`
+	}{Xmlns: xmlns, Bucket: bucket, Key: key, UploadId: id}
+
+	s.mu.Lock()
+	for number, p := range u.parts {
+		result.Parts = append(result.Parts, partEntry{
+			PartNumber:   number,
+			LastModified: p.lastModified.Format(timeFormat),
+			ETag:         strconv.Quote(hex.EncodeToString(p.md5)),
+			Size:         p.size,
+		})
+	}
+	s.mu.Unlock()
+	sort.Slice(result.Parts, func(i, j int) bool {
+		return result.Parts[i].PartNumber < result.Parts[j].PartNumber
+	})
+	return writeXML(w, http.StatusOK, result)
+}
@@ -0,0 +1,158 @@
+package s3
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/heilart1n/justpin-ipfs/dag"
+	"github.com/heilart1n/justpin-ipfs/file"
+	"github.com/heilart1n/justpin-ipfs/pinners"
+	"github.com/heilart1n/justpin-ipfs/pinners/dryrun"
+	"github.com/ipfs/go-cid"
+)
+
+// newTestServer serves a Server pinning to p.
+func newTestServer(t *testing.T, p pinners.Pinner, opts ...Option) *httptest.Server {
+	t.Helper()
+	s, err := NewServer(p, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(s)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// do sends an unsigned request and fails the test on a transport error.
+func do(t *testing.T, method, url, body string) *http.Response {
+	t.Helper()
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
+
+// gateway serves the raw blocks of b like a trustless gateway.
+func gateway(t *testing.T, b *dag.Builder) *httptest.Server {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, err := cid.Decode(strings.TrimPrefix(r.URL.Path, "/ipfs/"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		nd, err := b.DAGService().Get(r.Context(), c)
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(nd.RawData())
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestMultipartUpload(t *testing.T) {
+	ctx := context.Background()
+	contents := []string{strings.Repeat("a", 1<<20), "tail"}
+
+	// The dry run pinner keeps nothing and the gateway must not be read,
+	// the parts are joined with the root blocks kept from pinning them.
+	blocks := dag.NewBuilder()
+	var parts []dag.Part
+	for _, content := range contents {
+		nd, err := blocks.AddReader(ctx, strings.NewReader(content))
+		if err != nil {
+			t.Fatal(err)
+		}
+		parts = append(parts, dag.Part{Cid: nd.Cid(), Size: uint64(len(content))})
+	}
+	gw := gateway(t, blocks)
+	unused := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("gateway read %s", r.URL.Path)
+		http.NotFound(w, r)
+	}))
+	t.Cleanup(unused.Close)
+	srv := newTestServer(t, dryrun.NewClient(nil), Gateway(unused.URL))
+
+	if resp := do(t, http.MethodPut, srv.URL+"/bucket", ""); resp.StatusCode != http.StatusOK {
+		t.Fatalf("create bucket: %s", resp.Status)
+	}
+	resp := do(t, http.MethodPost, srv.URL+"/bucket/big.bin?uploads", "")
+	var created struct{ UploadId string }
+	if err := xml.NewDecoder(resp.Body).Decode(&created); err != nil || created.UploadId == "" {
+		t.Fatalf("create upload: %s, %v", resp.Status, err)
+	}
+	uploadURL := srv.URL + "/bucket/big.bin?uploadId=" + created.UploadId
+
+	var complete strings.Builder
+	complete.WriteString("<CompleteMultipartUpload>")
+	for i, content := range contents {
+		resp := do(t, http.MethodPut, fmt.Sprintf("%s&partNumber=%d", uploadURL, i+1), content)
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("upload part %d: %s", i+1, resp.Status)
+		}
+		if got := resp.Header.Get(CidHeader); got != parts[i].Cid.String() {
+			t.Errorf("part %d pinned as %s, want %s", i+1, got, parts[i].Cid)
+		}
+		fmt.Fprintf(&complete, "<Part><PartNumber>%d</PartNumber><ETag>%s</ETag></Part>", i+1, resp.Header.Get("ETag"))
+	}
+	complete.WriteString("</CompleteMultipartUpload>")
+
+	resp = do(t, http.MethodGet, uploadURL, "")
+	var listed struct {
+		Parts []struct{ PartNumber int } `xml:"Part"`
+	}
+	if err := xml.NewDecoder(resp.Body).Decode(&listed); err != nil || len(listed.Parts) != 2 {
+		t.Errorf("list parts: %v, %+v", err, listed)
+	}
+
+	resp = do(t, http.MethodPost, uploadURL, complete.String())
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		t.Fatalf("complete: %s: %s", resp.Status, body)
+	}
+	b := dag.NewBuilder()
+	b.SetFetcher(dag.NewGatewayFetcher(gw.URL, nil))
+	want, err := b.Concat(ctx, parts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := resp.Header.Get(CidHeader); got != want.Cid().String() {
+		t.Errorf("completed as %s, want %s", got, want.Cid())
+	}
+
+	resp = do(t, http.MethodHead, srv.URL+"/bucket/big.bin", "")
+	if resp.ContentLength != int64(len(contents[0])+len(contents[1])) || !strings.HasSuffix(resp.Header.Get("ETag"), `-2"`) {
+		t.Errorf("object size %d, etag %s", resp.ContentLength, resp.Header.Get("ETag"))
+	}
+}
+
+// nodePinner pins files only, like Pinata.
+type nodePinner struct {
+	pinners.Pinner
+}
+
+func (nodePinner) PinNode(*file.Node) (pinners.Result, error) {
+	return nil, fmt.Errorf("not pinned")
+}
+
+func TestMultipartUnsupported(t *testing.T) {
+	srv := newTestServer(t, nodePinner{dryrun.NewClient(nil)})
+	do(t, http.MethodPut, srv.URL+"/bucket", "")
+	resp := do(t, http.MethodPost, srv.URL+"/bucket/big.bin?uploads", "")
+	if resp.StatusCode != http.StatusNotImplemented {
+		t.Errorf("create upload: %s, want %d", resp.Status, http.StatusNotImplemented)
+	}
+}
@@ -0,0 +1,358 @@
+package s3
+
+import (
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/heilart1n/justpin-ipfs/file"
+	"github.com/heilart1n/justpin-ipfs/pinners"
+)
+
+// timeFormat is the ISO 8601 format of the dates in S3 documents.
+const timeFormat = "2006-01-02T15:04:05.000Z"
+
+// maxKeys is the most keys a listing returns.
+const maxKeys = 1000
+
+const metaPrefix = "X-Amz-Meta-"
+
+type owner struct {
+	ID          string
+	DisplayName string
+}
+
+var defaultOwner = owner{ID: "justpin", DisplayName: "justpin"}
+
+func (s *Server) listBuckets(w http.ResponseWriter) error {
+	type bucket struct {
+		Name         string
+		CreationDate string
+	}
+	result := struct {
+		XMLName xml.Name `xml:"ListAllMyBucketsResult"`
+		Xmlns   string   `xml:"xmlns,attr"`
+		Owner   owner
+		Buckets []bucket `xml:"Buckets>Bucket"`
+	}{Xmlns: xmlns, Owner: defaultOwner}
+
+	for name, created := range s.index.buckets() {
+		result.Buckets = append(result.Buckets, bucket{Name: name, CreationDate: created.Format(timeFormat)})
+	}
+	sort.Slice(result.Buckets, func(i, j int) bool {
+		return result.Buckets[i].Name < result.Buckets[j].Name
+	})
+	return writeXML(w, http.StatusOK, result)
+}
+
+func (s *Server) createBucket(w http.ResponseWriter, name string) error {
+	if !validBucketName(name) {
+		return newError(http.StatusBadRequest, "InvalidBucketName", "The specified bucket is not valid")
+	}
+	if err := s.index.createBucket(name); err != nil {
+		return err
+	}
+	w.Header().Set("Location", "/"+name)
+	w.WriteHeader(http.StatusOK)
+	return nil
+}
+
+// validBucketName follows the S3 naming rules: 3 to 63 lowercase letters,
+// digits, dots and hyphens, starting and ending with a letter or digit.
+func validBucketName(name string) bool {
+	if len(name) < 3 || len(name) > 63 {
+		return false
+	}
+	for i, c := range name {
+		alnum := c >= 'a' && c <= 'z' || c >= '0' && c <= '9'
+		if !alnum && (i == 0 || i == len(name)-1 || c != '.' && c != '-') {
+			return false
+		}
+	}
+	return !strings.Contains(name, "..")
+}
+
+func (s *Server) putObject(w http.ResponseWriter, r *http.Request, bucket, key string) error {
+	if !s.index.hasBucket(bucket) {
+		return errNoSuchBucket
+	}
+
+	result, size, sum, err := s.pinBody(r)
+	if err != nil {
+		return err
+	}
+	obj := &Object{
+		Key:          key,
+		Cid:          result.GetHash(),
+		Link:         result.GetLink(),
+		Size:         size,
+		ETag:         hex.EncodeToString(sum),
+		ContentType:  r.Header.Get("Content-Type"),
+		LastModified: time.Now().UTC(),
+		Metadata:     userMetadata(r.Header),
+	}
+	if err := s.index.put(bucket, obj); err != nil {
+		return err
+	}
+
+	w.Header().Set("ETag", strconv.Quote(obj.ETag))
+	w.Header().Set(CidHeader, obj.Cid)
+	w.WriteHeader(http.StatusOK)
+	return nil
+}
+
+// pinBody pins the body of r and returns the result along with the size
+// and MD5 of the content.
+func (s *Server) pinBody(r *http.Request) (pinners.Result, int64, []byte, error) {
+	body, err := s.body(r)
+	if err != nil {
+		return nil, 0, nil, err
+	}
+	h := md5.New()
+	cr := &file.CountingReader{R: io.TeeReader(body, h)}
+
+	var rd io.Reader = cr
+	if ct := r.Header.Get("Content-Type"); ct != "" {
+		rd = file.WithContentType(cr, ct)
+	}
+	result, err := s.pinner.PinWithReader(rd)
+	if err != nil {
+		var ae *apiError
+		if errors.As(cr.Err, &ae) {
+			return nil, 0, nil, ae
+		}
+		return nil, 0, nil, fmt.Errorf("%s: %v", s.pinner.Name(), err)
+	}
+	if cr.Err != nil && cr.Err != io.EOF {
+		return nil, 0, nil, cr.Err
+	}
+	return result, cr.N, h.Sum(nil), nil
+}
+
+// userMetadata returns the `x-amz-meta-*` headers of h, without the CID one.
+func userMetadata(h http.Header) map[string]string {
+	var meta map[string]string
+	for name, values := range h {
+		if !strings.HasPrefix(name, metaPrefix) || strings.EqualFold(name, CidHeader) {
+			continue
+		}
+		if meta == nil {
+			meta = map[string]string{}
+		}
+		meta[strings.ToLower(name[len(metaPrefix):])] = strings.Join(values, ",")
+	}
+	return meta
+}
+
+func (s *Server) headObject(w http.ResponseWriter, bucket, key string) error {
+	obj, err := s.index.get(bucket, key)
+	if err != nil {
+		return err
+	}
+	setObjectHeaders(w.Header(), obj)
+	w.Header().Set("Content-Length", strconv.FormatInt(obj.Size, 10))
+	w.WriteHeader(http.StatusOK)
+	return nil
+}
+
+// getObject streams the object from the gateway, ranges included.
+func (s *Server) getObject(w http.ResponseWriter, r *http.Request, bucket, key string) error {
+	obj, err := s.index.get(bucket, key)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(r.Context(), http.MethodGet, s.gateway+"/ipfs/"+obj.Cid, nil)
+	if err != nil {
+		return err
+	}
+	if rng := r.Header.Get("Range"); rng != "" {
+		req.Header.Set("Range", rng)
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return newError(http.StatusBadGateway, "InternalError", "read %s from gateway failed: %v", obj.Cid, err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusPartialContent:
+	case http.StatusRequestedRangeNotSatisfiable:
+		return newError(resp.StatusCode, "InvalidRange", "The requested range is not satisfiable")
+	default:
+		return newError(http.StatusBadGateway, "InternalError", "read %s from gateway failed: %s", obj.Cid, resp.Status)
+	}
+
+	setObjectHeaders(w.Header(), obj)
+	for _, name := range []string{"Content-Length", "Content-Range"} {
+		if v := resp.Header.Get(name); v != "" {
+			w.Header().Set(name, v)
+		}
+	}
+	w.WriteHeader(resp.StatusCode)
+	_, _ = io.Copy(w, resp.Body)
+	return nil
+}
+
+func setObjectHeaders(h http.Header, obj *Object) {
+	h.Set("ETag", strconv.Quote(obj.ETag))
+	h.Set("Last-Modified", obj.LastModified.Format(http.TimeFormat))
+	h.Set("Accept-Ranges", "bytes")
+	h.Set(CidHeader, obj.Cid)
+	if obj.ContentType != "" {
+		h.Set("Content-Type", obj.ContentType)
+	} else {
+		h.Set("Content-Type", "binary/octet-stream")
+	}
+	for name, value := range obj.Metadata {
+		h.Set(metaPrefix+name, value)
+	}
+}
+
+func (s *Server) deleteObject(w http.ResponseWriter, bucket, key string) error {
+	if err := s.index.delete(bucket, key); err != nil {
+		return err
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+type listEntry struct {
+	Key          string
+	LastModified string
+	ETag         string
+	Size         int64
+	StorageClass string
+}
+
+type commonPrefix struct {
+	Prefix string
+}
+
+// listObjects answers ListObjects, or ListObjectsV2 with `list-type=2`.
+func (s *Server) listObjects(w http.ResponseWriter, r *http.Request, bucket string) error {
+	query := r.URL.Query()
+	prefix, delimiter := query.Get("prefix"), query.Get("delimiter")
+	max := maxKeys
+	if v := query.Get("max-keys"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return newError(http.StatusBadRequest, "InvalidArgument", "Invalid max-keys %q", v)
+		}
+		if n < max {
+			max = n
+		}
+	}
+	encode := func(s string) string { return s }
+	if query.Get("encoding-type") == "url" {
+		encode = url.QueryEscape
+	}
+
+	v2 := query.Get("list-type") == "2"
+	after := query.Get("marker")
+	if v2 {
+		after = query.Get("start-after")
+		if token := query.Get("continuation-token"); token != "" {
+			data, err := base64.RawURLEncoding.DecodeString(token)
+			if err != nil {
+				return newError(http.StatusBadRequest, "InvalidArgument", "The continuation token provided is incorrect")
+			}
+			after = string(data)
+		}
+	}
+
+	l, err := s.index.list(bucket, prefix, delimiter, after, max)
+	if err != nil {
+		return err
+	}
+	contents := make([]listEntry, len(l.objects))
+	for i, obj := range l.objects {
+		contents[i] = listEntry{
+			Key:          encode(obj.Key),
+			LastModified: obj.LastModified.Format(timeFormat),
+			ETag:         strconv.Quote(obj.ETag),
+			Size:         obj.Size,
+			StorageClass: "STANDARD",
+		}
+	}
+	prefixes := make([]commonPrefix, len(l.prefixes))
+	for i, p := range l.prefixes {
+		prefixes[i] = commonPrefix{Prefix: encode(p)}
+	}
+
+	if v2 {
+		result := struct {
+			XMLName               xml.Name `xml:"ListBucketResult"`
+			Xmlns                 string   `xml:"xmlns,attr"`
+			Name                  string
+			Prefix                string
+			Delimiter             string `xml:",omitempty"`
+			StartAfter            string `xml:",omitempty"`
+			ContinuationToken     string `xml:",omitempty"`
+			NextContinuationToken string `xml:",omitempty"`
+			KeyCount              int
+			MaxKeys               int
+			EncodingType          string `xml:",omitempty"`
+			IsTruncated           bool
+			Contents              []listEntry
+			CommonPrefixes        []commonPrefix
+		}{
+			Xmlns:             xmlns,
+			Name:              bucket,
+			Prefix:            encode(prefix),
+			Delimiter:         encode(delimiter),
+			StartAfter:        encode(query.Get("start-after")),
+			ContinuationToken: query.Get("continuation-token"),
+			KeyCount:          len(contents) + len(prefixes),
+			MaxKeys:           max,
+			EncodingType:      query.Get("encoding-type"),
+			IsTruncated:       l.truncated,
+			Contents:          contents,
+			CommonPrefixes:    prefixes,
+		}
+		if l.truncated {
+			result.NextContinuationToken = base64.RawURLEncoding.EncodeToString([]byte(l.next))
+		}
+		return writeXML(w, http.StatusOK, result)
+	}
+
+	result := struct {
+		XMLName        xml.Name `xml:"ListBucketResult"`
+		Xmlns          string   `xml:"xmlns,attr"`
+		Name           string
+		Prefix         string
+		Marker         string
+		NextMarker     string `xml:",omitempty"`
+		Delimiter      string `xml:",omitempty"`
+		MaxKeys        int
+		EncodingType   string `xml:",omitempty"`
+		IsTruncated    bool
+		Contents       []listEntry
+		CommonPrefixes []commonPrefix
+	}{
+		Xmlns:          xmlns,
+		Name:           bucket,
+		Prefix:         encode(prefix),
+		Marker:         encode(after),
+		Delimiter:      encode(delimiter),
+		MaxKeys:        max,
+		EncodingType:   query.Get("encoding-type"),
+		IsTruncated:    l.truncated,
+		Contents:       contents,
+		CommonPrefixes: prefixes,
+	}
+	if l.truncated {
+		result.NextMarker = encode(l.next)
+	}
+	return writeXML(w, http.StatusOK, result)
+}
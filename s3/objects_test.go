@@ -0,0 +1,97 @@
+package s3
+
+import (
+	"encoding/xml"
+	"net/http"
+	"net/url"
+	"reflect"
+	"testing"
+
+	"github.com/heilart1n/justpin-ipfs/pinners/dryrun"
+)
+
+type listResult struct {
+	IsTruncated           bool
+	NextContinuationToken string
+	NextMarker            string
+	Contents              []struct{ Key string }
+	CommonPrefixes        []struct{ Prefix string }
+}
+
+func list(t *testing.T, rawURL string, query url.Values) *listResult {
+	t.Helper()
+	resp := do(t, http.MethodGet, rawURL+"?"+query.Encode(), "")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("list %s: %s", query.Encode(), resp.Status)
+	}
+	var l listResult
+	if err := xml.NewDecoder(resp.Body).Decode(&l); err != nil {
+		t.Fatal(err)
+	}
+	return &l
+}
+
+func (l *listResult) keys() []string {
+	var keys []string
+	for _, c := range l.Contents {
+		keys = append(keys, c.Key)
+	}
+	for _, p := range l.CommonPrefixes {
+		keys = append(keys, p.Prefix)
+	}
+	return keys
+}
+
+func TestListObjects(t *testing.T) {
+	srv := newTestServer(t, dryrun.NewClient(nil))
+	bucket := srv.URL + "/bucket"
+	do(t, http.MethodPut, bucket, "")
+	all := []string{"a/1", "a/2", "b", "c/d/e"}
+	for _, key := range all {
+		if resp := do(t, http.MethodPut, bucket+"/"+key, key); resp.StatusCode != http.StatusOK {
+			t.Fatalf("put %s: %s", key, resp.Status)
+		}
+	}
+
+	l := list(t, bucket, url.Values{"list-type": {"2"}, "delimiter": {"/"}})
+	if want := []string{"b", "a/", "c/"}; !reflect.DeepEqual(l.keys(), want) || l.IsTruncated {
+		t.Errorf("delimiter: %v, want %v", l.keys(), want)
+	}
+	l = list(t, bucket, url.Values{"list-type": {"2"}, "delimiter": {"/"}, "prefix": {"c/"}})
+	if want := []string{"c/d/"}; !reflect.DeepEqual(l.keys(), want) {
+		t.Errorf("prefix: %v, want %v", l.keys(), want)
+	}
+
+	// v2 pages with continuation tokens, v1 with markers
+	var got []string
+	query := url.Values{"list-type": {"2"}, "max-keys": {"1"}}
+	for i := 0; i <= len(all); i++ {
+		l := list(t, bucket, query)
+		got = append(got, l.keys()...)
+		if !l.IsTruncated {
+			break
+		}
+		query.Set("continuation-token", l.NextContinuationToken)
+	}
+	if !reflect.DeepEqual(got, all) {
+		t.Errorf("v2 pages: %v, want %v", got, all)
+	}
+
+	got = nil
+	query = url.Values{"max-keys": {"3"}}
+	for i := 0; i <= len(all); i++ {
+		l := list(t, bucket, query)
+		got = append(got, l.keys()...)
+		if !l.IsTruncated {
+			break
+		}
+		query.Set("marker", l.NextMarker)
+	}
+	if !reflect.DeepEqual(got, all) {
+		t.Errorf("v1 pages: %v, want %v", got, all)
+	}
+
+	if resp := do(t, http.MethodGet, srv.URL+"/missing?list-type=2", ""); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("missing bucket: %s", resp.Status)
+	}
+}
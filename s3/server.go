@@ -0,0 +1,257 @@
+// Package s3 serves a small S3-compatible API whose objects are pinned:
+// backup tools and SDKs that only speak S3 can pin through any Pinner.
+//
+// Buckets and keys are kept in an index mapping them to CIDs, reads are
+// served from an IPFS gateway. Only path-style requests are served, such as
+// `PUT /bucket/key`, so clients need path-style addressing turned on.
+package s3
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/heilart1n/justpin-ipfs/pinners"
+)
+
+// DefaultGateway is the gateway objects are read from by default.
+const DefaultGateway = "https://ipfs.io"
+
+// CidHeader is the object metadata holding the CID of an object.
+const CidHeader = "x-amz-meta-cid"
+
+const xmlns = "http://s3.amazonaws.com/doc/2006-03-01/"
+
+// Option configures a Server.
+type Option func(*Server)
+
+// Credentials makes the Server require requests signed with AWS Signature
+// Version 4 by this key pair. Without it, any request is served.
+func Credentials(accessKey, secretKey string) Option {
+	return func(s *Server) {
+		s.accessKey, s.secretKey = accessKey, secretKey
+	}
+}
+
+// Gateway sets the gateway objects are read from, DefaultGateway if empty.
+func Gateway(gateway string) Option {
+	return func(s *Server) {
+		s.gateway = gateway
+	}
+}
+
+// IndexFile keeps the buckets and objects in the file at fp, so they
+// survive restarts. Each change is appended to it as a line of JSON, the
+// file is compacted when the Server starts. Uploads in progress are kept in
+// memory only.
+func IndexFile(fp string) Option {
+	return func(s *Server) {
+		s.indexPath = fp
+	}
+}
+
+// HTTPClient sets the client used to read objects from the gateway.
+func HTTPClient(client *http.Client) Option {
+	return func(s *Server) {
+		s.client = client
+	}
+}
+
+// Server is an http.Handler speaking the S3 API for buckets (list, create,
+// head, delete), objects (put, get, head, delete), ListObjects (v1 and v2)
+// and multipart uploads. Objects are pinned through the pinner as they are
+// uploaded and carry their CID in the CidHeader metadata. Deleting an object
+// only removes its key, the content stays pinned. Multipart uploads need a
+// CARPinner or BlockPinner, to pin the block joining the parts.
+//
+// Example:
+//
+// > srv, err := s3.NewServer(pinner, s3.Credentials("key", "secret"), s3.IndexFile("index.json"))
+// >
+// > err = http.ListenAndServe(":9000", srv)
+type Server struct {
+	pinner    pinners.Pinner
+	accessKey string
+	secretKey string
+	gateway   string
+	indexPath string
+	client    *http.Client
+
+	index *index
+
+	mu      sync.Mutex
+	uploads map[string]*upload
+}
+
+// NewServer returns a Server pinning to pinner. It fails when the index
+// file can't be read.
+func NewServer(pinner pinners.Pinner, opts ...Option) (*Server, error) {
+	s := &Server{pinner: pinner, uploads: map[string]*upload{}}
+	for _, opt := range opts {
+		opt(s)
+	}
+	if s.gateway == "" {
+		s.gateway = DefaultGateway
+	}
+	s.gateway = strings.TrimSuffix(s.gateway, "/")
+	if s.client == nil {
+		s.client = http.DefaultClient
+	}
+
+	var err error
+	if s.index, err = loadIndex(s.indexPath); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// apiError is an error answered as an S3 error document.
+type apiError struct {
+	status int
+	code   string
+	msg    string
+}
+
+func (e *apiError) Error() string {
+	return e.msg
+}
+
+func newError(status int, code, format string, a ...interface{}) *apiError {
+	return &apiError{status: status, code: code, msg: fmt.Sprintf(format, a...)}
+}
+
+var (
+	errNoSuchBucket   = newError(http.StatusNotFound, "NoSuchBucket", "The specified bucket does not exist")
+	errNoSuchKey      = newError(http.StatusNotFound, "NoSuchKey", "The specified key does not exist")
+	errNoSuchUpload   = newError(http.StatusNotFound, "NoSuchUpload", "The specified multipart upload does not exist")
+	errBucketExists   = newError(http.StatusConflict, "BucketAlreadyOwnedByYou", "The bucket already exists")
+	errBucketNotEmpty = newError(http.StatusConflict, "BucketNotEmpty", "The bucket is not empty")
+	errAccessDenied   = newError(http.StatusForbidden, "AccessDenied", "Access Denied")
+	errNotImplemented = newError(http.StatusNotImplemented, "NotImplemented", "The requested operation is not implemented")
+)
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if err := s.serve(w, r); err != nil {
+		writeError(w, r, err)
+	}
+}
+
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) error {
+	if err := s.authenticate(r); err != nil {
+		return err
+	}
+
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	query := r.URL.Query()
+	switch {
+	case bucket == "":
+		if r.Method != http.MethodGet {
+			return errMethod(r)
+		}
+		return s.listBuckets(w)
+	case key == "":
+		return s.serveBucket(w, r, bucket)
+	}
+
+	_, uploads := query["uploads"]
+	uploadID := query.Get("uploadId")
+	switch r.Method {
+	case http.MethodPut:
+		if r.Header.Get("x-amz-copy-source") != "" {
+			return errNotImplemented
+		}
+		if uploadID != "" {
+			return s.uploadPart(w, r, bucket, key, uploadID)
+		}
+		return s.putObject(w, r, bucket, key)
+	case http.MethodPost:
+		if uploads {
+			return s.createUpload(w, r, bucket, key)
+		}
+		if uploadID != "" {
+			return s.completeUpload(w, r, bucket, key, uploadID)
+		}
+		return errNotImplemented
+	case http.MethodGet:
+		if uploadID != "" {
+			return s.listParts(w, bucket, key, uploadID)
+		}
+		return s.getObject(w, r, bucket, key)
+	case http.MethodHead:
+		return s.headObject(w, bucket, key)
+	case http.MethodDelete:
+		if uploadID != "" {
+			return s.abortUpload(w, bucket, key, uploadID)
+		}
+		return s.deleteObject(w, bucket, key)
+	}
+	return errMethod(r)
+}
+
+func (s *Server) serveBucket(w http.ResponseWriter, r *http.Request, bucket string) error {
+	query := r.URL.Query()
+	switch r.Method {
+	case http.MethodPut:
+		return s.createBucket(w, bucket)
+	case http.MethodHead:
+		if !s.index.hasBucket(bucket) {
+			return errNoSuchBucket
+		}
+		return nil
+	case http.MethodDelete:
+		if err := s.index.deleteBucket(bucket); err != nil {
+			return err
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	case http.MethodGet:
+		if _, ok := query["location"]; ok {
+			if !s.index.hasBucket(bucket) {
+				return errNoSuchBucket
+			}
+			return writeXML(w, http.StatusOK, struct {
+				XMLName xml.Name `xml:"LocationConstraint"`
+				Xmlns   string   `xml:"xmlns,attr"`
+			}{Xmlns: xmlns})
+		}
+		if _, ok := query["uploads"]; ok {
+			return errNotImplemented
+		}
+		return s.listObjects(w, r, bucket)
+	}
+	return errMethod(r)
+}
+
+func errMethod(r *http.Request) error {
+	return newError(http.StatusMethodNotAllowed, "MethodNotAllowed", "The specified method %s is not allowed against this resource", r.Method)
+}
+
+func writeXML(w http.ResponseWriter, status int, v interface{}) error {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	if _, err := w.Write([]byte(xml.Header)); err != nil {
+		return nil
+	}
+	_ = xml.NewEncoder(w).Encode(v)
+	return nil
+}
+
+func writeError(w http.ResponseWriter, r *http.Request, err error) {
+	var ae *apiError
+	if !errors.As(err, &ae) {
+		ae = newError(http.StatusInternalServerError, "InternalError", "%v", err)
+	}
+	if r.Method == http.MethodHead {
+		w.WriteHeader(ae.status)
+		return
+	}
+	_ = writeXML(w, ae.status, struct {
+		XMLName  xml.Name `xml:"Error"`
+		Code     string
+		Message  string
+		Resource string
+	}{Code: ae.code, Message: ae.msg, Resource: r.URL.Path})
+}
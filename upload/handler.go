@@ -0,0 +1,283 @@
+// Package upload serves HTTP uploads from browsers and pins them as they
+// stream in.
+package upload
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/heilart1n/justpin-ipfs/file"
+	"github.com/heilart1n/justpin-ipfs/pinners"
+)
+
+// DefaultMaxSize is the largest upload a Handler accepts by default.
+const DefaultMaxSize = 100 << 20
+
+// FileField is the multipart form field holding the upload.
+const FileField = "file"
+
+// maxFormOverhead is what the rest of a multipart form may add to the body.
+const maxFormOverhead = 1 << 20
+
+// Option configures a Handler.
+type Option func(*Handler)
+
+// MaxSize limits the size of an upload to n bytes, 0 for DefaultMaxSize.
+func MaxSize(n int64) Option {
+	return func(h *Handler) {
+		h.maxSize = n
+	}
+}
+
+// AllowTypes limits uploads to the given MIME types. A type may end with
+// `/*` to allow a whole family, such as "image/*". All types are allowed
+// when none are given.
+func AllowTypes(types ...string) Option {
+	return func(h *Handler) {
+		h.types = append(h.types, types...)
+	}
+}
+
+// Handler pins the uploads it receives. It takes a POST with either a
+// multipart form, whose FileField part is pinned, or a raw body, named by
+// the filename of its Content-Disposition header if any. The content is
+// streamed into the pinner's request as it's received, nothing is written to
+// disk or buffered, so a failed pin isn't retried.
+//
+// The type of an upload is sniffed from its content, the declared one is
+// only used when sniffing is inconclusive, so a client can't pass a page
+// for an image.
+//
+// It answers with a JSON Response, or a JSON error:
+//
+// > {"error": "upload is larger than 1048576 bytes"}
+//
+// Example:
+//
+// > http.Handle("/upload", upload.NewHandler(pinner, upload.MaxSize(10<<20), upload.AllowTypes("image/*")))
+type Handler struct {
+	pinner  pinners.Pinner
+	maxSize int64
+	types   []string
+}
+
+// Response is the body of a successful upload.
+type Response struct {
+	Cid  string `json:"cid"`
+	Link string `json:"link"`
+	Size int64  `json:"size"`
+	Name string `json:"name,omitempty"`
+	Type string `json:"type"`
+}
+
+// NewHandler returns a Handler pinning to pinner.
+func NewHandler(pinner pinners.Pinner, opts ...Option) *Handler {
+	h := &Handler{pinner: pinner}
+	for _, opt := range opts {
+		opt(h)
+	}
+	if h.maxSize <= 0 {
+		h.maxSize = DefaultMaxSize
+	}
+	return h
+}
+
+// httpError is an error with the status it is answered with.
+type httpError struct {
+	status int
+	msg    string
+}
+
+func (e *httpError) Error() string {
+	return e.msg
+}
+
+func errorf(status int, format string, a ...interface{}) error {
+	return &httpError{status: status, msg: fmt.Sprintf(format, a...)}
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	resp, err := h.serve(w, r)
+	if err != nil {
+		status := http.StatusBadGateway
+		var he *httpError
+		if errors.As(err, &he) {
+			status = he.status
+		}
+		if status == http.StatusMethodNotAllowed {
+			w.Header().Set("Allow", http.MethodPost)
+		}
+		writeJSON(w, status, map[string]string{"error": err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (h *Handler) serve(w http.ResponseWriter, r *http.Request) (*Response, error) {
+	if r.Method != http.MethodPost {
+		return nil, errorf(http.StatusMethodNotAllowed, "method %s not allowed", r.Method)
+	}
+	if r.ContentLength > h.maxSize+maxFormOverhead {
+		return nil, h.tooLarge()
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, h.maxSize+maxFormOverhead)
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != "multipart/form-data" {
+		var name string
+		if _, params, err := mime.ParseMediaType(r.Header.Get("Content-Disposition")); err == nil {
+			name = params["filename"]
+		}
+		return h.pin(r.Body, name, mediaType)
+	}
+
+	mr, err := r.MultipartReader()
+	if err != nil {
+		return nil, errorf(http.StatusBadRequest, "invalid multipart form: %v", err)
+	}
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			return nil, errorf(http.StatusBadRequest, "missing %q field", FileField)
+		}
+		if err != nil {
+			return nil, errorf(http.StatusBadRequest, "invalid multipart form: %v", err)
+		}
+		if part.FormName() != FileField {
+			part.Close()
+			continue
+		}
+
+		mediaType, _, _ := mime.ParseMediaType(part.Header.Get("Content-Type"))
+		resp, err := h.pin(part, part.FileName(), mediaType)
+		part.Close()
+		return resp, err
+	}
+}
+
+// pin checks the type of rd, then pins it while counting its size.
+func (h *Handler) pin(rd io.Reader, name, declared string) (*Response, error) {
+	name = path.Base(strings.ReplaceAll(name, `\`, "/"))
+	if name == "." || name == ".." || name == "/" {
+		name = ""
+	}
+
+	lr := &limitedReader{r: rd, left: h.maxSize}
+	contentType, body, err := file.DetectContentType(lr, name)
+	if err != nil {
+		return nil, h.readError(lr, err)
+	}
+	if contentType == "application/octet-stream" && declared != "" {
+		contentType = declared
+	}
+	if !h.allowed(contentType) {
+		return nil, errorf(http.StatusUnsupportedMediaType, "type %s not allowed", contentType)
+	}
+	body = file.WithContentType(body, contentType)
+
+	var result pinners.Result
+	if np, ok := h.pinner.(pinners.NodePinner); ok && name != "" {
+		var node *file.Node
+		if node, err = file.NewReaderFile(name, body); err == nil {
+			result, err = np.PinNode(node)
+		}
+	} else {
+		result, err = h.pinner.PinWithReader(body)
+	}
+	if err == nil {
+		// A pinner ending the upload early on a read error would have
+		// pinned it truncated.
+		err = lr.err
+	}
+	if err != nil {
+		return nil, h.readError(lr, err)
+	}
+
+	return &Response{
+		Cid:  result.GetHash(),
+		Link: result.GetLink(),
+		Size: lr.n,
+		Name: name,
+		Type: contentType,
+	}, nil
+}
+
+// readError returns the error to answer when reading or pinning the upload
+// failed, the size limit taking precedence over what the pinner made of it.
+func (h *Handler) readError(lr *limitedReader, err error) error {
+	var mbe *http.MaxBytesError
+	if lr.exceeded || errors.As(err, &mbe) {
+		return h.tooLarge()
+	}
+	return fmt.Errorf("%s: %v", h.pinner.Name(), err)
+}
+
+func (h *Handler) tooLarge() error {
+	return errorf(http.StatusRequestEntityTooLarge, "upload is larger than %d bytes", h.maxSize)
+}
+
+func (h *Handler) allowed(contentType string) bool {
+	if len(h.types) == 0 {
+		return true
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	for _, t := range h.types {
+		if t == mediaType {
+			return true
+		}
+		if family, ok := strings.CutSuffix(t, "/*"); ok && strings.HasPrefix(mediaType, family+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// errTooLarge is returned by a limitedReader once its limit is crossed.
+var errTooLarge = errors.New("upload too large")
+
+// limitedReader counts what is read and fails past its limit, unlike
+// io.LimitReader which would silently truncate the upload. It keeps the
+// first read error.
+type limitedReader struct {
+	r        io.Reader
+	left     int64
+	n        int64
+	exceeded bool
+	err      error
+}
+
+func (lr *limitedReader) Read(p []byte) (int, error) {
+	if lr.exceeded {
+		return 0, errTooLarge
+	}
+	if int64(len(p)) > lr.left+1 {
+		p = p[:lr.left+1]
+	}
+	n, err := lr.r.Read(p)
+	if int64(n) > lr.left {
+		lr.exceeded = true
+		n = int(lr.left)
+		err = errTooLarge
+	}
+	lr.left -= int64(n)
+	lr.n += int64(n)
+	if err != nil && err != io.EOF && lr.err == nil {
+		lr.err = err
+	}
+	return n, err
+}
@@ -0,0 +1,160 @@
+package upload
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/heilart1n/justpin-ipfs/config"
+	"github.com/heilart1n/justpin-ipfs/pinners"
+	"github.com/heilart1n/justpin-ipfs/pinners/nftstorage"
+	"github.com/heilart1n/justpin-ipfs/pinners/pinata"
+)
+
+// redirect sends every request to the test server srv.
+type redirect struct {
+	srv *httptest.Server
+}
+
+func (rt redirect) RoundTrip(req *http.Request) (*http.Response, error) {
+	u, _ := url.Parse(rt.srv.URL)
+	req.URL.Scheme, req.URL.Host = u.Scheme, u.Host
+	return rt.srv.Client().Transport.RoundTrip(req)
+}
+
+// pinataServer answers pinFileToIPFS with the content of the file part it
+// received.
+func pinataServer(t *testing.T, got *bytes.Buffer) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mr, err := r.MultipartReader()
+		if err != nil {
+			t.Errorf("invalid form: %v", err)
+			return
+		}
+		for {
+			part, err := mr.NextPart()
+			if err != nil {
+				// A truncated form never gets its final boundary.
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			if part.FormName() != "file" {
+				continue
+			}
+			if _, err := io.Copy(got, part); err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]string{"IpfsHash": "bafkqaaa"})
+			return
+		}
+	}))
+}
+
+func TestHandlerRoundTrip(t *testing.T) {
+	var got bytes.Buffer
+	srv := pinataServer(t, &got)
+	defer srv.Close()
+	pinner := pinata.NewClient(config.NewConfig("key", "secret"), &http.Client{Transport: redirect{srv}})
+	h := NewHandler(pinner, MaxSize(16))
+
+	for _, tt := range []struct {
+		name   string
+		body   string
+		status int
+	}{
+		{name: "fits", body: "hello, world", status: http.StatusOK},
+		{name: "too large", body: strings.Repeat("x", 64<<10), status: http.StatusRequestEntityTooLarge},
+	} {
+		got.Reset()
+		// A reader hides the length, so the upload is streamed.
+		req := httptest.NewRequest(http.MethodPost, "/", io.MultiReader(strings.NewReader(tt.body)))
+		req.Header.Set("Content-Type", "text/plain")
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+
+		if w.Code != tt.status {
+			t.Fatalf("%s: status %d, want %d: %s", tt.name, w.Code, tt.status, w.Body)
+		}
+		if tt.status != http.StatusOK {
+			continue
+		}
+		if got.String() != tt.body {
+			t.Errorf("%s: pinned %q, want %q", tt.name, got.String(), tt.body)
+		}
+		var resp Response
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		if resp.Cid != "bafkqaaa" || resp.Size != int64(len(tt.body)) {
+			t.Errorf("%s: response %+v", tt.name, resp)
+		}
+	}
+}
+
+// lenientPinner reads an upload until it fails and pins what it got.
+type lenientPinner struct {
+	pinners.Pinner
+}
+
+func (lenientPinner) Name() string {
+	return "lenient"
+}
+
+func (lenientPinner) PinWithReader(rd io.Reader) (pinners.Result, error) {
+	io.Copy(io.Discard, rd)
+	return nil, nil
+}
+
+func TestHandlerTruncated(t *testing.T) {
+	h := NewHandler(lenientPinner{}, MaxSize(16))
+
+	var body bytes.Buffer
+	m := multipart.NewWriter(&body)
+	part, _ := m.CreateFormFile(FileField, "")
+	part.Write(bytes.Repeat([]byte("x"), 1024))
+	m.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/", &body)
+	req.Header.Set("Content-Type", m.FormDataContentType())
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("status %d, want %d: %s", w.Code, http.StatusRequestEntityTooLarge, w.Body)
+	}
+}
+
+func TestHandlerNFTStorage(t *testing.T) {
+	var got bytes.Buffer
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(&got, r.Body)
+		io.WriteString(w, `{"ok":true,"value":{"cid":"bafkqaaa"}}`)
+	}))
+	defer srv.Close()
+	pinner := nftstorage.NewClient(config.NewConfig("key", ""), &http.Client{Transport: redirect{srv}})
+	h := NewHandler(pinner)
+
+	// A named file part is pinned as a file Node.
+	var body bytes.Buffer
+	m := multipart.NewWriter(&body)
+	part, _ := m.CreateFormFile(FileField, "hello.txt")
+	part.Write([]byte("hello, world"))
+	m.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/", &body)
+	req.Header.Set("Content-Type", m.FormDataContentType())
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", w.Code, w.Body)
+	}
+	if got.String() != "hello, world" {
+		t.Errorf("pinned %q", got.String())
+	}
+}